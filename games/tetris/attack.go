@@ -0,0 +1,82 @@
+package tetris
+
+// Garbage lines sent for a clear, by lines cleared. T-spins and perfect
+// clears send more.
+var (
+	lineAttack         = [5]int{0, 0, 1, 2, 4}
+	tSpinAttack        = [4]int{0, 2, 4, 6}
+	perfectClearAttack = 10
+)
+
+// Attack returns the garbage lines a clear sends before any bonus.
+func Attack(event ClearEvent) int {
+	attack := 0
+	switch {
+	case event.TSpin && event.Lines < len(tSpinAttack):
+		attack = tSpinAttack[event.Lines]
+	case event.Lines < len(lineAttack):
+		attack = lineAttack[event.Lines]
+	}
+	if event.PerfectClear {
+		attack += perfectClearAttack
+	}
+	return attack
+}
+
+// garbageBatch is one attack waiting to rise, with every row sharing a hole.
+type garbageBatch struct {
+	rows int
+	hole int
+}
+
+// ReceiveGarbage queues garbage sent by an opponent. It rises the next time
+// a piece locks without clearing lines, unless the player's own clears
+// cancel it first.
+func (t *Tetris) ReceiveGarbage(rows int) {
+	if t.gameOver || rows <= 0 {
+		return
+	}
+	t.incoming = append(t.incoming, garbageBatch{rows: rows, hole: secureRandIntn(t.rules.Width)})
+}
+
+// PendingGarbage returns the number of queued garbage lines.
+func (t *Tetris) PendingGarbage() int {
+	pending := 0
+	for _, batch := range t.incoming {
+		pending += batch.rows
+	}
+	return pending
+}
+
+// TakeAttack returns the garbage lines the player has sent since the last
+// call, after cancelling their own incoming garbage.
+func (t *Tetris) TakeAttack() int {
+	attack := t.outgoing
+	t.outgoing = 0
+	return attack
+}
+
+// exchangeGarbage settles a locked piece's clear against incoming garbage:
+// an attack cancels queued lines first and the rest is sent, while a piece
+// that clears nothing lets the queued garbage rise.
+func (t *Tetris) exchangeGarbage() {
+	attack := Attack(t.lastClear)
+	for attack > 0 && len(t.incoming) > 0 {
+		cancelled := min(attack, t.incoming[0].rows)
+		attack -= cancelled
+		t.incoming[0].rows -= cancelled
+		if t.incoming[0].rows == 0 {
+			t.incoming = t.incoming[1:]
+		}
+	}
+	t.outgoing += attack
+
+	if t.lastClear.Lines > 0 {
+		return
+	}
+	for len(t.incoming) > 0 && !t.gameOver {
+		batch := t.incoming[0]
+		t.incoming = t.incoming[1:]
+		t.AddGarbage(batch.rows, batch.hole)
+	}
+}
@@ -0,0 +1,100 @@
+package tetris
+
+// ClearEvent describes what a single piece achieved when it locked.
+type ClearEvent struct {
+	Piece        int  `json:"piece"`
+	Lines        int  `json:"lines"`
+	TSpin        bool `json:"tSpin"`
+	PerfectClear bool `json:"perfectClear"`
+}
+
+// ClearStats counts special clears over a game.
+type ClearStats struct {
+	// TSpins counts T-spins by lines cleared (0 to 3).
+	TSpins        [4]int `json:"tSpins"`
+	PerfectClears int    `json:"perfectClears"`
+}
+
+const pieceT = 2
+
+// isTSpin reports whether the active piece, about to lock, is a T-spin: a T
+// whose last successful move was a rotation and with at least three of the
+// four cells diagonal to its centre filled (walls and floor count).
+func (t *Tetris) isTSpin() bool {
+	piece := t.currentPiece
+	if piece == nil || piece.pieceType != pieceT || !t.lastMoveRotation {
+		return false
+	}
+
+	// The centre of a T is the only cell with three neighbours in the piece.
+	filled := func(x, y int) bool {
+		return y >= 0 && y < len(piece.shape) && x >= 0 && x < len(piece.shape[y]) && piece.shape[y][x] == 1
+	}
+	centreX, centreY := -1, -1
+	for y := range piece.shape {
+		for x := range piece.shape[y] {
+			if !filled(x, y) {
+				continue
+			}
+			neighbours := 0
+			for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				if filled(x+d[0], y+d[1]) {
+					neighbours++
+				}
+			}
+			if neighbours == 3 {
+				centreX, centreY = x, y
+			}
+		}
+	}
+	if centreX < 0 {
+		return false
+	}
+
+	corners := 0
+	for _, d := range [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}} {
+		x := piece.x + centreX + d[0]
+		y := piece.y + centreY + d[1]
+		if x < 0 || x >= t.rules.Width || y >= len(t.board) || (y >= 0 && t.board[y][x] != 0) {
+			corners++
+		}
+	}
+	return corners >= 3
+}
+
+func (t *Tetris) boardEmpty() bool {
+	for _, row := range t.board {
+		for _, cell := range row {
+			if cell != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (t *Tetris) recordClear(pieceType, lines int, tSpin bool) {
+	event := ClearEvent{
+		Piece:        pieceType,
+		Lines:        lines,
+		TSpin:        tSpin,
+		PerfectClear: lines > 0 && t.boardEmpty(),
+	}
+	t.lastClear = event
+
+	if tSpin && lines < len(t.clearStats.TSpins) {
+		t.clearStats.TSpins[lines]++
+	}
+	if event.PerfectClear {
+		t.clearStats.PerfectClears++
+	}
+}
+
+// LastClear returns what the most recently locked piece achieved.
+func (t *Tetris) LastClear() ClearEvent {
+	return t.lastClear
+}
+
+func (t *Tetris) ClearStats() ClearStats {
+	return t.clearStats
+}
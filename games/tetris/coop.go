@@ -0,0 +1,278 @@
+package tetris
+
+import "fmt"
+
+// Co-op games are played by this many players on one board.
+const (
+	MinCoopPlayers = 2
+	MaxCoopPlayers = 4
+)
+
+// Coop is a cooperative game: several players each control their own active
+// piece, queue and hold on one shared, wider board, and share its score and
+// lines. Active pieces collide with each other as well as with the stack.
+type Coop struct {
+	game *Tetris
+	// players holds each player's controller. The one at index active is
+	// stale while it is swapped into game.
+	players []controller
+	active  int
+}
+
+// CoopRules widens rules for a co-op game, giving each player a lane as wide
+// as the original field, up to the largest width Rules allows.
+func CoopRules(rules Rules, players int) Rules {
+	rules.Width = min(rules.Width*players, 40)
+	return rules
+}
+
+// NewCoop creates a co-op game for the given number of players, on a board
+// widened by CoopRules. Each player's pieces spawn in the middle of their own
+// lane, numbered left to right.
+func NewCoop(rules Rules, players int) (*Coop, error) {
+	if players < MinCoopPlayers || players > MaxCoopPlayers {
+		return nil, fmt.Errorf("co-op needs between %d and %d players", MinCoopPlayers, MaxCoopPlayers)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	rules = CoopRules(rules, players)
+
+	c := &Coop{
+		game:    newGame(rules),
+		players: make([]controller, players),
+	}
+
+	laneWidth := rules.Width / players
+	for i := range c.players {
+		c.players[i] = controller{
+			handling:  DefaultHandling(),
+			laneStart: i * laneWidth,
+			laneWidth: laneWidth,
+		}
+	}
+	// New dealt a piece to a full-width controller; replace it with the
+	// first player's.
+	c.game.controller = c.players[0]
+	for i := range c.players {
+		c.enter(i)
+		c.game.spawnPiece()
+	}
+
+	return c, nil
+}
+
+// enter swaps the player's controller into the game so that engine methods
+// act on their piece, with everyone else's pieces as teammates.
+func (c *Coop) enter(player int) {
+	if player != c.active {
+		c.players[c.active] = c.game.controller
+		c.game.controller = c.players[player]
+		c.active = player
+	}
+
+	c.game.teammates = c.game.teammates[:0]
+	for i := range c.players {
+		if i != player && c.players[i].currentPiece != nil {
+			c.game.teammates = append(c.game.teammates, c.players[i].currentPiece)
+		}
+	}
+}
+
+// run does something on the player's behalf. If it locked a piece, cleared
+// lines may have dropped the stack onto other players' pieces, so those are
+// lifted clear; a piece that can't be freed ends the game with a block out.
+func (c *Coop) run(player int, action func()) {
+	placed := c.game.piecesPlaced
+	c.enter(player)
+	action()
+	if c.game.gameOver || c.game.piecesPlaced == placed {
+		return
+	}
+
+	for i := range c.players {
+		if i == player {
+			continue
+		}
+		c.enter(i)
+		if !c.game.liftPiece() {
+			c.game.topOut(TopOutBlockOut)
+			return
+		}
+	}
+}
+
+func (c *Coop) validPlayer(player int) bool {
+	return player >= 0 && player < len(c.players)
+}
+
+// Players returns the number of players.
+func (c *Coop) Players() int {
+	return len(c.players)
+}
+
+// Rules returns the widened rules the game is played with.
+func (c *Coop) Rules() Rules {
+	return c.game.rules
+}
+
+// Update advances the game by one frame, running each player's piece in
+// turn.
+func (c *Coop) Update() {
+	if c.game.gameOver {
+		return
+	}
+
+	c.game.frame++
+	for i := range c.players {
+		c.run(i, c.game.step)
+		if c.game.gameOver {
+			return
+		}
+	}
+}
+
+// HandleInput applies an input for a player straight away. A shared game
+// can't be paused by one player, so pause is ignored.
+func (c *Coop) HandleInput(player int, action string) {
+	if !c.validPlayer(player) || c.game.gameOver || action == "pause" {
+		return
+	}
+	c.run(player, func() { c.game.HandleWebInput(action) })
+}
+
+// QueueInput schedules a sequenced input for a player, see Tetris.QueueInput.
+// Each player has their own sequence.
+func (c *Coop) QueueInput(player int, in Input) bool {
+	if !c.validPlayer(player) || c.game.gameOver || in.Action == "pause" {
+		return false
+	}
+	var queued bool
+	c.run(player, func() { queued = c.game.QueueInput(in) })
+	return queued
+}
+
+// SetHandling changes a player's handling. Invalid settings are ignored.
+func (c *Coop) SetHandling(player int, h Handling) bool {
+	if !c.validPlayer(player) {
+		return false
+	}
+	c.enter(player)
+	return c.game.SetHandling(h)
+}
+
+// SetLevel sets the shared starting level, see Tetris.SetLevel.
+func (c *Coop) SetLevel(level int) {
+	c.game.SetLevel(level)
+}
+
+func (c *Coop) IsGameOver() bool {
+	return c.game.gameOver
+}
+
+func (c *Coop) GetScore() int {
+	return c.game.score
+}
+
+// CoopPlayerState is one player's view of a co-op game. Coordinates are
+// relative to the top visible row, as in Snapshot.
+type CoopPlayerState struct {
+	Piece        *PieceState `json:"piece"`
+	GhostY       int         `json:"ghostY"`
+	Hold         int         `json:"hold"`
+	Next         []int       `json:"next"`
+	LastInputSeq uint32      `json:"lastInputSeq"`
+}
+
+// CoopState is the shared state of a co-op game. Board holds the locked cells
+// with every player's active piece drawn in.
+type CoopState struct {
+	Board    [][]int           `json:"board"`
+	Players  []CoopPlayerState `json:"players"`
+	Score    int               `json:"score"`
+	Lines    int               `json:"lines"`
+	Level    int               `json:"level"`
+	GameOver bool              `json:"gameOver"`
+	TopOut   string            `json:"topOut,omitempty"`
+	Frame    uint64            `json:"frame"`
+	Stats    struct {
+		TimePlayed   int    `json:"timePlayed"`
+		PiecesPlaced int    `json:"piecesPlaced"`
+		LineStats    [4]int `json:"lineStats"`
+	} `json:"stats"`
+}
+
+// GetState returns the shared state. It doesn't change the game, so it is
+// safe to call while others only read it.
+func (c *Coop) GetState() CoopState {
+	state := CoopState{
+		Players:  make([]CoopPlayerState, len(c.players)),
+		Score:    c.game.score,
+		Lines:    c.game.lines,
+		Level:    c.game.level,
+		GameOver: c.game.gameOver,
+		TopOut:   c.game.topOutReason,
+		Frame:    c.game.frame,
+	}
+	state.Stats.TimePlayed = int(c.game.PlayTime().Seconds())
+	state.Stats.PiecesPlaced = c.game.piecesPlaced
+	state.Stats.LineStats = c.game.lineStats
+
+	for i := range c.players {
+		view := c.view(i)
+		snapshot := view.Snapshot()
+		if state.Board == nil {
+			state.Board = snapshot.Board
+		}
+		state.Players[i] = CoopPlayerState{
+			Piece:        snapshot.Piece,
+			GhostY:       snapshot.GhostY,
+			Hold:         snapshot.Hold,
+			Next:         snapshot.Next,
+			LastInputSeq: snapshot.LastInputSeq,
+		}
+		c.drawPiece(state.Board, view.currentPiece)
+	}
+
+	return state
+}
+
+// player returns the player's controller, which is the game's own while
+// they are the active player.
+func (c *Coop) player(i int) *controller {
+	if i == c.active {
+		return &c.game.controller
+	}
+	return &c.players[i]
+}
+
+// view returns a copy of the game as the player sees it, like enter but
+// without changing c, so the state can be read alongside other readers. The
+// copy shares the board and must not be changed.
+func (c *Coop) view(player int) *Tetris {
+	view := *c.game
+	view.controller = *c.player(player)
+	view.teammates = nil
+	for i := range c.players {
+		if piece := c.player(i).currentPiece; i != player && piece != nil {
+			view.teammates = append(view.teammates, piece)
+		}
+	}
+	return &view
+}
+
+// drawPiece paints a piece onto a copy of the visible board.
+func (c *Coop) drawPiece(board [][]int, piece *Piece) {
+	if piece == nil {
+		return
+	}
+	buffer := c.game.rules.BufferRows
+	for py, row := range piece.shape {
+		for px, cell := range row {
+			y, x := piece.y+py-buffer, piece.x+px
+			if cell == 1 && y >= 0 && y < len(board) && x >= 0 && x < len(board[y]) {
+				board[y][x] = piece.pieceType + 1
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package tetris
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// DigSettings configures dig mode (a "cheese race"): clear a set number of
+// garbage lines, each with a single hole, fed in from the bottom.
+type DigSettings struct {
+	// Lines is the total number of garbage lines to clear.
+	Lines int `json:"lines"`
+	// Height is how many garbage lines are kept on the board; cleared lines
+	// are replaced from the remaining total straight away.
+	Height int `json:"height"`
+	// Messiness is the chance (0 to 1) that a line's hole is in a different
+	// column from the line below it.
+	Messiness float64 `json:"messiness"`
+	// RiseInterval is the number of frames between extra lines rising on
+	// top of the refills. Zero disables rising.
+	RiseInterval int `json:"rise_interval"`
+	// Seed fixes the hole placement so a run can be repeated. Zero picks a
+	// random seed.
+	Seed int64 `json:"seed"`
+}
+
+func DefaultDigSettings() DigSettings {
+	return DigSettings{
+		Lines:        18,
+		Height:       10,
+		Messiness:    0.3,
+		RiseInterval: 0,
+	}
+}
+
+func (s DigSettings) Validate(rules Rules) error {
+	if s.Lines < 1 || s.Lines > 1000 {
+		return fmt.Errorf("lines must be between 1 and 1000")
+	}
+	if s.Height < 1 || s.Height > rules.Height-4 {
+		return fmt.Errorf("height must be between 1 and %d", rules.Height-4)
+	}
+	if s.Messiness < 0 || s.Messiness > 1 {
+		return fmt.Errorf("messiness must be between 0 and 1")
+	}
+	if s.RiseInterval < 0 || s.RiseInterval > 12000 {
+		return fmt.Errorf("rise_interval must be between 0 and 12000 frames")
+	}
+	return nil
+}
+
+// Dig runs dig mode on a game.
+type Dig struct {
+	settings DigSettings
+	rng      *rand.Rand
+	hole     int
+	// dealt is how many garbage lines have been added so far.
+	dealt     int
+	lastRise  uint64
+	completed time.Duration
+}
+
+// NewDig creates a game in dig mode with its starting garbage in place.
+func NewDig(rules Rules, settings DigSettings) (*Tetris, *Dig, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := settings.Validate(rules); err != nil {
+		return nil, nil, err
+	}
+	if settings.Seed == 0 {
+		settings.Seed = time.Now().UnixNano()
+	}
+
+	rng := rand.New(rand.NewSource(settings.Seed))
+	dig := &Dig{
+		settings: settings,
+		rng:      rng,
+		hole:     rng.Intn(rules.Width),
+	}
+
+	t := newGame(rules)
+	dig.deal(t, min(settings.Height, settings.Lines))
+	return t, dig, nil
+}
+
+// Settings returns the settings in use, including the chosen seed.
+func (d *Dig) Settings() DigSettings {
+	return d.settings
+}
+
+// deal pushes up to n more garbage lines into the board.
+func (d *Dig) deal(t *Tetris, n int) {
+	for i := 0; i < n && d.dealt < d.settings.Lines; i++ {
+		if d.dealt > 0 && d.rng.Float64() < d.settings.Messiness && t.rules.Width > 1 {
+			hole := d.rng.Intn(t.rules.Width - 1)
+			if hole >= d.hole {
+				hole++
+			}
+			d.hole = hole
+		}
+		t.AddGarbage(1, d.hole)
+		d.dealt++
+	}
+}
+
+// Update refills and raises garbage. It runs after each frame of the game.
+func (d *Dig) Update(t *Tetris) {
+	if t.gameOver || d.Complete() {
+		return
+	}
+
+	if d.settings.RiseInterval > 0 && t.frame-d.lastRise >= uint64(d.settings.RiseInterval) {
+		d.lastRise = t.frame
+		d.deal(t, 1)
+	}
+
+	if onBoard := t.GarbageRows(); onBoard < d.settings.Height {
+		d.deal(t, d.settings.Height-onBoard)
+	}
+
+	if d.dealt >= d.settings.Lines && t.GarbageRows() == 0 {
+		d.completed = t.PlayTime()
+	}
+}
+
+// Complete reports whether every garbage line has been cleared.
+func (d *Dig) Complete() bool {
+	return d.completed > 0
+}
+
+// CompletionTime is how long the dig took, or zero if it isn't complete.
+func (d *Dig) CompletionTime() time.Duration {
+	return d.completed
+}
+
+// Remaining is the number of garbage lines still to clear.
+func (d *Dig) Remaining(t *Tetris) int {
+	return d.settings.Lines - d.dealt + t.GarbageRows()
+}
+
+// GarbageRows counts the rows that still contain garbage.
+func (t *Tetris) GarbageRows() int {
+	rows := 0
+	for _, row := range t.board {
+		for _, cell := range row {
+			if cell == GarbageCell {
+				rows++
+				break
+			}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,147 @@
+package tetris
+
+import (
+	"reflect"
+	"testing"
+)
+
+// garbageHoles lists the empty column of each garbage row, bottom up.
+func garbageHoles(t *Tetris) []int {
+	var holes []int
+	for y := len(t.board) - 1; y >= 0; y-- {
+		hole, garbage := -1, false
+		for x, cell := range t.board[y] {
+			switch cell {
+			case GarbageCell:
+				garbage = true
+			case 0:
+				hole = x
+			}
+		}
+		if garbage {
+			holes = append(holes, hole)
+		}
+	}
+	return holes
+}
+
+func newTestDig(t *testing.T, settings DigSettings) (*Tetris, *Dig) {
+	t.Helper()
+	game, dig, err := NewDig(DefaultRules(), settings)
+	if err != nil {
+		t.Fatalf("NewDig returned %v", err)
+	}
+	return game, dig
+}
+
+func TestNewDigSeed(t *testing.T) {
+	settings := DigSettings{Lines: 40, Height: 10, Messiness: 0.5, Seed: 42}
+	game, dig := newTestDig(t, settings)
+	holes := garbageHoles(game)
+
+	again, _ := newTestDig(t, settings)
+	if got := garbageHoles(again); !reflect.DeepEqual(got, holes) {
+		t.Errorf("seed %d gave holes %v then %v", settings.Seed, holes, got)
+	}
+	if !reflect.DeepEqual(again.board, game.board) {
+		t.Error("the same seed gave different boards")
+	}
+	if dig.Settings().Seed != settings.Seed {
+		t.Errorf("Settings().Seed = %d, want %d", dig.Settings().Seed, settings.Seed)
+	}
+
+	other := settings
+	other.Seed = 43
+	otherGame, _ := newTestDig(t, other)
+	if reflect.DeepEqual(garbageHoles(otherGame), holes) {
+		t.Errorf("seeds %d and %d gave the same holes %v", settings.Seed, other.Seed, holes)
+	}
+
+	random := settings
+	random.Seed = 0
+	if _, dig := newTestDig(t, random); dig.Settings().Seed == 0 {
+		t.Error("no seed was chosen for a random dig")
+	}
+}
+
+func TestNewDigGarbage(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings DigSettings
+		rows     int
+		// sameHoles and differentHoles check every pair of neighbouring rows.
+		sameHoles      bool
+		differentHoles bool
+	}{
+		{
+			name:      "clean",
+			settings:  DigSettings{Lines: 18, Height: 10, Messiness: 0, Seed: 7},
+			rows:      10,
+			sameHoles: true,
+		},
+		{
+			name:           "fully messy",
+			settings:       DigSettings{Lines: 18, Height: 10, Messiness: 1, Seed: 7},
+			rows:           10,
+			differentHoles: true,
+		},
+		{
+			name:     "fewer lines than the height",
+			settings: DigSettings{Lines: 4, Height: 10, Messiness: 0.3, Seed: 7},
+			rows:     4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, dig := newTestDig(t, tt.settings)
+			holes := garbageHoles(game)
+
+			if len(holes) != tt.rows {
+				t.Fatalf("%d garbage rows, want %d", len(holes), tt.rows)
+			}
+			if remaining := dig.Remaining(game); remaining != tt.settings.Lines {
+				t.Errorf("Remaining() = %d, want %d", remaining, tt.settings.Lines)
+			}
+			for i, hole := range holes {
+				if hole < 0 {
+					t.Fatalf("garbage row %d has no hole", i)
+				}
+				if i == 0 {
+					continue
+				}
+				if tt.sameHoles && hole != holes[i-1] {
+					t.Errorf("holes moved on a clean dig: %v", holes)
+				}
+				if tt.differentHoles && hole == holes[i-1] {
+					t.Errorf("holes repeated on a fully messy dig: %v", holes)
+				}
+			}
+		})
+	}
+}
+
+func TestDigSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(s *DigSettings)
+		valid bool
+	}{
+		{name: "defaults", edit: func(s *DigSettings) {}, valid: true},
+		{name: "no lines", edit: func(s *DigSettings) { s.Lines = 0 }},
+		{name: "too tall", edit: func(s *DigSettings) { s.Height = BoardHeight }},
+		{name: "negative messiness", edit: func(s *DigSettings) { s.Messiness = -0.1 }},
+		{name: "messiness over one", edit: func(s *DigSettings) { s.Messiness = 1.5 }},
+		{name: "negative rise", edit: func(s *DigSettings) { s.RiseInterval = -1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := DefaultDigSettings()
+			tt.edit(&settings)
+			if err := settings.Validate(DefaultRules()); (err == nil) != tt.valid {
+				t.Errorf("Validate(%+v) = %v, want valid %v", settings, err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package tetris
+
+// PieceNames are the conventional letters of each piece type, by index.
+var PieceNames = []string{"I", "O", "T", "S", "Z", "J", "L"}
+
+// finesseKeys are the inputs that count towards a placement's finesse:
+// moving and rotating the piece. A held direction counts once however far
+// auto shift carries it.
+var finesseKeys = map[string]bool{
+	"left": true, "right": true, "left_down": true, "right_down": true,
+	"rotate": true, "rotateCCW": true, "rotate180": true,
+}
+
+// PieceFinesse is the finesse breakdown for one piece type.
+type PieceFinesse struct {
+	Pieces int `json:"pieces"`
+	Keys   int `json:"keys"`
+	Faults int `json:"faults"`
+}
+
+// FinesseReport summarises how efficiently a game was played. A fault is
+// each input beyond the minimum needed to reach a placement from spawn.
+// Placements that can't be reached from the top of an empty board (tucks
+// and spins) aren't judged.
+type FinesseReport struct {
+	Pieces  int `json:"pieces"`
+	Judged  int `json:"judged"`
+	Perfect int `json:"perfect"`
+	Keys    int `json:"keys"`
+	Faults  int `json:"faults"`
+	// KPP is every key pressed (including drops and hold) per piece placed.
+	KPP float64 `json:"kpp"`
+	// Accuracy is the percentage of judged pieces placed without a fault.
+	Accuracy float64                 `json:"accuracy"`
+	PerPiece map[string]PieceFinesse `json:"perPiece"`
+}
+
+type finesseTracker struct {
+	// pieceKeys are the finesse keys used on the active piece so far.
+	pieceKeys int
+	totalKeys int
+	pieces    int
+	judged    int
+	perfect   int
+	faults    int
+	perPiece  [7]PieceFinesse
+}
+
+// countKey records a key press for finesse and KPP.
+func (t *Tetris) countKey(input string) {
+	if t.paused || t.gameOver || input == "pause" {
+		return
+	}
+	switch input {
+	case "left_up", "right_up", "down_up":
+		return
+	}
+
+	t.finesse.totalKeys++
+	if finesseKeys[input] {
+		t.finesse.pieceKeys++
+	}
+}
+
+// judgeFinesse compares the keys used on the active piece, which is about to
+// lock, with the fewest that reach the same placement.
+func (t *Tetris) judgeFinesse() {
+	piece := t.currentPiece
+	if piece == nil {
+		return
+	}
+
+	keys := t.finesse.pieceKeys
+	t.finesse.pieceKeys = 0
+	t.finesse.pieces++
+
+	breakdown := &t.finesse.perPiece[piece.pieceType]
+	breakdown.Pieces++
+	breakdown.Keys += keys
+
+	minimum, ok := t.minimumInputs(piece.pieceType, piece.shape, piece.x)
+	if !ok {
+		return
+	}
+
+	t.finesse.judged++
+	if keys <= minimum {
+		t.finesse.perfect++
+		return
+	}
+	t.finesse.faults += keys - minimum
+	breakdown.Faults += keys - minimum
+}
+
+// minimumInputs finds the fewest moves and rotations that take a freshly
+// spawned piece to the same cells as the given shape and column on an empty
+// board, using the same rotation and kick rules as play. Taps move one column
+// and a held direction counts as one input that reaches the wall.
+func (t *Tetris) minimumInputs(pieceType int, target [][]int, targetX int) (int, bool) {
+	type state struct{ x, rotation int }
+
+	shapes := make([][][]int, 4)
+	trimmed := make([][][]int, 4)
+	lefts := make([]int, 4)
+	rights := make([]int, 4)
+	shapes[0] = copyShape(pieces[pieceType])
+	for i := range shapes {
+		if i > 0 {
+			shapes[i] = rotateShape(shapes[i-1])
+		}
+		trimmed[i] = trimShape(shapes[i])
+		_, _, lefts[i], rights[i] = shapeBounds(shapes[i])
+	}
+	fits := func(rotation, x int) bool {
+		return x+lefts[rotation] >= 0 && x+rights[rotation] < t.rules.Width
+	}
+
+	_, _, targetLeft, _ := shapeBounds(target)
+	targetShape := trimShape(target)
+	targetColumn := targetX + targetLeft
+
+	startX, _ := t.spawnPosition(shapes[0])
+	start := state{startX, 0}
+	distance := map[state]int{start: 0}
+	queue := []state{start}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if current.x+lefts[current.rotation] == targetColumn && sameShape(trimmed[current.rotation], targetShape) {
+			return distance[current], true
+		}
+
+		var next []state
+		for _, dx := range []int{-1, 1} {
+			if fits(current.rotation, current.x+dx) {
+				next = append(next, state{current.x + dx, current.rotation})
+			}
+			x := current.x
+			for fits(current.rotation, x+dx) {
+				x += dx
+			}
+			next = append(next, state{x, current.rotation})
+		}
+		for _, turns := range []int{1, 2, 3} {
+			rotation := (current.rotation + turns) % 4
+			for _, offset := range kicks(pieceType, current.rotation, rotation) {
+				if fits(rotation, current.x+offset[0]) {
+					next = append(next, state{current.x + offset[0], rotation})
+					break
+				}
+			}
+		}
+
+		for _, candidate := range next {
+			if _, seen := distance[candidate]; !seen {
+				distance[candidate] = distance[current] + 1
+				queue = append(queue, candidate)
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func sameShape(a, b [][]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for y := range a {
+		if len(a[y]) != len(b[y]) {
+			return false
+		}
+		for x := range a[y] {
+			if a[y][x] != b[y][x] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Finesse returns the finesse report for the game so far.
+func (t *Tetris) Finesse() FinesseReport {
+	report := FinesseReport{
+		Pieces:   t.finesse.pieces,
+		Judged:   t.finesse.judged,
+		Perfect:  t.finesse.perfect,
+		Keys:     t.finesse.totalKeys,
+		Faults:   t.finesse.faults,
+		PerPiece: make(map[string]PieceFinesse),
+	}
+	if report.Pieces > 0 {
+		report.KPP = float64(report.Keys) / float64(report.Pieces)
+	}
+	if report.Judged > 0 {
+		report.Accuracy = float64(report.Perfect) * 100 / float64(report.Judged)
+	}
+	for pieceType, breakdown := range t.finesse.perPiece {
+		if breakdown.Pieces > 0 {
+			report.PerPiece[PieceNames[pieceType]] = breakdown
+		}
+	}
+	return report
+}
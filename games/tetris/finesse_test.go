@@ -0,0 +1,51 @@
+package tetris
+
+import "testing"
+
+func TestMinimumInputs(t *testing.T) {
+	const (
+		pieceS = 3
+		// T and I pieces spawn at column 3, O at column 4.
+		spawnX = 3
+	)
+
+	tests := []struct {
+		name      string
+		pieceType int
+		rotation  int
+		// shape replaces the piece's own shape when set.
+		shape     [][]int
+		x         int
+		inputs    int
+		reachable bool
+	}{
+		{name: "T at spawn", pieceType: pieceT, rotation: 0, x: spawnX, inputs: 0, reachable: true},
+		{name: "T one tap left", pieceType: pieceT, rotation: 0, x: spawnX - 1, inputs: 1, reachable: true},
+		{name: "T held to the left wall", pieceType: pieceT, rotation: 0, x: 0, inputs: 1, reachable: true},
+		{name: "T held to the right wall", pieceType: pieceT, rotation: 0, x: BoardWidth - 3, inputs: 1, reachable: true},
+		{name: "T held to the wall and tapped back", pieceType: pieceT, rotation: 0, x: 1, inputs: 2, reachable: true},
+		{name: "T rotated clockwise", pieceType: pieceT, rotation: 1, x: spawnX, inputs: 1, reachable: true},
+		{name: "T flipped", pieceType: pieceT, rotation: 2, x: spawnX, inputs: 1, reachable: true},
+		{name: "T rotated counter-clockwise", pieceType: pieceT, rotation: 3, x: spawnX, inputs: 1, reachable: true},
+		{name: "T rotated against the left wall", pieceType: pieceT, rotation: 1, x: -1, inputs: 2, reachable: true},
+		{name: "O held to the right wall", pieceType: pieceO, rotation: 0, x: BoardWidth - 2, inputs: 1, reachable: true},
+		{name: "I upright against the left wall", pieceType: pieceI, rotation: 1, x: -2, inputs: 2, reachable: true},
+		{name: "S flipped matches its spawn placement", pieceType: pieceS, rotation: 2, x: spawnX, inputs: 0, reachable: true},
+		{name: "shape the piece can't take", pieceType: pieceT, shape: [][]int{{1, 1, 1, 1, 1}}, x: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.shape
+			if target == nil {
+				target = pieceAt(tt.pieceType, tt.rotation, tt.x, 0).shape
+			}
+
+			game := NewTetris()
+			inputs, reachable := game.minimumInputs(tt.pieceType, target, tt.x)
+			if inputs != tt.inputs || reachable != tt.reachable {
+				t.Errorf("minimumInputs = %d, %v; want %d, %v", inputs, reachable, tt.inputs, tt.reachable)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package tetris
+
+import "fmt"
+
+// Handling is a player's key repeat configuration, in engine frames. The
+// server applies it in Update so horizontal speed doesn't depend on the
+// client's key repeat or on network jitter.
+type Handling struct {
+	// DAS (delayed auto shift) is how long a direction must be held before
+	// it starts repeating.
+	DAS int `json:"das"`
+	// ARR (auto repeat rate) is the number of frames between repeated moves
+	// once DAS has charged. Zero moves the piece straight to the wall.
+	ARR int `json:"arr"`
+	// SDF (soft drop factor) multiplies gravity while soft drop is held.
+	// Zero drops the piece to the floor instantly.
+	SDF int `json:"sdf"`
+}
+
+func DefaultHandling() Handling {
+	return Handling{DAS: 3, ARR: 1, SDF: 20}
+}
+
+func (h Handling) Validate() error {
+	if h.DAS < 0 || h.DAS > 20 {
+		return fmt.Errorf("das must be between 0 and 20 frames")
+	}
+	if h.ARR < 0 || h.ARR > 10 {
+		return fmt.Errorf("arr must be between 0 and 10 frames")
+	}
+	if h.SDF < 0 || h.SDF > 100 {
+		return fmt.Errorf("sdf must be between 0 and 100")
+	}
+	return nil
+}
+
+// heldKeys tracks the press/release inputs. When both directions are held
+// the most recently pressed one wins.
+type heldKeys struct {
+	left, right bool
+	direction   int
+	dasCounter  int
+	arrCounter  int
+
+	softDrop        bool
+	softDropCounter int
+}
+
+// SetHandling changes the player's handling. Invalid settings are ignored.
+func (t *Tetris) SetHandling(h Handling) bool {
+	if err := h.Validate(); err != nil {
+		return false
+	}
+	t.handling = h
+	return true
+}
+
+func (t *Tetris) Handling() Handling {
+	return t.handling
+}
+
+// pressDirection starts holding left (-1) or right (1): the piece moves once
+// straight away and DAS starts charging.
+func (t *Tetris) pressDirection(direction int) {
+	if direction < 0 {
+		t.held.left = true
+	} else {
+		t.held.right = true
+	}
+	t.held.direction = direction
+	t.held.dasCounter = 0
+	t.held.arrCounter = 0
+	t.movePiece(direction, 0)
+}
+
+// releaseDirection stops holding a direction, falling back to the other one
+// if it is still held.
+func (t *Tetris) releaseDirection(direction int) {
+	if direction < 0 {
+		t.held.left = false
+	} else {
+		t.held.right = false
+	}
+	if t.held.direction != direction {
+		return
+	}
+
+	t.held.direction = 0
+	if t.held.left {
+		t.held.direction = -1
+	} else if t.held.right {
+		t.held.direction = 1
+	}
+	t.held.dasCounter = 0
+	t.held.arrCounter = 0
+}
+
+func (t *Tetris) pressSoftDrop() {
+	t.held.softDrop = true
+	t.held.softDropCounter = 0
+	t.softDropStep()
+}
+
+func (t *Tetris) releaseSoftDrop() {
+	t.held.softDrop = false
+}
+
+// applyHeldKeys runs auto shift and soft drop for one frame.
+func (t *Tetris) applyHeldKeys() {
+	if t.currentPiece == nil {
+		return
+	}
+
+	if t.held.direction != 0 {
+		if t.held.dasCounter < t.handling.DAS {
+			t.held.dasCounter++
+		}
+		if t.held.dasCounter >= t.handling.DAS {
+			if t.handling.ARR == 0 {
+				for t.movePiece(t.held.direction, 0) {
+				}
+			} else {
+				t.held.arrCounter++
+				if t.held.arrCounter >= t.handling.ARR {
+					t.held.arrCounter = 0
+					t.movePiece(t.held.direction, 0)
+				}
+			}
+		}
+	}
+
+	if t.held.softDrop {
+		t.softDropStep()
+	}
+}
+
+// softDropStep moves the piece down at SDF times the current gravity.
+func (t *Tetris) softDropStep() {
+	if t.handling.SDF == 0 {
+		for t.movePiece(0, 1) {
+		}
+		return
+	}
+
+	t.held.softDropCounter += t.handling.SDF
+	for t.held.softDropCounter >= t.dropSpeed {
+		t.held.softDropCounter -= t.dropSpeed
+		if !t.movePiece(0, 1) {
+			t.held.softDropCounter = 0
+			return
+		}
+		t.dropCounter = 0
+	}
+}
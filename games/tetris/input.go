@@ -0,0 +1,87 @@
+package tetris
+
+import "sort"
+
+// maxInputLead is how many frames ahead of the server a client may schedule
+// an input. Anything further out is clamped so a client with a fast clock
+// can't queue moves indefinitely.
+const maxInputLead = 20
+
+// Input is a sequenced input from a client that predicts locally. Seq
+// increases by at least one per input and Frame is the engine frame the
+// client was showing when the input was made.
+type Input struct {
+	Seq    uint32 `json:"seq"`
+	Frame  uint64 `json:"frame"`
+	Action string `json:"action"`
+}
+
+// QueueInput schedules a sequenced input. Inputs for the current frame or
+// earlier (i.e. ones that arrived late) are applied immediately; inputs for
+// a future frame are applied by Update when that frame is reached. Duplicate
+// and out-of-order inputs (Seq not above the last one accepted) are rejected,
+// and an input is never scheduled before one with a lower Seq, so inputs are
+// always applied in sequence order.
+func (t *Tetris) QueueInput(in Input) bool {
+	if in.Seq == 0 || !IsValidInput(in.Action) {
+		return false
+	}
+	if in.Seq <= t.lastQueuedSeq {
+		return false
+	}
+	t.lastQueuedSeq = in.Seq
+
+	if in.Frame > t.frame+maxInputLead {
+		in.Frame = t.frame + maxInputLead
+	}
+	if in.Frame < t.lastQueuedFrame {
+		in.Frame = t.lastQueuedFrame
+	}
+	t.lastQueuedFrame = in.Frame
+
+	if in.Frame <= t.frame && len(t.pendingInputs) == 0 {
+		t.applyInput(in)
+		return true
+	}
+
+	t.pendingInputs = append(t.pendingInputs, in)
+	sort.SliceStable(t.pendingInputs, func(i, j int) bool {
+		if t.pendingInputs[i].Frame != t.pendingInputs[j].Frame {
+			return t.pendingInputs[i].Frame < t.pendingInputs[j].Frame
+		}
+		return t.pendingInputs[i].Seq < t.pendingInputs[j].Seq
+	})
+	t.applyDueInputs()
+	return true
+}
+
+// applyDueInputs runs every queued input whose frame has been reached.
+func (t *Tetris) applyDueInputs() {
+	applied := 0
+	for _, in := range t.pendingInputs {
+		if in.Frame > t.frame {
+			break
+		}
+		t.applyInput(in)
+		applied++
+	}
+	t.pendingInputs = t.pendingInputs[applied:]
+}
+
+func (t *Tetris) applyInput(in Input) {
+	t.HandleWebInput(in.Action)
+	if in.Seq > t.lastInputSeq {
+		t.lastInputSeq = in.Seq
+	}
+}
+
+// Frame returns the number of frames the game has been updated for.
+func (t *Tetris) Frame() uint64 {
+	return t.frame
+}
+
+// LastInputSeq returns the sequence number of the last input applied, which
+// clients use to discard predictions the server has caught up with.
+func (t *Tetris) LastInputSeq() uint32 {
+	return t.lastInputSeq
+}
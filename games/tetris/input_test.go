@@ -0,0 +1,116 @@
+package tetris
+
+import "testing"
+
+func TestQueueInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []Input
+		queued  []bool
+		updates int
+		// moved is how far the piece should have moved sideways and lastSeq
+		// the input the game should report as last applied.
+		moved   int
+		lastSeq uint32
+		pending int
+	}{
+		{
+			name:    "applied straight away",
+			inputs:  []Input{{Seq: 1, Frame: 0, Action: "left"}},
+			queued:  []bool{true},
+			moved:   -1,
+			lastSeq: 1,
+		},
+		{
+			name:   "zero seq rejected",
+			inputs: []Input{{Seq: 0, Frame: 0, Action: "left"}},
+			queued: []bool{false},
+		},
+		{
+			name:   "invalid action rejected",
+			inputs: []Input{{Seq: 1, Frame: 0, Action: "teleport"}},
+			queued: []bool{false},
+		},
+		{
+			name: "duplicate and older seqs rejected",
+			inputs: []Input{
+				{Seq: 2, Frame: 0, Action: "left"},
+				{Seq: 2, Frame: 0, Action: "left"},
+				{Seq: 1, Frame: 0, Action: "left"},
+			},
+			queued:  []bool{true, false, false},
+			moved:   -1,
+			lastSeq: 2,
+		},
+		{
+			name:    "future input waits for its frame",
+			inputs:  []Input{{Seq: 1, Frame: 3, Action: "right"}},
+			queued:  []bool{true},
+			updates: 2,
+			pending: 1,
+		},
+		{
+			name:    "future input applied on its frame",
+			inputs:  []Input{{Seq: 1, Frame: 3, Action: "right"}},
+			queued:  []bool{true},
+			updates: 3,
+			moved:   1,
+			lastSeq: 1,
+		},
+		{
+			name: "later seq with earlier frame waits for the earlier seq",
+			inputs: []Input{
+				{Seq: 1, Frame: 5, Action: "left"},
+				{Seq: 2, Frame: 2, Action: "left"},
+			},
+			queued:  []bool{true, true},
+			updates: 3,
+			pending: 2,
+		},
+		{
+			name: "later seq with earlier frame applied in seq order",
+			inputs: []Input{
+				{Seq: 1, Frame: 5, Action: "left"},
+				{Seq: 2, Frame: 2, Action: "left"},
+			},
+			queued:  []bool{true, true},
+			updates: 5,
+			moved:   -2,
+			lastSeq: 2,
+		},
+		{
+			name:    "far future input clamped",
+			inputs:  []Input{{Seq: 1, Frame: 1000, Action: "right"}},
+			queued:  []bool{true},
+			updates: maxInputLead,
+			moved:   1,
+			lastSeq: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := NewTetris()
+			startX := game.currentPiece.x
+
+			for i, in := range tt.inputs {
+				if queued := game.QueueInput(in); queued != tt.queued[i] {
+					t.Errorf("QueueInput(%+v) = %v, want %v", in, queued, tt.queued[i])
+				}
+			}
+			for i := 0; i < tt.updates; i++ {
+				game.Update()
+			}
+
+			if moved := game.currentPiece.x - startX; moved != tt.moved {
+				t.Errorf("piece moved %d, want %d", moved, tt.moved)
+			}
+			if seq := game.LastInputSeq(); seq != tt.lastSeq {
+				t.Errorf("LastInputSeq() = %d, want %d", seq, tt.lastSeq)
+			}
+			if len(game.pendingInputs) != tt.pending {
+				t.Errorf("%d inputs pending, want %d", len(game.pendingInputs), tt.pending)
+			}
+		})
+	}
+}
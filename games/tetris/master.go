@@ -0,0 +1,239 @@
+package tetris
+
+import "time"
+
+// Master mode follows the arcade TGM rules: the level counts from 0 to 999,
+// rising by one for each piece and by the number of lines cleared, but a
+// piece can't take it past the last level of a section (x99, and 998) so
+// only a line clear finishes a section. Gravity is measured in 1/256 rows
+// per frame and reaches 20G, where pieces fall to the floor at once.
+//
+// TGM runs at 60 frames a second and the engine at 20, so the arcade's
+// gravity values are tripled and its delays divided by three.
+
+const (
+	// MasterCompleted is the TopOut reason when level 999 is reached.
+	MasterCompleted = "completed"
+
+	masterMaxLevel = 999
+	// gravity20G moves a piece the height of the field every frame.
+	gravity20G = 20 * 256
+
+	masterARE            = 10
+	masterLineClearDelay = 14
+	masterLockDelay      = 10
+)
+
+// masterGravity lists [level, gravity] steps: gravity applies from that
+// level until the next step.
+var masterGravity = [][2]int{
+	{0, 4}, {30, 6}, {35, 8}, {40, 10}, {50, 12}, {60, 16}, {70, 32},
+	{80, 48}, {90, 64}, {100, 80}, {120, 96}, {140, 112}, {160, 128},
+	{170, 144}, {200, 4}, {220, 32}, {230, 64}, {233, 96}, {236, 128},
+	{239, 160}, {243, 192}, {247, 224}, {251, 256}, {300, 512}, {330, 768},
+	{360, 1024}, {400, 1280}, {420, 1024}, {450, 768}, {500, gravity20G},
+}
+
+// masterGrades are the score needed for each grade, lowest first.
+var masterGrades = []struct {
+	score int
+	grade string
+}{
+	{0, "9"}, {400, "8"}, {800, "7"}, {1400, "6"}, {2000, "5"},
+	{3500, "4"}, {5500, "3"}, {8000, "2"}, {12000, "1"},
+	{16000, "S1"}, {22000, "S2"}, {30000, "S3"}, {40000, "S4"},
+	{52000, "S5"}, {66000, "S6"}, {82000, "S7"}, {100000, "S8"},
+	{120000, "S9"},
+}
+
+// gmCheckpoints are the score and time needed on reaching each level to stay
+// eligible for the GM grade.
+var gmCheckpoints = []struct {
+	level int
+	score int
+	time  time.Duration
+}{
+	{300, 12000, 4*time.Minute + 15*time.Second},
+	{500, 40000, 7*time.Minute + 30*time.Second},
+	{999, 126000, 13*time.Minute + 30*time.Second},
+}
+
+// MasterState is the Master mode part of GameState.
+type MasterState struct {
+	Level   int    `json:"level"`
+	Section int    `json:"section"`
+	Grade   string `json:"grade"`
+	// Gravity is in 1/256 rows per frame; 5120 is 20G.
+	Gravity int `json:"gravity"`
+	// Delay is the number of frames left before the next piece appears,
+	// covering ARE and line clear delay.
+	Delay int `json:"delay"`
+	// SectionTimes are the play times, in seconds, at which each completed
+	// section of 100 levels was finished.
+	SectionTimes []float64 `json:"sectionTimes"`
+	GMEligible   bool      `json:"gmEligible"`
+}
+
+type masterState struct {
+	level        int
+	gravityAccum int
+	delay        int
+	combo        int
+	grade        string
+	gmEligible   bool
+	checkpoint   int
+	sectionTimes []float64
+}
+
+// NewMaster creates a game in Master mode.
+func NewMaster() *Tetris {
+	rules := DefaultRules()
+	rules.HoldEnabled = false
+	rules.LockDelay = masterLockDelay
+
+	t := newGame(rules)
+	t.master = &masterState{
+		combo:      1,
+		grade:      masterGrades[0].grade,
+		gmEligible: true,
+	}
+	t.level = 0
+	return t
+}
+
+func masterGravityAt(level int) int {
+	gravity := masterGravity[0][1]
+	for _, step := range masterGravity {
+		if level < step[0] {
+			break
+		}
+		gravity = step[1]
+	}
+	return gravity
+}
+
+// updateMaster runs one frame of Master mode after inputs and auto shift.
+func (t *Tetris) updateMaster() {
+	m := t.master
+
+	if t.currentPiece == nil {
+		if m.delay > 0 {
+			m.delay--
+			if m.delay > 0 {
+				return
+			}
+		}
+		t.spawnPiece()
+		if t.gameOver {
+			return
+		}
+	}
+
+	m.gravityAccum += masterGravityAt(m.level) * 3
+	for m.gravityAccum >= 256 {
+		m.gravityAccum -= 256
+		if !t.movePiece(0, 1) {
+			m.gravityAccum = 0
+			break
+		}
+	}
+
+	if t.isGrounded() {
+		t.lockCounter++
+		if t.lockCounter >= t.rules.LockDelay {
+			t.lockPiece()
+		}
+	} else {
+		t.lockCounter = 0
+	}
+}
+
+// advanceMasterLevel adds to the level. Pieces stop at the end of a section;
+// line clears don't.
+func (t *Tetris) advanceMasterLevel(amount int, byLines bool) {
+	m := t.master
+	previous := m.level
+
+	level := m.level + amount
+	if !byLines {
+		sectionEnd := (m.level/100)*100 + 99
+		if m.level == sectionEnd || m.level >= masterMaxLevel-1 {
+			return
+		}
+		level = min(level, sectionEnd, masterMaxLevel-1)
+	}
+	m.level = min(level, masterMaxLevel)
+	t.level = m.level
+
+	for section := previous/100 + 1; section <= m.level/100; section++ {
+		m.sectionTimes = append(m.sectionTimes, t.PlayTime().Seconds())
+	}
+
+	for m.checkpoint < len(gmCheckpoints) && m.level >= gmCheckpoints[m.checkpoint].level {
+		checkpoint := gmCheckpoints[m.checkpoint]
+		if t.score < checkpoint.score || t.PlayTime() > checkpoint.time {
+			m.gmEligible = false
+		}
+		m.checkpoint++
+	}
+
+	if m.level >= masterMaxLevel {
+		if m.gmEligible {
+			m.grade = "GM"
+		}
+		t.topOut(MasterCompleted)
+	}
+}
+
+// masterPieceSpawned raises the level as each piece after the first enters.
+func (t *Tetris) masterPieceSpawned() {
+	t.advanceMasterLevel(1, false)
+}
+
+// masterPieceLocked scores a lock and starts the delay before the next
+// piece. As in TGM a clear scores ceil((level + lines) / 4) * lines * combo,
+// and four times that for a perfect clear. Soft drop bonuses aren't counted.
+func (t *Tetris) masterPieceLocked(lines int, perfectClear bool) {
+	m := t.master
+
+	if lines == 0 {
+		m.combo = 1
+		m.delay = masterARE
+		return
+	}
+
+	m.combo += 2*lines - 2
+	points := (m.level + lines + 3) / 4 * lines * m.combo
+	if perfectClear {
+		points *= 4
+	}
+	t.score += points
+
+	for _, grade := range masterGrades {
+		if t.score >= grade.score && m.grade != "GM" {
+			m.grade = grade.grade
+		}
+	}
+
+	m.delay = masterARE + masterLineClearDelay
+	t.advanceMasterLevel(lines, true)
+}
+
+func (t *Tetris) masterState() *MasterState {
+	m := t.master
+	if m == nil {
+		return nil
+	}
+	sectionTimes := make([]float64, len(m.sectionTimes))
+	copy(sectionTimes, m.sectionTimes)
+
+	return &MasterState{
+		Level:        m.level,
+		Section:      m.level / 100,
+		Grade:        m.grade,
+		Gravity:      masterGravityAt(m.level),
+		Delay:        m.delay,
+		SectionTimes: sectionTimes,
+		GMEligible:   m.gmEligible,
+	}
+}
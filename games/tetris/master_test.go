@@ -0,0 +1,74 @@
+package tetris
+
+import "testing"
+
+func TestAdvanceMasterLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   int
+		amount  int
+		byLines bool
+		want    int
+		// sections is how many section times should have been recorded.
+		sections  int
+		completed bool
+	}{
+		{name: "piece", level: 10, amount: 1, want: 11},
+		{name: "lines", level: 10, amount: 4, byLines: true, want: 14},
+		{name: "piece stops at the section end", level: 98, amount: 1, want: 99},
+		{name: "piece held at the section end", level: 99, amount: 1, want: 99},
+		{name: "lines finish a section", level: 99, amount: 1, byLines: true, want: 100, sections: 1},
+		{name: "lines cross a section", level: 97, amount: 4, byLines: true, want: 101, sections: 1},
+		{name: "piece held at 998", level: 998, amount: 1, want: 998},
+		{name: "lines complete the game", level: 997, amount: 3, byLines: true, want: 999, completed: true},
+		{name: "lines capped at 999", level: 998, amount: 4, byLines: true, want: 999, completed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := NewMaster()
+			game.master.level = tt.level
+			game.level = tt.level
+			// Keep earlier checkpoints from being judged on the way.
+			for game.master.checkpoint < len(gmCheckpoints) && tt.level >= gmCheckpoints[game.master.checkpoint].level {
+				game.master.checkpoint++
+			}
+
+			game.advanceMasterLevel(tt.amount, tt.byLines)
+
+			if game.master.level != tt.want || game.level != tt.want {
+				t.Errorf("level = %d (game %d), want %d", game.master.level, game.level, tt.want)
+			}
+			if len(game.master.sectionTimes) != tt.sections {
+				t.Errorf("%d section times, want %d", len(game.master.sectionTimes), tt.sections)
+			}
+			if completed := game.TopOutReason() == MasterCompleted; completed != tt.completed {
+				t.Errorf("completed = %v, want %v", completed, tt.completed)
+			}
+		})
+	}
+}
+
+func TestMasterGravityAt(t *testing.T) {
+	tests := []struct {
+		level   int
+		gravity int
+	}{
+		{0, 4},
+		{29, 4},
+		{30, 6},
+		{199, 144},
+		{200, 4},
+		{251, 256},
+		{420, 1024},
+		{499, 768},
+		{500, gravity20G},
+		{999, gravity20G},
+	}
+
+	for _, tt := range tests {
+		if gravity := masterGravityAt(tt.level); gravity != tt.gravity {
+			t.Errorf("masterGravityAt(%d) = %d, want %d", tt.level, gravity, tt.gravity)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package tetris
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Puzzle goal types.
+const (
+	GoalLines        = "lines"
+	GoalTSpin        = "tspin"
+	GoalPerfectClear = "perfect_clear"
+)
+
+// Puzzle states returned by Puzzle.Status.
+const (
+	PuzzlePlaying = "playing"
+	PuzzleSolved  = "solved"
+	PuzzleFailed  = "failed"
+)
+
+// PuzzleGoal is what the player has to achieve. Lines is the number of lines
+// to clear in total for GoalLines, or the minimum lines cleared by a single
+// T-spin for GoalTSpin.
+type PuzzleGoal struct {
+	Type  string `json:"type"`
+	Lines int    `json:"lines,omitempty"`
+}
+
+// Puzzle is a training position. Board rows are written top to bottom and
+// sit at the bottom of the field; '.' is empty, a piece letter is a cell of
+// that colour and 'G' is garbage. Queue and Hold are piece letters.
+type Puzzle struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Category    string     `json:"category"`
+	Board       []string   `json:"board"`
+	Queue       string     `json:"queue"`
+	Hold        string     `json:"hold,omitempty"`
+	Goal        PuzzleGoal `json:"goal"`
+	// MaxPieces limits how many pieces may be placed; by default the whole
+	// queue may be used.
+	MaxPieces int `json:"max_pieces,omitempty"`
+}
+
+//go:embed puzzles/*.json
+var puzzleFiles embed.FS
+
+var puzzles = loadBuiltinPuzzles()
+
+// loadBuiltinPuzzles loads the embedded puzzles, logging and leaving out any
+// that are broken rather than failing at startup.
+func loadBuiltinPuzzles() map[string]Puzzle {
+	loaded, errs := loadPuzzles(puzzleFiles, "puzzles")
+	for _, err := range errs {
+		log.Printf("Skipping puzzle: %v", err)
+	}
+	return loaded
+}
+
+// loadPuzzles parses every puzzle file in dir. Files that can't be read or
+// parsed, or that reuse an ID, are left out and reported in errs.
+func loadPuzzles(fsys fs.FS, dir string) (loaded map[string]Puzzle, errs []error) {
+	loaded = make(map[string]Puzzle)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return loaded, []error{fmt.Errorf("failed to read puzzles: %w", err)}
+	}
+
+	for _, entry := range entries {
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read puzzle %s: %w", entry.Name(), err))
+			continue
+		}
+		puzzle, err := ParsePuzzle(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+			continue
+		}
+		if _, exists := loaded[puzzle.ID]; exists {
+			errs = append(errs, fmt.Errorf("%s: duplicate puzzle id %q", entry.Name(), puzzle.ID))
+			continue
+		}
+		loaded[puzzle.ID] = puzzle
+	}
+	return loaded, errs
+}
+
+// ParsePuzzle reads a puzzle definition and checks that it can be set up.
+func ParsePuzzle(data []byte) (Puzzle, error) {
+	var puzzle Puzzle
+	if err := json.Unmarshal(data, &puzzle); err != nil {
+		return Puzzle{}, fmt.Errorf("invalid puzzle: %w", err)
+	}
+	if puzzle.ID == "" {
+		return Puzzle{}, fmt.Errorf("puzzle id is required")
+	}
+	switch puzzle.Goal.Type {
+	case GoalLines, GoalTSpin:
+		if puzzle.Goal.Lines < 1 || puzzle.Goal.Lines > 4 {
+			return Puzzle{}, fmt.Errorf("goal lines must be between 1 and 4")
+		}
+	case GoalPerfectClear:
+	default:
+		return Puzzle{}, fmt.Errorf("unknown goal type %q", puzzle.Goal.Type)
+	}
+	if _, err := puzzle.Setup(); err != nil {
+		return Puzzle{}, err
+	}
+	return puzzle, nil
+}
+
+// Puzzles returns every built-in puzzle ordered by ID.
+func Puzzles() []Puzzle {
+	list := make([]Puzzle, 0, len(puzzles))
+	for _, puzzle := range puzzles {
+		list = append(list, puzzle)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func FindPuzzle(id string) (Puzzle, bool) {
+	puzzle, ok := puzzles[id]
+	return puzzle, ok
+}
+
+func pieceFromLetter(letter rune) (int, bool) {
+	for pieceType, name := range PieceNames {
+		if string(letter) == name {
+			return pieceType, true
+		}
+	}
+	return 0, false
+}
+
+// Setup converts the puzzle into an engine setup.
+func (p Puzzle) Setup() (Setup, error) {
+	setup := Setup{Hold: -1}
+
+	for i, line := range p.Board {
+		row := make([]int, 0, len(line))
+		for _, letter := range strings.ToUpper(line) {
+			switch letter {
+			case '.':
+				row = append(row, 0)
+			case 'G':
+				row = append(row, GarbageCell)
+			default:
+				pieceType, ok := pieceFromLetter(letter)
+				if !ok {
+					return Setup{}, fmt.Errorf("unknown cell %q in board row %d", letter, i)
+				}
+				row = append(row, pieceType+1)
+			}
+		}
+		setup.Board = append(setup.Board, row)
+	}
+
+	for _, letter := range strings.ToUpper(p.Queue) {
+		pieceType, ok := pieceFromLetter(letter)
+		if !ok {
+			return Setup{}, fmt.Errorf("unknown piece %q in queue", letter)
+		}
+		setup.Queue = append(setup.Queue, pieceType)
+	}
+
+	if p.Hold != "" {
+		pieceType, ok := pieceFromLetter([]rune(strings.ToUpper(p.Hold))[0])
+		if !ok {
+			return Setup{}, fmt.Errorf("unknown hold piece %q", p.Hold)
+		}
+		setup.Hold = pieceType
+	}
+
+	if _, err := NewWithSetup(p.Rules(), setup); err != nil {
+		return Setup{}, err
+	}
+	return setup, nil
+}
+
+// Rules are the rules puzzles are played with: the default game with enough
+// previews to see the whole queue.
+func (p Puzzle) Rules() Rules {
+	rules := DefaultRules()
+	rules.NextPreviews = min(len(p.Queue), maxQueueLength)
+	return rules
+}
+
+// NewGame starts a game at the puzzle's position.
+func (p Puzzle) NewGame() (*Tetris, error) {
+	setup, err := p.Setup()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithSetup(p.Rules(), setup)
+}
+
+// Status reports whether the game has solved the puzzle, failed it, or is
+// still going.
+func (p Puzzle) Status(t *Tetris) string {
+	solved := false
+	switch p.Goal.Type {
+	case GoalLines:
+		solved = t.lines >= p.Goal.Lines
+	case GoalTSpin:
+		for lines := p.Goal.Lines; lines < len(t.clearStats.TSpins); lines++ {
+			if t.clearStats.TSpins[lines] > 0 {
+				solved = true
+			}
+		}
+	case GoalPerfectClear:
+		solved = t.clearStats.PerfectClears > 0
+	}
+
+	switch {
+	case solved:
+		return PuzzleSolved
+	case t.gameOver:
+		return PuzzleFailed
+	case p.MaxPieces > 0 && t.piecesPlaced >= p.MaxPieces:
+		return PuzzleFailed
+	default:
+		return PuzzlePlaying
+	}
+}
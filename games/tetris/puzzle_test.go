@@ -0,0 +1,92 @@
+package tetris
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestBuiltinPuzzles(t *testing.T) {
+	entries, err := puzzleFiles.ReadDir("puzzles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, errs := loadPuzzles(puzzleFiles, "puzzles")
+	for _, err := range errs {
+		t.Error(err)
+	}
+	if len(loaded) != len(entries) {
+		t.Errorf("loaded %d puzzles from %d files", len(loaded), len(entries))
+	}
+}
+
+func TestLoadPuzzles(t *testing.T) {
+	const well = `{
+		"id": "well",
+		"board": ["LLLGGGGLL."],
+		"queue": "I",
+		"goal": {"type": "lines", "lines": 1}
+	}`
+
+	tests := []struct {
+		name   string
+		files  map[string]string
+		ids    []string
+		errors int
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"well.json": well},
+			ids:   []string{"well"},
+		},
+		{
+			name: "bad JSON skipped",
+			files: map[string]string{
+				"well.json":   well,
+				"broken.json": `{"id": `,
+			},
+			ids:    []string{"well"},
+			errors: 1,
+		},
+		{
+			name: "bad goal skipped",
+			files: map[string]string{
+				"well.json":  well,
+				"score.json": `{"id": "score", "board": [], "queue": "T", "goal": {"type": "score"}}`,
+			},
+			ids:    []string{"well"},
+			errors: 1,
+		},
+		{
+			name: "duplicate id skipped",
+			files: map[string]string{
+				"a.json": well,
+				"b.json": well,
+			},
+			ids:    []string{"well"},
+			errors: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, data := range tt.files {
+				fsys["puzzles/"+name] = &fstest.MapFile{Data: []byte(data)}
+			}
+
+			loaded, errs := loadPuzzles(fsys, "puzzles")
+			if len(errs) != tt.errors {
+				t.Errorf("got %d errors %v, want %d", len(errs), errs, tt.errors)
+			}
+			if len(loaded) != len(tt.ids) {
+				t.Errorf("loaded %d puzzles, want %d", len(loaded), len(tt.ids))
+			}
+			for _, id := range tt.ids {
+				if _, ok := loaded[id]; !ok {
+					t.Errorf("puzzle %q not loaded", id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package tetris
+
+// maxQueueLength bounds how many pieces are generated ahead, which is also
+// the largest preview count Rules.Validate accepts.
+const maxQueueLength = 6
+
+// Randomizer picks the type of each piece added to the queue.
+type Randomizer interface {
+	Next() int
+}
+
+// uniformRandomizer picks every piece independently, so repeats and droughts
+// are possible.
+type uniformRandomizer struct{}
+
+func (uniformRandomizer) Next() int {
+	return secureRandIntn(len(pieces))
+}
+
+// fillQueue tops the queue up so that it always holds one more piece than
+// the largest preview count, whatever the current setting is.
+func (t *Tetris) fillQueue() {
+	if t.fixedQueue {
+		return
+	}
+	for len(t.nextPieces) < maxQueueLength+1 {
+		pieceType := t.randomizer.Next()
+		t.nextPieces = append(t.nextPieces, &Piece{
+			shape:     copyShape(pieces[pieceType]),
+			x:         0,
+			y:         0,
+			rotation:  0,
+			pieceType: pieceType,
+		})
+	}
+}
+
+// popQueue takes the next piece, or returns nil when a fixed queue has run
+// out.
+func (t *Tetris) popQueue() *Piece {
+	t.fillQueue()
+	if len(t.nextPieces) == 0 {
+		return nil
+	}
+	piece := t.nextPieces[0]
+	t.nextPieces = t.nextPieces[1:]
+	t.fillQueue()
+	return piece
+}
+
+// previews returns the upcoming pieces the rules allow players to see.
+func (t *Tetris) previews() []*Piece {
+	if t.rules.NextPreviews < len(t.nextPieces) {
+		return t.nextPieces[:t.rules.NextPreviews]
+	}
+	return t.nextPieces
+}
+
+// NextQueue returns the types of the visible upcoming pieces, soonest first.
+func (t *Tetris) NextQueue() []int {
+	previews := t.previews()
+	queue := make([]int, len(previews))
+	for i, piece := range previews {
+		queue[i] = piece.pieceType
+	}
+	return queue
+}
+
+// SetNextPreviews changes how many upcoming pieces are shown. The queue is
+// always generated to the maximum length, so this never changes which pieces
+// come next.
+func (t *Tetris) SetNextPreviews(count int) {
+	if count >= 0 && count <= maxQueueLength {
+		t.rules.NextPreviews = count
+	}
+}
@@ -0,0 +1,117 @@
+package tetris
+
+// Wall kicks follow the Super Rotation System. Offsets are [dx, dy] with y
+// pointing down the board, keyed by [from, to] rotation state (0 spawn,
+// 1 clockwise, 2 flipped, 3 counter-clockwise), and are tried in order.
+var (
+	jlstzKicks = map[[2]int][][2]int{
+		{0, 1}: {{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}},
+		{1, 0}: {{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}},
+		{1, 2}: {{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}},
+		{2, 1}: {{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}},
+		{2, 3}: {{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}},
+		{3, 2}: {{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}},
+		{3, 0}: {{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}},
+		{0, 3}: {{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}},
+	}
+
+	iKicks = map[[2]int][][2]int{
+		{0, 1}: {{0, 0}, {-2, 0}, {1, 0}, {-2, 1}, {1, -2}},
+		{1, 0}: {{0, 0}, {2, 0}, {-1, 0}, {2, -1}, {-1, 2}},
+		{1, 2}: {{0, 0}, {-1, 0}, {2, 0}, {-1, -2}, {2, 1}},
+		{2, 1}: {{0, 0}, {1, 0}, {-2, 0}, {1, 2}, {-2, -1}},
+		{2, 3}: {{0, 0}, {2, 0}, {-1, 0}, {2, -1}, {-1, 2}},
+		{3, 2}: {{0, 0}, {-2, 0}, {1, 0}, {-2, 1}, {1, -2}},
+		{3, 0}: {{0, 0}, {1, 0}, {-2, 0}, {1, 2}, {-2, -1}},
+		{0, 3}: {{0, 0}, {-1, 0}, {2, 0}, {-1, -2}, {2, 1}},
+	}
+
+	// SRS has no 180 rotation; these kicks try in place, then one row up,
+	// then one column either side.
+	flipKicks = [][2]int{{0, 0}, {0, -1}, {1, 0}, {-1, 0}}
+)
+
+const (
+	pieceI = 0
+	pieceO = 1
+)
+
+// kicks returns the offsets to try when rotating a piece between states.
+func kicks(pieceType, from, to int) [][2]int {
+	switch {
+	case pieceType == pieceO:
+		return [][2]int{{0, 0}}
+	case (to-from+4)%4 == 2:
+		return flipKicks
+	case pieceType == pieceI:
+		return iKicks[[2]int{from, to}]
+	default:
+		return jlstzKicks[[2]int{from, to}]
+	}
+}
+
+func (t *Tetris) rotatePiece() {
+	t.rotatePieceBy(1)
+}
+
+// rotatePieceBy turns the active piece clockwise by quarter turns (3 being a
+// counter-clockwise turn), using the first kick offset at which it fits.
+func (t *Tetris) rotatePieceBy(turns int) {
+	if t.currentPiece == nil {
+		return
+	}
+
+	from := t.currentPiece.rotation
+	to := (from + turns) % 4
+
+	originalShape := t.currentPiece.shape
+	rotatedShape := originalShape
+	for i := 0; i < turns; i++ {
+		rotatedShape = rotateShape(rotatedShape)
+	}
+	t.currentPiece.shape = rotatedShape
+
+	for _, offset := range kicks(t.currentPiece.pieceType, from, to) {
+		if !t.checkCollision(t.currentPiece, offset[0], offset[1]) {
+			t.currentPiece.x += offset[0]
+			t.currentPiece.y += offset[1]
+			t.currentPiece.rotation = to
+			t.lastMoveRotation = true
+			t.resetLockDelay()
+			return
+		}
+	}
+
+	t.currentPiece.shape = originalShape
+}
+
+// shapeBounds returns the first and last filled row and column of a shape.
+func shapeBounds(shape [][]int) (top, bottom, left, right int) {
+	top, left = len(shape), len(shape)
+	bottom, right = -1, -1
+	for y, row := range shape {
+		for x, cell := range row {
+			if cell == 0 {
+				continue
+			}
+			top, bottom = min(top, y), max(bottom, y)
+			left, right = min(left, x), max(right, x)
+		}
+	}
+	return top, bottom, left, right
+}
+
+// trimShape drops the empty rows and columns of a rotation box, for display.
+func trimShape(shape [][]int) [][]int {
+	if shape == nil {
+		return nil
+	}
+	top, bottom, left, right := shapeBounds(shape)
+	trimmed := make([][]int, 0, bottom-top+1)
+	for y := top; y <= bottom; y++ {
+		row := make([]int, right-left+1)
+		copy(row, shape[y][left:right+1])
+		trimmed = append(trimmed, row)
+	}
+	return trimmed
+}
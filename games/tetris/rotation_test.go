@@ -0,0 +1,127 @@
+package tetris
+
+import "testing"
+
+// pieceAt builds a piece of the given type turned clockwise rotation times,
+// with its rotation box's top left corner at x, y on the full board.
+func pieceAt(pieceType, rotation, x, y int) *Piece {
+	shape := copyShape(pieces[pieceType])
+	for i := 0; i < rotation; i++ {
+		shape = rotateShape(shape)
+	}
+	return &Piece{shape: shape, x: x, y: y, rotation: rotation, pieceType: pieceType}
+}
+
+func TestRotationKicks(t *testing.T) {
+	rules := DefaultRules()
+	bottom := rules.Height + rules.BufferRows - 1
+
+	tests := []struct {
+		name   string
+		piece  *Piece
+		filled [][2]int
+		turns  int
+		// blocked rotations must leave the shape as it was.
+		blocked bool
+		// x, y and rotation are where the piece should end up.
+		x, y, rotation int
+	}{
+		{
+			name:  "T in the open",
+			piece: pieceAt(pieceT, 0, 4, 30),
+			turns: 1,
+			x:     4, y: 30, rotation: 1,
+		},
+		{
+			name:  "T kicked off the left wall",
+			piece: pieceAt(pieceT, 1, -1, 30),
+			turns: 3,
+			x:     0, y: 30, rotation: 0,
+		},
+		{
+			name:   "T counter-clockwise kicked by the stack",
+			piece:  pieceAt(pieceT, 0, 4, 30),
+			filled: [][2]int{{5, 32}},
+			turns:  3,
+			x:      5, y: 30, rotation: 3,
+		},
+		{
+			name:  "I kicked off the right wall",
+			piece: pieceAt(pieceI, 1, BoardWidth-3, 30),
+			turns: 1,
+			x:     BoardWidth - 4, y: 30, rotation: 2,
+		},
+		{
+			name:  "O never kicks",
+			piece: pieceAt(pieceO, 0, 0, 30),
+			turns: 1,
+			x:     0, y: 30, rotation: 1,
+		},
+		{
+			name:  "180 in the open",
+			piece: pieceAt(pieceT, 0, 4, 30),
+			turns: 2,
+			x:     4, y: 30, rotation: 2,
+		},
+		{
+			name:  "180 kicked up off the floor",
+			piece: pieceAt(pieceT, 0, 4, bottom-1),
+			turns: 2,
+			x:     4, y: bottom - 2, rotation: 2,
+		},
+		{
+			name:  "180 kicked sideways",
+			piece: pieceAt(pieceT, 0, 4, 30),
+			filled: [][2]int{
+				{5, 32}, {4, 30},
+			},
+			turns: 2,
+			x:     5, y: 30, rotation: 2,
+		},
+		{
+			name:  "blocked rotation leaves the piece alone",
+			piece: pieceAt(pieceT, 0, 4, 30),
+			filled: [][2]int{
+				{3, 30}, {4, 30}, {6, 30}, {7, 30},
+				{3, 32}, {4, 32}, {5, 32}, {6, 32}, {7, 32},
+				{4, 29}, {5, 29}, {6, 29}, {5, 28}, {4, 33}, {5, 33}, {6, 33},
+			},
+			turns:   1,
+			blocked: true,
+			x:       4, y: 30, rotation: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := NewTetris()
+			for y := range game.board {
+				for x := range game.board[y] {
+					game.board[y][x] = 0
+				}
+			}
+			for _, cell := range tt.filled {
+				game.board[cell[1]][cell[0]] = 1
+			}
+			if game.checkCollision(tt.piece, 0, 0) {
+				t.Fatal("piece overlaps the board before rotating")
+			}
+			game.currentPiece = tt.piece
+			before := tt.piece.shape
+
+			game.rotatePieceBy(tt.turns)
+
+			p := game.currentPiece
+			if p.x != tt.x || p.y != tt.y || p.rotation != tt.rotation {
+				t.Errorf("piece at (%d, %d) rotation %d, want (%d, %d) rotation %d",
+					p.x, p.y, p.rotation, tt.x, tt.y, tt.rotation)
+			}
+			if game.checkCollision(p, 0, 0) {
+				t.Error("rotated piece overlaps the board")
+			}
+			if tt.blocked && &p.shape[0][0] != &before[0][0] {
+				t.Error("blocked rotation changed the piece's shape")
+			}
+		})
+	}
+}
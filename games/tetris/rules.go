@@ -0,0 +1,104 @@
+package tetris
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Rules configures a game. Start from DefaultRules and override what you
+// need; New expects rules that pass Validate.
+type Rules struct {
+	// Width and Height are the size of the visible playfield.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// BufferRows are hidden rows above the visible field that pieces can
+	// occupy without topping out.
+	BufferRows int `json:"buffer_rows"`
+	// NextPreviews is how many upcoming pieces are shown.
+	NextPreviews int  `json:"next_previews"`
+	HoldEnabled  bool `json:"hold_enabled"`
+	// Gravity is the number of frames per row of fall, indexed by level-1.
+	// Levels past the end of the table use the last entry.
+	Gravity []int `json:"gravity"`
+	// LockDelay is how many frames a grounded piece waits before locking.
+	// Moving or rotating it starts the wait again, up to maxLockResets
+	// times. Zero locks it on the next gravity step, as classic rules do.
+	LockDelay int `json:"lock_delay"`
+	// LineScores are the points for clearing 1, 2, 3 and 4 lines at once,
+	// multiplied by level+1.
+	LineScores []int `json:"line_scores"`
+}
+
+var defaultGravity = []int{
+	48, 43, 38, 33, 28, 23, 18, 13, 8, 6, // Levels 1-10
+	5, 5, 5, 5, 5, // Levels 11-15
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, // Levels 16-28
+	3, // Level 29+
+}
+
+func DefaultRules() Rules {
+	gravity := make([]int, len(defaultGravity))
+	copy(gravity, defaultGravity)
+
+	return Rules{
+		Width:        BoardWidth,
+		Height:       BoardHeight,
+		BufferRows:   20,
+		NextPreviews: 1,
+		HoldEnabled:  true,
+		Gravity:      gravity,
+		LockDelay:    0,
+		LineScores:   []int{40, 100, 300, 1200},
+	}
+}
+
+// ParseRules overlays a JSON rules object on DefaultRules, so omitted fields
+// keep their defaults, and validates the result.
+func ParseRules(data []byte) (Rules, error) {
+	rules := DefaultRules()
+	if len(data) == 0 {
+		return rules, nil
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return DefaultRules(), fmt.Errorf("invalid rules: %w", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return DefaultRules(), err
+	}
+	return rules, nil
+}
+
+func (r Rules) Validate() error {
+	if r.Width < 4 || r.Width > 40 {
+		return fmt.Errorf("width must be between 4 and 40")
+	}
+	if r.Height < 4 || r.Height > 40 {
+		return fmt.Errorf("height must be between 4 and 40")
+	}
+	if r.BufferRows < 0 || r.BufferRows > 20 {
+		return fmt.Errorf("buffer_rows must be between 0 and 20")
+	}
+	if r.NextPreviews < 0 || r.NextPreviews > maxQueueLength {
+		return fmt.Errorf("next_previews must be between 0 and %d", maxQueueLength)
+	}
+	if len(r.Gravity) == 0 || len(r.Gravity) > 100 {
+		return fmt.Errorf("gravity must have between 1 and 100 entries")
+	}
+	for _, frames := range r.Gravity {
+		if frames < 1 || frames > 1000 {
+			return fmt.Errorf("gravity entries must be between 1 and 1000 frames per row")
+		}
+	}
+	if r.LockDelay < 0 || r.LockDelay > 120 {
+		return fmt.Errorf("lock_delay must be between 0 and 120 frames")
+	}
+	if len(r.LineScores) != 4 {
+		return fmt.Errorf("line_scores must have exactly 4 entries")
+	}
+	for _, points := range r.LineScores {
+		if points < 0 {
+			return fmt.Errorf("line_scores must be non-negative")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package tetris
+
+import "testing"
+
+func TestNewValidatesRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(r *Rules)
+		valid bool
+	}{
+		{name: "defaults", edit: func(r *Rules) {}, valid: true},
+		{name: "wide board", edit: func(r *Rules) { r.Width = 40 }, valid: true},
+		{name: "narrow board", edit: func(r *Rules) { r.Width = 3 }},
+		{name: "too many previews", edit: func(r *Rules) { r.NextPreviews = 99 }},
+		{name: "no gravity", edit: func(r *Rules) { r.Gravity = nil }},
+		{name: "long lock delay", edit: func(r *Rules) { r.LockDelay = 121 }},
+		{name: "missing line score", edit: func(r *Rules) { r.LineScores = r.LineScores[:3] }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultRules()
+			tt.edit(&rules)
+
+			game, err := New(rules)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("New returned %v", err)
+				}
+				if game.Rules().Width != rules.Width {
+					t.Errorf("game is %d wide, want %d", game.Rules().Width, rules.Width)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("New accepted invalid rules %+v", rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package tetris
+
+import "fmt"
+
+// Setup is a custom starting position, used for training and puzzles.
+type Setup struct {
+	// Board holds rows of the visible field from top to bottom using the
+	// same cell values as GameState.Board. It may have fewer rows than the
+	// field, in which case it sits at the bottom.
+	Board [][]int
+	// Queue is the exact sequence of pieces dealt. Once it runs out the game
+	// ends with OutOfPieces.
+	Queue []int
+	// Hold is the piece type in hold at the start, or -1 for none.
+	Hold int
+}
+
+// NewWithSetup creates a game that starts from a custom board and piece
+// queue instead of an empty field and random pieces.
+func NewWithSetup(rules Rules, setup Setup) (*Tetris, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	if len(setup.Board) > rules.Height {
+		return nil, fmt.Errorf("board has %d rows but the field is %d high", len(setup.Board), rules.Height)
+	}
+	if len(setup.Queue) == 0 {
+		return nil, fmt.Errorf("queue must contain at least one piece")
+	}
+	for _, pieceType := range setup.Queue {
+		if pieceType < 0 || pieceType >= len(pieces) {
+			return nil, fmt.Errorf("unknown piece type %d in queue", pieceType)
+		}
+	}
+	if setup.Hold < -1 || setup.Hold >= len(pieces) {
+		return nil, fmt.Errorf("unknown hold piece type %d", setup.Hold)
+	}
+
+	t := newGame(rules)
+
+	offset := len(t.board) - len(setup.Board)
+	for i, row := range setup.Board {
+		if len(row) != rules.Width {
+			return nil, fmt.Errorf("board row %d has %d cells, expected %d", i, len(row), rules.Width)
+		}
+		for x, cell := range row {
+			if cell < 0 || cell > GarbageCell {
+				return nil, fmt.Errorf("invalid cell value %d in board row %d", cell, i)
+			}
+			t.board[offset+i][x] = cell
+		}
+	}
+
+	t.fixedQueue = true
+	t.nextPieces = nil
+	for _, pieceType := range setup.Queue {
+		t.nextPieces = append(t.nextPieces, newPiece(pieceType))
+	}
+
+	t.holdPiece = nil
+	if setup.Hold >= 0 {
+		t.holdPiece = newPiece(setup.Hold)
+	}
+
+	t.spawnPiece()
+	return t, nil
+}
+
+func newPiece(pieceType int) *Piece {
+	return &Piece{
+		shape:     copyShape(pieces[pieceType]),
+		rotation:  0,
+		pieceType: pieceType,
+	}
+}
@@ -0,0 +1,74 @@
+package tetris
+
+// PieceState is the position of the active piece. Type is the index into the
+// piece table (the board stores Type+1), and Rotation counts clockwise
+// quarter turns from the spawn orientation.
+type PieceState struct {
+	Type     int `json:"type"`
+	X        int `json:"x"`
+	Y        int `json:"y"`
+	Rotation int `json:"rotation"`
+}
+
+// Snapshot is a compact copy of a game used for network streaming. Unlike
+// GameState, Board only holds locked cells; the active piece is described by
+// Piece so that a moving piece doesn't show up as changed board cells.
+type Snapshot struct {
+	Board    [][]int
+	Piece    *PieceState
+	GhostY   int
+	Hold     int
+	Next     []int
+	Score    int
+	Lines    int
+	Level    int
+	GameOver bool
+	TopOut   string
+	Paused   bool
+
+	Frame        uint64
+	LastInputSeq uint32
+}
+
+// Snapshot covers the visible rows only, like GetState.
+func (t *Tetris) Snapshot() Snapshot {
+	buffer := t.rules.BufferRows
+	board := make([][]int, t.rules.Height)
+	for y := range board {
+		board[y] = make([]int, t.rules.Width)
+		copy(board[y], t.board[y+buffer])
+	}
+
+	snapshot := Snapshot{
+		Board:    board,
+		Hold:     -1,
+		Score:    t.score,
+		Lines:    t.lines,
+		Level:    t.level,
+		GameOver: t.gameOver,
+		TopOut:   t.topOutReason,
+		Paused:   t.paused,
+
+		Frame:        t.frame,
+		LastInputSeq: t.lastInputSeq,
+	}
+
+	if t.currentPiece != nil {
+		snapshot.Piece = &PieceState{
+			Type:     t.currentPiece.pieceType,
+			X:        t.currentPiece.x,
+			Y:        t.currentPiece.y - buffer,
+			Rotation: t.currentPiece.rotation,
+		}
+		_, _, ghostY := t.calculateGhostPiece()
+		snapshot.GhostY = ghostY - buffer
+	}
+
+	if t.holdPiece != nil {
+		snapshot.Hold = t.holdPiece.pieceType
+	}
+
+	snapshot.Next = t.NextQueue()
+
+	return snapshot
+}
@@ -18,14 +18,18 @@ func secureRandIntn(n int) int {
 	return int(result.Int64())
 }
 
+// BoardWidth and BoardHeight are the dimensions used by DefaultRules.
 const (
 	BoardWidth  = 10
 	BoardHeight = 20
 )
 
 type GameState struct {
-	Board      [][]int `json:"board"`
-	NextPiece  [][]int `json:"nextPiece"`
+	Board     [][]int `json:"board"`
+	NextPiece [][]int `json:"nextPiece"`
+	// NextQueue lists the piece types of every visible preview, soonest
+	// first. NextPiece is the shape of the first one.
+	NextQueue  []int   `json:"nextQueue"`
 	HoldPiece  [][]int `json:"holdPiece"`
 	GhostPiece struct {
 		Shape [][]int `json:"shape"`
@@ -36,8 +40,16 @@ type GameState struct {
 	Lines    int  `json:"lines"`
 	Level    int  `json:"level"`
 	GameOver bool `json:"gameOver"`
-	Paused   bool `json:"paused"`
-	Stats    struct {
+	// TopOut is one of the TopOut* reasons once GameOver is set.
+	TopOut string `json:"topOut,omitempty"`
+	Paused bool   `json:"paused"`
+	// Frame and LastInputSeq let predicting clients reconcile: every input
+	// up to LastInputSeq is reflected in this state.
+	Frame        uint64 `json:"frame"`
+	LastInputSeq uint32 `json:"lastInputSeq"`
+	// Master is set for games in Master mode.
+	Master *MasterState `json:"master,omitempty"`
+	Stats  struct {
 		TimePlayed   int     `json:"timePlayed"`
 		PiecesPlaced int     `json:"piecesPlaced"`
 		PPM          float64 `json:"ppm"`
@@ -46,17 +58,21 @@ type GameState struct {
 }
 
 type Tetris struct {
+	rules      Rules
+	randomizer Randomizer
+	// fixedQueue is set for custom setups that only deal the pieces they
+	// were given.
+	fixedQueue bool
+
+	// board includes the hidden buffer rows at the top.
 	board         [][]int
-	currentPiece  *Piece
-	nextPiece     *Piece
-	holdPiece     *Piece
 	score         int
 	lines         int
 	level         int
 	startingLevel int
 	gameOver      bool
+	topOutReason  string
 	paused        bool
-	holdUsed      bool
 
 	startTime     time.Time
 	pausedTime    time.Duration
@@ -64,8 +80,52 @@ type Tetris struct {
 	piecesPlaced  int
 	lineStats     [4]int
 
+	dropSpeed int
+
+	controller
+	// teammates are the other players' active pieces on a shared co-op
+	// board. They block movement like locked cells do.
+	teammates []*Piece
+
+	master     *masterState
+	lastClear  ClearEvent
+	clearStats ClearStats
+	// incoming is garbage waiting to rise and outgoing the lines sent but
+	// not yet collected with TakeAttack.
+	incoming []garbageBatch
+	outgoing int
+
+	frame uint64
+}
+
+// controller is the state belonging to whoever controls the active piece.
+// A solo game has one; a co-op game keeps one per player and swaps them in
+// turn, see Coop.
+type controller struct {
+	currentPiece *Piece
+	nextPieces   []*Piece
+	holdPiece    *Piece
+	holdUsed     bool
+
 	dropCounter int
-	dropSpeed   int
+	lockCounter int
+	lockResets  int
+
+	handling Handling
+	held     heldKeys
+	finesse  finesseTracker
+
+	lastMoveRotation bool
+
+	// laneStart and laneWidth are the columns pieces spawn centred in. A
+	// zero width means the whole board.
+	laneStart int
+	laneWidth int
+
+	pendingInputs   []Input
+	lastInputSeq    uint32
+	lastQueuedSeq   uint32
+	lastQueuedFrame uint64
 }
 
 type Piece struct {
@@ -75,9 +135,14 @@ type Piece struct {
 	pieceType int
 }
 
+// pieces holds the spawn orientation of each piece inside its rotation box,
+// so that rotating the matrix turns the piece about its centre as in SRS.
 var pieces = [][][]int{
 	{
+		{0, 0, 0, 0},
 		{1, 1, 1, 1},
+		{0, 0, 0, 0},
+		{0, 0, 0, 0},
 	},
 	{
 		{1, 1},
@@ -86,30 +151,51 @@ var pieces = [][][]int{
 	{
 		{0, 1, 0},
 		{1, 1, 1},
+		{0, 0, 0},
 	},
 	{
 		{0, 1, 1},
 		{1, 1, 0},
+		{0, 0, 0},
 	},
 	{
 		{1, 1, 0},
 		{0, 1, 1},
+		{0, 0, 0},
 	},
 	{
 		{1, 0, 0},
 		{1, 1, 1},
+		{0, 0, 0},
 	},
 	{
 		{0, 0, 1},
 		{1, 1, 1},
+		{0, 0, 0},
 	},
 }
 
 var pieceColors = []string{"##", "@@", "**", "%%", "&&", "++", "=="}
 
 func NewTetris() *Tetris {
+	return newGame(DefaultRules())
+}
+
+// New creates a game using the given rules, or returns why they are
+// invalid.
+func New(rules Rules) (*Tetris, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return newGame(rules), nil
+}
+
+// newGame creates a game with rules the caller has already validated.
+func newGame(rules Rules) *Tetris {
 	t := &Tetris{
-		board:         make([][]int, BoardHeight),
+		rules:         rules,
+		randomizer:    uniformRandomizer{},
+		board:         make([][]int, rules.Height+rules.BufferRows),
 		score:         0,
 		lines:         0,
 		level:         1,
@@ -118,70 +204,59 @@ func NewTetris() *Tetris {
 		pausedTime:    0,
 		lastPauseTime: time.Now(),
 		piecesPlaced:  0,
-		holdUsed:      false,
 	}
+	t.handling = DefaultHandling()
 
 	for i := range t.board {
-		t.board[i] = make([]int, BoardWidth)
+		t.board[i] = make([]int, rules.Width)
 	}
 
 	t.dropSpeed = t.getFramesPerDrop()
 
 	t.spawnPiece()
-	t.spawnNextPiece()
 
 	return t
 }
 
-func (t *Tetris) spawnPiece() {
-	if t.nextPiece != nil {
-		t.currentPiece = t.nextPiece
-		t.currentPiece.x = BoardWidth/2 - 1
-		t.currentPiece.y = 0
-		t.spawnNextPiece()
-	} else {
-		pieceType := secureRandIntn(len(pieces))
-		t.currentPiece = &Piece{
-			shape:     copyShape(pieces[pieceType]),
-			x:         BoardWidth/2 - 1,
-			y:         0,
-			rotation:  0,
-			pieceType: pieceType,
-		}
-	}
+// Rules returns the rules the game was created with.
+func (t *Tetris) Rules() Rules {
+	return t.rules
+}
 
+func (t *Tetris) spawnPiece() {
 	t.holdUsed = false
-
-	if t.checkCollision(t.currentPiece, 0, 0) {
-		t.gameOver = true
+	if t.master != nil {
+		t.masterPieceSpawned()
+		if t.gameOver {
+			return
+		}
 	}
-}
-
-func (t *Tetris) spawnNextPiece() {
-	pieceType := secureRandIntn(len(pieces))
-	t.nextPiece = &Piece{
-		shape:     copyShape(pieces[pieceType]),
-		x:         0,
-		y:         0,
-		rotation:  0,
-		pieceType: pieceType,
+	piece := t.popQueue()
+	if piece == nil {
+		t.currentPiece = nil
+		t.topOut(OutOfPieces)
+		return
 	}
+	t.enterPiece(piece)
 }
 
+// GetState returns the visible part of the game; buffer rows are left out
+// and piece coordinates are relative to the top visible row.
 func (t *Tetris) GetState() GameState {
-	boardCopy := make([][]int, BoardHeight)
-	for i := range t.board {
-		boardCopy[i] = make([]int, BoardWidth)
-		copy(boardCopy[i], t.board[i])
+	buffer := t.rules.BufferRows
+	boardCopy := make([][]int, t.rules.Height)
+	for i := range boardCopy {
+		boardCopy[i] = make([]int, t.rules.Width)
+		copy(boardCopy[i], t.board[i+buffer])
 	}
 
 	if t.currentPiece != nil {
 		for py := 0; py < len(t.currentPiece.shape); py++ {
 			for px := 0; px < len(t.currentPiece.shape[py]); px++ {
 				if t.currentPiece.shape[py][px] == 1 {
-					boardY := t.currentPiece.y + py
+					boardY := t.currentPiece.y + py - buffer
 					boardX := t.currentPiece.x + px
-					if boardY >= 0 && boardY < BoardHeight && boardX >= 0 && boardX < BoardWidth {
+					if boardY >= 0 && boardY < t.rules.Height && boardX >= 0 && boardX < t.rules.Width {
 						boardCopy[boardY][boardX] = t.currentPiece.pieceType + 1
 					}
 				}
@@ -190,24 +265,20 @@ func (t *Tetris) GetState() GameState {
 	}
 
 	var nextPieceShape [][]int
-	if t.nextPiece != nil {
-		nextPieceShape = t.nextPiece.shape
+	previews := t.previews()
+	if len(previews) > 0 {
+		nextPieceShape = trimShape(previews[0].shape)
 	}
 
 	var holdPieceShape [][]int
 	if t.holdPiece != nil {
-		holdPieceShape = t.holdPiece.shape
+		holdPieceShape = trimShape(t.holdPiece.shape)
 	}
 
 	ghostShape, ghostX, ghostY := t.calculateGhostPiece()
+	ghostY -= buffer
 
-	totalElapsed := time.Since(t.startTime)
-	currentPauseTime := time.Duration(0)
-	if t.paused && !t.lastPauseTime.IsZero() {
-		currentPauseTime = time.Since(t.lastPauseTime)
-	}
-	actualPlayTime := totalElapsed - t.pausedTime - currentPauseTime
-	timePlayed := int(actualPlayTime.Seconds())
+	timePlayed := int(t.PlayTime().Seconds())
 
 	var ppm float64
 	if timePlayed > 0 {
@@ -217,6 +288,7 @@ func (t *Tetris) GetState() GameState {
 	return GameState{
 		Board:     boardCopy,
 		NextPiece: nextPieceShape,
+		NextQueue: t.NextQueue(),
 		HoldPiece: holdPieceShape,
 		GhostPiece: struct {
 			Shape [][]int `json:"shape"`
@@ -227,11 +299,15 @@ func (t *Tetris) GetState() GameState {
 			X:     ghostX,
 			Y:     ghostY,
 		},
-		Score:    t.score,
-		Lines:    t.lines,
-		Level:    t.level,
-		GameOver: t.gameOver,
-		Paused:   t.paused,
+		Score:        t.score,
+		Lines:        t.lines,
+		Level:        t.level,
+		GameOver:     t.gameOver,
+		TopOut:       t.topOutReason,
+		Paused:       t.paused,
+		Frame:        t.frame,
+		LastInputSeq: t.lastInputSeq,
+		Master:       t.masterState(),
 		Stats: struct {
 			TimePlayed   int     `json:"timePlayed"`
 			PiecesPlaced int     `json:"piecesPlaced"`
@@ -246,7 +322,40 @@ func (t *Tetris) GetState() GameState {
 	}
 }
 
+// PlayTime is the time since the game started, not counting pauses.
+func (t *Tetris) PlayTime() time.Duration {
+	totalElapsed := time.Since(t.startTime)
+	currentPauseTime := time.Duration(0)
+	if t.paused && !t.lastPauseTime.IsZero() {
+		currentPauseTime = time.Since(t.lastPauseTime)
+	}
+	return totalElapsed - t.pausedTime - currentPauseTime
+}
+
+var webInputs = []string{
+	"left", "right", "down", "rotate", "rotateCCW", "rotate180", "hardDrop", "hold", "pause",
+	"left_down", "left_up", "right_down", "right_up", "down_down", "down_up",
+}
+
+// WebInputs lists the actions accepted by HandleWebInput.
+func WebInputs() []string {
+	inputs := make([]string, len(webInputs))
+	copy(inputs, webInputs)
+	return inputs
+}
+
+func IsValidInput(input string) bool {
+	for _, valid := range webInputs {
+		if input == valid {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Tetris) HandleWebInput(input string) {
+	t.countKey(input)
+
 	switch input {
 	case "left":
 		if !t.paused {
@@ -260,10 +369,36 @@ func (t *Tetris) HandleWebInput(input string) {
 		if !t.paused {
 			t.movePiece(0, 1)
 		}
+	case "left_down":
+		if !t.paused {
+			t.pressDirection(-1)
+		}
+	case "right_down":
+		if !t.paused {
+			t.pressDirection(1)
+		}
+	case "down_down":
+		if !t.paused {
+			t.pressSoftDrop()
+		}
+	case "left_up":
+		t.releaseDirection(-1)
+	case "right_up":
+		t.releaseDirection(1)
+	case "down_up":
+		t.releaseSoftDrop()
 	case "rotate":
 		if !t.paused {
 			t.rotatePiece()
 		}
+	case "rotateCCW":
+		if !t.paused {
+			t.rotatePieceBy(3)
+		}
+	case "rotate180":
+		if !t.paused {
+			t.rotatePieceBy(2)
+		}
 	case "hardDrop":
 		if !t.paused {
 			t.hardDrop()
@@ -286,21 +421,107 @@ func (t *Tetris) GetScore() int {
 }
 
 func (t *Tetris) Update() {
+	if t.gameOver {
+		return
+	}
+
+	t.frame++
+	t.step()
+}
+
+// step runs the active piece's part of a frame: due inputs, auto shift,
+// gravity and locking.
+func (t *Tetris) step() {
+	t.applyDueInputs()
+
 	if t.gameOver || t.paused {
 		return
 	}
 
+	t.applyHeldKeys()
+
+	if t.master != nil {
+		t.updateMaster()
+		return
+	}
+
+	if t.rules.LockDelay > 0 && t.landed() {
+		t.lockCounter++
+		if t.lockCounter >= t.rules.LockDelay {
+			t.lockPiece()
+		}
+		return
+	}
+	t.lockCounter = 0
+
 	t.dropCounter++
 	if t.dropCounter >= t.dropSpeed {
 		t.dropCounter = 0
-		if !t.movePiece(0, 1) {
-			t.placePiece()
-			t.clearLines()
-			t.spawnPiece()
+		if !t.movePiece(0, 1) && t.landed() {
+			t.lockPiece()
 		}
 	}
 }
 
+// maxLockResets is how many times moving or rotating a grounded piece can
+// restart its lock delay, so it can't be kept from locking forever.
+const maxLockResets = 15
+
+// resetLockDelay restarts the lock delay after the active piece moved or
+// rotated while grounded. Master mode keeps the arcade behaviour where only
+// stepping down resets it.
+func (t *Tetris) resetLockDelay() {
+	if t.master != nil || t.lockCounter == 0 || t.lockResets >= maxLockResets {
+		return
+	}
+	t.lockCounter = 0
+	t.lockResets++
+}
+
+func (t *Tetris) isGrounded() bool {
+	return t.currentPiece != nil && t.checkCollision(t.currentPiece, 0, 1)
+}
+
+// landed is isGrounded ignoring teammates' pieces: a piece held up only by
+// another player's piece waits for it to move rather than locking in mid air.
+func (t *Tetris) landed() bool {
+	teammates := t.teammates
+	t.teammates = nil
+	defer func() { t.teammates = teammates }()
+	return t.isGrounded()
+}
+
+// lockPiece fixes the active piece to the board, clears any completed lines
+// and brings in the next piece.
+func (t *Tetris) lockPiece() {
+	if t.currentPiece == nil {
+		return
+	}
+	t.judgeFinesse()
+	lockedOut := t.lockedOut()
+	tSpin := t.isTSpin()
+	pieceType := t.currentPiece.pieceType
+	t.placePiece()
+	if lockedOut {
+		t.topOut(TopOutLockOut)
+		return
+	}
+	t.currentPiece = nil
+	lines := t.clearLines()
+	t.recordClear(pieceType, lines, tSpin)
+	t.exchangeGarbage()
+	t.dropCounter = 0
+	if t.gameOver {
+		return
+	}
+
+	if t.master != nil {
+		t.masterPieceLocked(lines, t.lastClear.PerfectClear)
+		return
+	}
+	t.spawnPiece()
+}
+
 func (t *Tetris) togglePause() {
 	if !t.gameOver {
 		if t.paused {
@@ -344,35 +565,13 @@ func (t *Tetris) movePiece(dx, dy int) bool {
 	if !t.checkCollision(t.currentPiece, dx, dy) {
 		t.currentPiece.x += dx
 		t.currentPiece.y += dy
+		t.lastMoveRotation = false
+		t.resetLockDelay()
 		return true
 	}
 	return false
 }
 
-func (t *Tetris) rotatePiece() {
-	if t.currentPiece == nil {
-		return
-	}
-
-	originalShape := t.currentPiece.shape
-	rotatedShape := rotateShape(t.currentPiece.shape)
-	t.currentPiece.shape = rotatedShape
-
-	if !t.checkCollision(t.currentPiece, 0, 0) {
-		return
-	}
-
-	kickOffsets := []int{1, -1, 2, -2}
-	for _, dx := range kickOffsets {
-		if !t.checkCollision(t.currentPiece, dx, 0) {
-			t.currentPiece.x += dx
-			return
-		}
-	}
-
-	t.currentPiece.shape = originalShape
-}
-
 func (t *Tetris) hardDrop() {
 	if t.currentPiece == nil {
 		return
@@ -381,11 +580,11 @@ func (t *Tetris) hardDrop() {
 	for t.movePiece(0, 1) {
 	}
 
-	t.placePiece()
+	t.lockPiece()
 }
 
 func (t *Tetris) holdCurrentPiece() {
-	if t.currentPiece == nil || t.holdUsed {
+	if t.currentPiece == nil || t.holdUsed || !t.rules.HoldEnabled {
 		return
 	}
 
@@ -409,16 +608,12 @@ func (t *Tetris) holdCurrentPiece() {
 			pieceType: t.currentPiece.pieceType,
 		}
 
-		t.currentPiece = &Piece{
+		t.enterPiece(&Piece{
 			shape:     copyShape(pieces[heldPieceType]),
-			x:         BoardWidth/2 - 1,
-			y:         0,
 			rotation:  0,
 			pieceType: heldPieceType,
-		}
-
-		if t.checkCollision(t.currentPiece, 0, 0) {
-			t.gameOver = true
+		})
+		if t.gameOver {
 			return
 		}
 	}
@@ -451,19 +646,34 @@ func (t *Tetris) checkCollisionAt(shape [][]int, x, y int) bool {
 				newX := x + px
 				newY := y + py
 
-				if newX < 0 || newX >= BoardWidth || newY >= BoardHeight {
+				if newX < 0 || newX >= t.rules.Width || newY >= len(t.board) {
 					return true
 				}
 
 				if newY >= 0 && t.board[newY][newX] != 0 {
 					return true
 				}
+
+				if t.teammateAt(newX, newY) {
+					return true
+				}
 			}
 		}
 	}
 	return false
 }
 
+// teammateAt reports whether a teammate's active piece covers a cell.
+func (t *Tetris) teammateAt(x, y int) bool {
+	for _, piece := range t.teammates {
+		py, px := y-piece.y, x-piece.x
+		if py >= 0 && py < len(piece.shape) && px >= 0 && px < len(piece.shape[py]) && piece.shape[py][px] == 1 {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Tetris) checkCollision(piece *Piece, dx, dy int) bool {
 	for py := 0; py < len(piece.shape); py++ {
 		for px := 0; px < len(piece.shape[py]); px++ {
@@ -471,13 +681,17 @@ func (t *Tetris) checkCollision(piece *Piece, dx, dy int) bool {
 				newX := piece.x + px + dx
 				newY := piece.y + py + dy
 
-				if newX < 0 || newX >= BoardWidth || newY >= BoardHeight {
+				if newX < 0 || newX >= t.rules.Width || newY >= len(t.board) {
 					return true
 				}
 
 				if newY >= 0 && t.board[newY][newX] != 0 {
 					return true
 				}
+
+				if t.teammateAt(newX, newY) {
+					return true
+				}
 			}
 		}
 	}
@@ -494,7 +708,7 @@ func (t *Tetris) placePiece() {
 			if t.currentPiece.shape[py][px] == 1 {
 				boardY := t.currentPiece.y + py
 				boardX := t.currentPiece.x + px
-				if boardY >= 0 && boardY < BoardHeight && boardX >= 0 && boardX < BoardWidth {
+				if boardY >= 0 && boardY < len(t.board) && boardX >= 0 && boardX < t.rules.Width {
 					t.board[boardY][boardX] = t.currentPiece.pieceType + 1
 				}
 			}
@@ -504,12 +718,12 @@ func (t *Tetris) placePiece() {
 	t.piecesPlaced++
 }
 
-func (t *Tetris) clearLines() {
+func (t *Tetris) clearLines() int {
 	linesCleared := 0
 
-	for y := BoardHeight - 1; y >= 0; y-- {
+	for y := len(t.board) - 1; y >= 0; y-- {
 		fullLine := true
-		for x := 0; x < BoardWidth; x++ {
+		for x := 0; x < t.rules.Width; x++ {
 			if t.board[y][x] == 0 {
 				fullLine = false
 				break
@@ -518,7 +732,7 @@ func (t *Tetris) clearLines() {
 
 		if fullLine {
 			copy(t.board[1:y+1], t.board[0:y])
-			t.board[0] = make([]int, BoardWidth)
+			t.board[0] = make([]int, t.rules.Width)
 			y++
 			linesCleared++
 		}
@@ -531,56 +745,37 @@ func (t *Tetris) clearLines() {
 			t.lineStats[linesCleared-1]++
 		}
 
-		lineScores := []int{0, 40, 100, 300, 1200}
-		if linesCleared < len(lineScores) {
-			t.score += lineScores[linesCleared] * (t.level + 1)
-		}
+		if t.master == nil {
+			if linesCleared <= len(t.rules.LineScores) {
+				t.score += t.rules.LineScores[linesCleared-1] * (t.level + 1)
+			}
 
-		newLevel := t.startingLevel + (t.lines / 10)
-		if newLevel != t.level {
-			t.level = newLevel
-			t.dropSpeed = t.getFramesPerDrop()
+			newLevel := t.startingLevel + (t.lines / 10)
+			if newLevel != t.level {
+				t.level = newLevel
+				t.dropSpeed = t.getFramesPerDrop()
+			}
 		}
 	}
+
+	return linesCleared
 }
 
 func (t *Tetris) getFramesPerDrop() int {
-	speedTable := []int{
-		48, // Level 1
-		43, // Level 2
-		38, // Level 3
-		33, // Level 4
-		28, // Level 5
-		23, // Level 6
-		18, // Level 7
-		13, // Level 8
-		8,  // Level 9
-		6,  // Level 10
-		5,  // Level 11-12
-		5,  // Level 13-15
-		4,  // Level 16-18
-		4,  // Level 19-28
-		3,  // Level 29+
-	}
-
+	gravity := t.rules.Gravity
 	if t.level <= 0 {
-		return speedTable[0]
-	} else if t.level <= 10 {
-		return speedTable[t.level-1]
-	} else if t.level <= 12 {
-		return 5
-	} else if t.level <= 15 {
-		return 5
-	} else if t.level <= 18 {
-		return 4
-	} else if t.level <= 28 {
-		return 4
-	} else {
-		return 3 // Level 29+, maximum speed
+		return gravity[0]
+	}
+	if t.level > len(gravity) {
+		return gravity[len(gravity)-1]
 	}
+	return gravity[t.level-1]
 }
 
 func (t *Tetris) SetLevel(level int) {
+	if t.master != nil {
+		return
+	}
 	if level >= 1 && level <= 29 {
 		t.level = level
 		t.startingLevel = level
@@ -0,0 +1,144 @@
+package tetris
+
+// Reasons reported in GameState.TopOut once the game is over.
+const (
+	// TopOutBlockOut means a new piece spawned overlapping the stack.
+	TopOutBlockOut = "block_out"
+	// TopOutLockOut means a piece locked entirely inside the hidden buffer.
+	TopOutLockOut = "lock_out"
+	// TopOutGarbageOut means incoming garbage pushed blocks off the top of
+	// the board.
+	TopOutGarbageOut = "garbage_out"
+	// OutOfPieces means a custom setup's fixed queue ran out. It isn't a top
+	// out, but ends the game the same way.
+	OutOfPieces = "out_of_pieces"
+	// Forfeited means the player left or was removed from a match.
+	Forfeited = "forfeited"
+)
+
+// GarbageCell is the board value used for garbage rows, one past the last
+// piece colour.
+const GarbageCell = 8
+
+// spawnPosition returns where a piece of the given shape enters the board:
+// its rotation box horizontally centred in the controller's lane (rounding
+// left, so the 3-wide pieces spawn in columns 4-6 of a 10-wide field) with
+// its lowest cells resting on top of the visible field inside the buffer.
+// Without a buffer the box starts at the top row.
+func (t *Tetris) spawnPosition(shape [][]int) (int, int) {
+	_, bottom, _, _ := shapeBounds(shape)
+	start, width := 0, t.rules.Width
+	if t.laneWidth > 0 {
+		start, width = t.laneStart, t.laneWidth
+	}
+	x := start + (width-len(shape[0]))/2
+	y := t.rules.BufferRows - bottom - 1
+	if y < 0 {
+		y = 0
+	}
+	return x, y
+}
+
+// enterPiece makes piece the active piece at its spawn position. A piece
+// that overlaps the stack ends the game with a block out. When the rules have
+// a buffer, the piece then drops one row straight away if it can, so it is
+// partly visible as soon as it appears.
+func (t *Tetris) enterPiece(piece *Piece) {
+	piece.x, piece.y = t.spawnPosition(piece.shape)
+	t.currentPiece = piece
+	t.lockCounter = 0
+	t.lockResets = 0
+	t.finesse.pieceKeys = 0
+
+	if t.checkCollision(piece, 0, 0) {
+		t.topOut(TopOutBlockOut)
+		return
+	}
+
+	if t.rules.BufferRows > 0 {
+		t.movePiece(0, 1)
+	}
+}
+
+// lockedOut reports whether the active piece lies entirely in the buffer.
+func (t *Tetris) lockedOut() bool {
+	if t.currentPiece == nil || t.rules.BufferRows == 0 {
+		return false
+	}
+	for py, row := range t.currentPiece.shape {
+		for _, cell := range row {
+			if cell == 1 && t.currentPiece.y+py >= t.rules.BufferRows {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (t *Tetris) topOut(reason string) {
+	t.gameOver = true
+	if t.topOutReason == "" {
+		t.topOutReason = reason
+	}
+}
+
+// Forfeit ends the game for a player who has left.
+func (t *Tetris) Forfeit() {
+	t.topOut(Forfeited)
+}
+
+// TopOutReason returns why the game ended, or "" while it is running.
+func (t *Tetris) TopOutReason() string {
+	return t.topOutReason
+}
+
+// AddGarbage pushes rows of garbage in from the bottom, each full except for
+// the hole column. Blocks pushed off the top of the board end the game with a
+// garbage out; the active piece is moved up if the stack now overlaps it.
+func (t *Tetris) AddGarbage(rows, hole int) {
+	if t.gameOver || rows <= 0 {
+		return
+	}
+	if rows > len(t.board) {
+		rows = len(t.board)
+	}
+	if hole < 0 || hole >= t.rules.Width {
+		hole = 0
+	}
+
+	for _, row := range t.board[:rows] {
+		for _, cell := range row {
+			if cell != 0 {
+				t.topOut(TopOutGarbageOut)
+				return
+			}
+		}
+	}
+
+	copy(t.board, t.board[rows:])
+	for y := len(t.board) - rows; y < len(t.board); y++ {
+		row := make([]int, t.rules.Width)
+		for x := range row {
+			if x != hole {
+				row[x] = GarbageCell
+			}
+		}
+		t.board[y] = row
+	}
+
+	if !t.liftPiece() {
+		t.topOut(TopOutGarbageOut)
+	}
+}
+
+// liftPiece moves the active piece up until it no longer overlaps anything,
+// reporting false if it can't be freed.
+func (t *Tetris) liftPiece() bool {
+	if t.currentPiece == nil {
+		return true
+	}
+	for t.currentPiece.y > 0 && t.checkCollision(t.currentPiece, 0, 0) {
+		t.currentPiece.y--
+	}
+	return !t.checkCollision(t.currentPiece, 0, 0)
+}
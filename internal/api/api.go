@@ -7,9 +7,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/isaacjstriker/devware/internal/auth"
 	"github.com/isaacjstriker/devware/internal/config"
 	"github.com/isaacjstriker/devware/internal/database"
 	"github.com/isaacjstriker/devware/internal/multiplayer"
+	"github.com/isaacjstriker/devware/internal/ratelimit"
 	"github.com/isaacjstriker/devware/web"
 )
 
@@ -18,6 +20,9 @@ type APIServer struct {
 	db         *database.DB
 	config     *config.Config
 	wsHub      *multiplayer.Hub
+	limiters   rateLimiters
+	lockout    auth.LockoutPolicy
+	loginLocks keyedLocks
 }
 
 func NewAPIServer(cfg *config.Config, db *database.DB) *APIServer {
@@ -25,7 +30,17 @@ func NewAPIServer(cfg *config.Config, db *database.DB) *APIServer {
 		config:     cfg,
 		db:         db,
 		listenAddr: fmt.Sprintf("%s:%d", cfg.ServerHost, cfg.ServerPort),
+		limiters: rateLimiters{
+			ip:       ratelimit.NewLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst),
+			user:     ratelimit.NewLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst),
+			login:    ratelimit.NewLimiter(cfg.LoginRateLimitPerMinute, cfg.LoginRateLimitBurst),
+			register: ratelimit.NewLimiter(cfg.RegisterRateLimitPerMinute, cfg.RegisterRateLimitBurst),
+			rooms:    ratelimit.NewLimiter(cfg.RoomRateLimitPerMinute, cfg.RoomRateLimitBurst),
+		},
+		lockout: auth.DefaultLockoutPolicy(),
 	}
+	server.lockout.LockoutAfter = cfg.LoginLockoutAfter
+	server.lockout.LockoutDuration = time.Duration(cfg.LoginLockoutMinutes) * time.Minute
 
 	jwtValidator := func(tokenString string) (*multiplayer.UserInfo, error) {
 		userInfo, err := server.validateJWT(tokenString)
@@ -38,7 +53,25 @@ func NewAPIServer(cfg *config.Config, db *database.DB) *APIServer {
 		}, nil
 	}
 
-	server.wsHub = multiplayer.NewHub(db, jwtValidator)
+	messageLimits := multiplayer.MessageLimits{
+		PerSecond:       float64(cfg.WSMessagesPerSecond),
+		Burst:           cfg.WSMessageBurst,
+		WarnAfter:       cfg.WSRateWarnAfter,
+		DisconnectAfter: cfg.WSRateDisconnectAfter,
+	}
+
+	chatOptions := multiplayer.ChatOptions{
+		PerMinute:   cfg.ChatMessagesPerMinute,
+		Burst:       cfg.ChatMessageBurst,
+		HistorySize: cfg.ChatHistorySize,
+		Persist:     cfg.ChatPersist,
+		Admins:      cfg.AdminUsers,
+	}
+	if len(cfg.ChatBlockedWords) > 0 {
+		chatOptions.Filter = multiplayer.NewWordFilter(cfg.ChatBlockedWords)
+	}
+
+	server.wsHub = multiplayer.NewHub(db, jwtValidator, messageLimits, chatOptions)
 	return server
 }
 
@@ -53,21 +86,44 @@ func (s *APIServer) Start() {
 
 	router.HandleFunc("/", s.handleIndex)
 
-	router.HandleFunc("POST /api/register", s.handleRegister)
-	router.HandleFunc("POST /api/login", s.handleLogin)
+	router.HandleFunc("POST /api/register", rateLimit(s, s.limiters.register, s.handleRegister))
+	router.HandleFunc("POST /api/login", rateLimit(s, s.limiters.login, s.handleLogin))
 	router.HandleFunc("POST /api/logout", s.handleLogout)
+	router.HandleFunc("GET /api/login-history", requireAuth(s, s.handleGetLoginHistory))
 	router.HandleFunc("GET /api/leaderboard/{gameType}", s.handleGetLeaderboard)
 	router.HandleFunc("GET /api/recent/{gameType}", s.handleGetRecentGames)
 	router.HandleFunc("POST /api/scores", s.handleSubmitScore)
+	router.HandleFunc("GET /api/matches/{id}", s.handleGetMatch)
+	router.HandleFunc("GET /api/users/{username}/matches", s.handleGetUserMatches)
 
-	router.HandleFunc("POST /api/rooms", requireAuth(s, s.handleCreateRoom))
+	router.HandleFunc("POST /api/rooms", requireAuth(s, rateLimit(s, s.limiters.rooms, s.handleCreateRoom)))
 	router.HandleFunc("GET /api/rooms/{gameType}", s.handleGetAvailableRooms)
 	router.HandleFunc("GET /api/room/{roomId}", s.handleGetRoom)
 	router.HandleFunc("POST /api/room/{roomId}/join", requireAuth(s, s.handleJoinRoom))
 	router.HandleFunc("POST /api/room/{roomId}/leave", requireAuth(s, s.handleLeaveRoom))
 	router.HandleFunc("POST /api/room/{roomId}/ready", requireAuth(s, s.handlePlayerReady))
-
+	router.HandleFunc("GET /api/room/{roomId}/invite", requireAuth(s, s.handleGetRoomInvite))
+	router.HandleFunc("POST /api/room/{roomId}/kick", requireAuth(s, s.handleKickPlayer))
+	router.HandleFunc("POST /api/room/{roomId}/transfer", requireAuth(s, s.handleTransferRoom))
+	router.HandleFunc("POST /api/room/{roomId}/lock", requireAuth(s, s.handleLockRoom))
+	router.HandleFunc("POST /api/room/{roomId}/invites", requireAuth(s, s.handleInviteFriend))
+	router.HandleFunc("POST /api/invites/{code}/join", requireAuth(s, s.handleJoinRoomByInvite))
+
+	router.HandleFunc("GET /api/friends", requireAuth(s, s.handleGetFriends))
+	router.HandleFunc("POST /api/friends/requests", requireAuth(s, s.handleSendFriendRequest))
+	router.HandleFunc("POST /api/friends/{userId}/accept", requireAuth(s, s.handleAcceptFriendRequest))
+	router.HandleFunc("DELETE /api/friends/{userId}", requireAuth(s, s.handleRemoveFriend))
+
+	router.HandleFunc("GET /api/puzzles", s.handleGetPuzzles)
+	router.HandleFunc("GET /api/puzzles/{puzzleId}", s.handleGetPuzzle)
+	router.HandleFunc("GET /api/puzzle-completions", requireAuth(s, s.handleGetPuzzleCompletions))
+
+	router.HandleFunc("DELETE /api/chat/messages/{id}", requireAuth(s, s.handleDeleteChatMessage))
+	router.HandleFunc("POST /api/users/{username}/messages", requireAuth(s, s.handleSendModeratorMessage))
+
+	router.HandleFunc("GET /api/ws/schema", s.handleGetProtocolSchema)
 	router.HandleFunc("GET /ws/room/{roomId}", s.handleWebSocket)
+	router.HandleFunc("GET /ws/user", s.handleUserWebSocket)
 	router.HandleFunc("GET /ws/game", s.handleGameConnection)
 
 	go s.wsHub.Run()
@@ -76,7 +132,7 @@ func (s *APIServer) Start() {
 
 	server := &http.Server{
 		Addr:         s.listenAddr,
-		Handler:      router,
+		Handler:      s.limitRequests(router),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// handleDeleteChatMessage lets an admin remove a room or lobby chat message.
+func (s *APIServer) handleDeleteChatMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+	if s.wsHub == nil || !s.wsHub.IsChatAdmin(user.Username) {
+		permissionDenied(w)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := s.wsHub.DeleteChatMessage(id); err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return
+	}
+	log.Printf("Chat message %s deleted by %s", id, user.Username)
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "message deleted"})
+}
+
+type ModeratorMessageRequest struct {
+	Text string `json:"text"`
+}
+
+// handleSendModeratorMessage lets an admin send a user a message over their
+// user-level websocket, wherever they are in the app.
+func (s *APIServer) handleSendModeratorMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+	if s.wsHub == nil || !s.wsHub.IsChatAdmin(user.Username) {
+		permissionDenied(w)
+		return
+	}
+
+	var req ModeratorMessageRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request format"})
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" || len(req.Text) > 500 {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "text must be between 1 and 500 characters"})
+		return
+	}
+
+	username := r.PathValue("username")
+	userID, err := s.getUserIDByUsername(username)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "user not found"})
+		return
+	}
+
+	delivered := s.wsHub.NotifyUser(userID, "moderator_message", map[string]interface{}{
+		"from": user.Username,
+		"text": req.Text,
+	})
+	log.Printf("Moderator message from %s to %s (delivered: %t)", user.Username, username, delivered)
+
+	writeJSON(w, http.StatusOK, map[string]bool{"delivered": delivered})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+)
+
+// handleDigConnection plays dig mode over
+// /ws/game?mode=dig&lines=&height=&messiness=&rise=&seed=. Passing a token
+// records completed digs for the "dig" leaderboard.
+func (s *APIServer) handleDigConnection(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	settings := tetris.DefaultDigSettings()
+
+	intParams := map[string]*int{
+		"lines":  &settings.Lines,
+		"height": &settings.Height,
+		"rise":   &settings.RiseInterval,
+	}
+	for name, target := range intParams {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid " + name})
+				return
+			}
+			*target = parsed
+		}
+	}
+	if value := query.Get("messiness"); value != "" {
+		messiness, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid messiness"})
+			return
+		}
+		settings.Messiness = messiness
+	}
+	if value := query.Get("seed"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid seed"})
+			return
+		}
+		settings.Seed = seed
+	}
+
+	user, ok := s.optionalTokenUser(w, r)
+	if !ok {
+		return
+	}
+
+	game, dig, err := tetris.NewDig(tetris.DefaultRules(), settings)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Failed to upgrade connection:", err)
+		return
+	}
+	defer conn.Close()
+
+	gameLoop(conn, game, &digMode{server: s, dig: dig, user: user})
+}
+
+type digMode struct {
+	server *APIServer
+	dig    *tetris.Dig
+	user   *UserInfo
+}
+
+func (m *digMode) update(game *tetris.Tetris) (bool, map[string]interface{}) {
+	m.dig.Update(game)
+
+	settings := m.dig.Settings()
+	result := map[string]interface{}{
+		"mode":      "dig",
+		"completed": m.dig.Complete(),
+		"remaining": m.dig.Remaining(game),
+		"seed":      settings.Seed,
+	}
+	if !m.dig.Complete() {
+		return false, result
+	}
+
+	seconds := m.dig.CompletionTime().Seconds()
+	result["time"] = seconds
+
+	if m.user != nil {
+		metadata := map[string]interface{}{
+			"time_played":   seconds,
+			"pieces_placed": game.GetState().Stats.PiecesPlaced,
+			"dig": map[string]interface{}{
+				"lines":     settings.Lines,
+				"height":    settings.Height,
+				"messiness": settings.Messiness,
+				"rise":      settings.RiseInterval,
+				"seed":      settings.Seed,
+				"time":      seconds,
+			},
+		}
+		if err := m.server.saveScore(m.user.UserID, "tetris", game.GetScore(), metadata); err != nil {
+			log.Printf("Failed to save dig result: %v", err)
+		}
+	}
+
+	return true, result
+}
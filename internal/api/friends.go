@@ -0,0 +1,246 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/isaacjstriker/devware/internal/database"
+	"github.com/isaacjstriker/devware/internal/multiplayer"
+)
+
+type FriendRequest struct {
+	Username string `json:"username"`
+}
+
+type InviteFriendRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// friendPresence is a friend as shown on the friends list, with what they
+// are doing right now.
+type friendPresence struct {
+	database.Friend
+	Presence multiplayer.Presence `json:"presence"`
+}
+
+func (s *APIServer) presence(userID int) multiplayer.Presence {
+	if s.wsHub == nil {
+		return multiplayer.Presence{Status: multiplayer.PresenceOffline}
+	}
+	return s.wsHub.Presence(userID)
+}
+
+func (s *APIServer) notifyUser(userID int, messageType string, data map[string]interface{}) bool {
+	if s.wsHub == nil {
+		return false
+	}
+	return s.wsHub.NotifyUser(userID, messageType, data)
+}
+
+// friendID reads the other user's ID from the path.
+func friendID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid user ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *APIServer) handleGetFriends(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+
+	friends, err := s.db.GetFriends(user.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to fetch friends"})
+		return
+	}
+	requests, err := s.db.GetFriendRequests(user.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to fetch friend requests"})
+		return
+	}
+
+	withPresence := make([]friendPresence, len(friends))
+	for i, friend := range friends {
+		withPresence[i] = friendPresence{Friend: friend, Presence: s.presence(friend.UserID)}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"friends":  withPresence,
+		"incoming": requests.Incoming,
+		"outgoing": requests.Outgoing,
+	})
+}
+
+func (s *APIServer) handleSendFriendRequest(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+
+	var req FriendRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request format"})
+		return
+	}
+
+	targetID, err := s.getUserIDByUsername(req.Username)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "user not found"})
+		return
+	}
+	if targetID == user.UserID {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "you can't add yourself as a friend"})
+		return
+	}
+
+	accepted, err := s.db.SendFriendRequest(user.UserID, targetID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	notification := map[string]interface{}{
+		"user_id":  user.UserID,
+		"username": user.Username,
+	}
+	if accepted {
+		log.Printf("%s and %s are now friends", user.Username, req.Username)
+		notification["presence"] = s.presence(user.UserID)
+		s.notifyUser(targetID, "friend_accepted", notification)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "accepted"})
+		return
+	}
+
+	s.notifyUser(targetID, "friend_request", notification)
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "pending"})
+}
+
+func (s *APIServer) handleAcceptFriendRequest(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+	requesterID, ok := friendID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.db.AcceptFriendRequest(user.UserID, requesterID); err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return
+	}
+
+	s.notifyUser(requesterID, "friend_accepted", map[string]interface{}{
+		"user_id":  user.UserID,
+		"username": user.Username,
+		"presence": s.presence(user.UserID),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":  requesterID,
+		"presence": s.presence(requesterID),
+	})
+}
+
+// handleRemoveFriend unfriends a user, or declines or cancels a friend
+// request with them.
+func (s *APIServer) handleRemoveFriend(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+	otherID, ok := friendID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.db.RemoveFriend(user.UserID, otherID); err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return
+	}
+
+	s.notifyUser(otherID, "friend_removed", map[string]interface{}{
+		"user_id": user.UserID,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "friend removed"})
+}
+
+// handleInviteFriend invites a friend into the sender's room. The invite
+// carries the room's invite code, so it works for private rooms too.
+func (s *APIServer) handleInviteFriend(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+
+	var req InviteFriendRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request format"})
+		return
+	}
+
+	room, err := s.db.GetMultiplayerRoom(r.PathValue("roomId"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "room not found"})
+		return
+	}
+	if !inRoom(room, user.UserID) {
+		permissionDenied(w)
+		return
+	}
+	if inRoom(room, req.UserID) {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "player already in room"})
+		return
+	}
+	if room.Status != "waiting" {
+		writeJSON(w, http.StatusConflict, apiError{Error: "room is in a game"})
+		return
+	}
+	if len(room.Players) >= room.MaxPlayers {
+		writeJSON(w, http.StatusConflict, apiError{Error: "room is full"})
+		return
+	}
+
+	friends, err := s.db.AreFriends(user.UserID, req.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to check friends"})
+		return
+	}
+	if !friends {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "you can only invite friends"})
+		return
+	}
+
+	delivered := s.notifyUser(req.UserID, "game_invite", map[string]interface{}{
+		"room_id":       room.ID,
+		"room_name":     room.Name,
+		"game_type":     room.GameType,
+		"from_user_id":  user.UserID,
+		"from_username": user.Username,
+		"invite_code":   room.InviteCode,
+		"invite_link":   s.inviteLink(r, room.InviteCode),
+	})
+	if !delivered {
+		writeJSON(w, http.StatusConflict, apiError{Error: "friend is not online"})
+		return
+	}
+	log.Printf("%s invited user %d to room %s", user.Username, req.UserID, room.ID)
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "invite sent"})
+}
+
+func (s *APIServer) handleUserWebSocket(w http.ResponseWriter, r *http.Request) {
+	s.wsHub.ServeUserWS(w, r)
+}
@@ -3,10 +3,12 @@ package api
 import (
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/isaacjstriker/devware/games/tetris"
+	"github.com/isaacjstriker/devware/internal/multiplayer"
 )
 
 var upgrader = websocket.Upgrader{
@@ -17,7 +19,65 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// gameMode adds the rules of a special mode to a solo game.
+type gameMode interface {
+	// update runs after every frame. Once it reports done the game ends, and
+	// result is merged into the game over message.
+	update(game *tetris.Tetris) (done bool, result map[string]interface{})
+}
+
 func (s *APIServer) handleGameConnection(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("mode") {
+	case "puzzle":
+		s.handlePuzzleConnection(w, r)
+		return
+	case "dig":
+		s.handleDigConnection(w, r)
+		return
+	case "master":
+		s.handleMasterConnection(w, r)
+		return
+	}
+
+	roomID := r.URL.Query().Get("room")
+	isMultiplayer := r.URL.Query().Get("multiplayer") == "true"
+
+	rules := tetris.DefaultRules()
+	startingLevel := 0
+	var user *UserInfo
+	if isMultiplayer && roomID != "" {
+		if room, err := s.db.GetMultiplayerRoom(roomID); err == nil {
+			rules = multiplayer.RoomRules(room.Settings)
+			startingLevel = multiplayer.RoomStartingLevel(room.Settings)
+		}
+	} else if value := r.URL.Query().Get("previews"); value != "" {
+		// Solo games may pick their own preview count; rooms use the room's
+		// rules so every player sees the same queue.
+		previews, err := strconv.Atoi(value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid previews"})
+			return
+		}
+		rules.NextPreviews = previews
+	}
+	if !isMultiplayer {
+		var ok bool
+		if user, ok = s.optionalTokenUser(w, r); !ok {
+			return
+		}
+	}
+
+	game, err := tetris.New(rules)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	if startingLevel > 0 {
+		game.SetLevel(startingLevel)
+		log.Printf("Set multiplayer game starting level to %d for room %s", startingLevel, roomID)
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Failed to upgrade connection:", err)
@@ -25,73 +85,137 @@ func (s *APIServer) handleGameConnection(w http.ResponseWriter, r *http.Request)
 	}
 	defer conn.Close()
 
-	roomID := r.URL.Query().Get("room")
-	isMultiplayer := r.URL.Query().Get("multiplayer") == "true"
+	var mode gameMode
+	if user != nil {
+		mode = &scoreMode{server: s, user: user}
+	}
+	gameLoop(conn, game, mode)
+}
 
-	game := tetris.NewTetris()
+// scoreMode records a signed-in player's solo game when it ends, so the
+// stats and finesse report saved with the score are the server's own.
+type scoreMode struct {
+	server *APIServer
+	user   *UserInfo
+}
 
-	if isMultiplayer && roomID != "" {
-		room, err := s.db.GetMultiplayerRoom(roomID)
-		if err == nil && room.Settings != nil {
-			if startingLevel, ok := room.Settings["starting_level"]; ok {
-				if level, ok := startingLevel.(float64); ok {
-					game.SetLevel(int(level))
-					log.Printf("Set multiplayer game starting level to %d for room %s", int(level), roomID)
-				}
-			}
-		}
+func (m *scoreMode) update(game *tetris.Tetris) (bool, map[string]interface{}) {
+	if !game.IsGameOver() {
+		return false, nil
+	}
+
+	stats := game.GetState().Stats
+	metadata := map[string]interface{}{
+		"time_played":   stats.TimePlayed,
+		"pieces_placed": stats.PiecesPlaced,
+		"ppm":           stats.PPM,
+		"line_stats":    stats.LineStats,
+		"finesse":       game.Finesse(),
+	}
+	if err := m.server.saveScore(m.user.UserID, "tetris", game.GetScore(), metadata); err != nil {
+		log.Printf("Failed to save score: %v", err)
+		return true, map[string]interface{}{"saved": false}
 	}
+	return true, map[string]interface{}{"saved": true}
+}
 
-	gameLoop(conn, game)
+// optionalTokenUser returns the user for the "token" query parameter of a
+// solo game, or nil if none was given. An invalid token is rejected, and ok
+// is false once the response has been written.
+func (s *APIServer) optionalTokenUser(w http.ResponseWriter, r *http.Request) (*UserInfo, bool) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return nil, true
+	}
+	user, err := s.validateJWT(token)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "invalid token"})
+		return nil, false
+	}
+	return user, true
+}
+
+// gameMessage is a message from the player's client. The reader goroutine
+// only decodes them; everything that touches the game happens on the loop's
+// goroutine, since Update runs there.
+type gameMessage struct {
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Level int    `json:"level"`
+	Seq   uint32 `json:"seq"`
+	Frame uint64 `json:"frame"`
+	tetris.Handling
 }
 
-func gameLoop(conn *websocket.Conn, game *tetris.Tetris) {
+func gameLoop(conn *websocket.Conn, game *tetris.Tetris, mode gameMode) {
 	ticker := time.NewTicker(50 * time.Millisecond)
 	defer ticker.Stop()
 
-	inputChan := make(chan string)
+	msgChan := make(chan gameMessage)
 	go func() {
-		defer close(inputChan)
+		defer close(msgChan)
 		for {
-			var msg struct {
-				Type  string `json:"type"`
-				Key   string `json:"key"`
-				Level int    `json:"level"`
-			}
+			var msg gameMessage
 			err := conn.ReadJSON(&msg)
 			if err != nil {
 				return
 			}
-			switch msg.Type {
-			case "input":
-				inputChan <- msg.Key
-			case "setLevel":
-				game.SetLevel(msg.Level)
-			}
+			msgChan <- msg
 		}
 	}()
 
 	for {
 		select {
-		case input, ok := <-inputChan:
+		case msg, ok := <-msgChan:
 			if !ok {
 				return
 			}
-			game.HandleWebInput(input)
-
-		case <-ticker.C:
-			if game.IsGameOver() {
-				if err := conn.WriteJSON(map[string]interface{}{"type": "gameOver", "score": game.GetScore()}); err != nil {
-					log.Printf("Error writing game over message: %v", err)
+			switch msg.Type {
+			case "input":
+				if msg.Seq > 0 {
+					game.QueueInput(tetris.Input{Seq: msg.Seq, Frame: msg.Frame, Action: msg.Key})
+				} else {
+					game.HandleWebInput(msg.Key)
 				}
-				return
+			case "setLevel":
+				game.SetLevel(msg.Level)
+			case "setHandling":
+				game.SetHandling(msg.Handling)
 			}
+
+		case <-ticker.C:
 			game.Update()
 
-			err := conn.WriteJSON(game.GetState())
+			state := game.GetState()
+			finished := state.GameOver
+			var result map[string]interface{}
+			if mode != nil {
+				var done bool
+				done, result = mode.update(game)
+				finished = finished || done
+			}
+
+			err := conn.WriteJSON(state)
 			if err != nil {
 				return
 			}
+
+			if finished {
+				gameOver := map[string]interface{}{
+					"type":    "gameOver",
+					"score":   state.Score,
+					"reason":  state.TopOut,
+					"stats":   state.Stats,
+					"finesse": game.Finesse(),
+				}
+				for key, value := range result {
+					gameOver[key] = value
+				}
+				if err := conn.WriteJSON(gameOver); err != nil {
+					log.Printf("Error writing game over message: %v", err)
+				}
+				return
+			}
 		}
 	}
 }
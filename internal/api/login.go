@@ -2,11 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/isaacjstriker/devware/internal/auth"
+	"github.com/isaacjstriker/devware/internal/database"
 )
 
 type LoginRequest struct {
@@ -27,17 +33,45 @@ func (s *APIServer) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := s.clientIP(r)
+
+	// Checking the lockout and recording the result must happen as one step,
+	// or a burst of parallel guesses would all pass the check before any of
+	// their failures were recorded.
+	unlock := s.loginLocks.lock("user:"+req.Username, "ip:"+ip)
+	defer unlock()
+
+	if wait, locked := s.loginRetryAfter(req.Username, ip); wait > 0 {
+		loginThrottled(w, wait, locked)
+		return
+	}
+
+	attempt := database.LoginAttempt{
+		Username:  req.Username,
+		IPAddress: ip,
+		UserAgent: r.UserAgent(),
+	}
+
 	user, passwordHash, err := s.db.GetUserByUsername(req.Username)
 	if err != nil {
+		s.recordLoginAttempt(attempt)
 		permissionDenied(w)
 		return
 	}
+	attempt.UserID = &user.ID
 
 	if !auth.CheckPassword(req.Password, passwordHash) {
+		s.recordLoginAttempt(attempt)
 		permissionDenied(w)
 		return
 	}
 
+	attempt.Success = true
+	s.recordLoginAttempt(attempt)
+	if err := s.db.UpdateLastLogin(user.ID); err != nil {
+		log.Printf("Failed to update last login for user %d: %v", user.ID, err)
+	}
+
 	token, err := createJWT(user.ID, user.Username, s.config.JWTSecret)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to create token"})
@@ -53,6 +87,125 @@ func (s *APIServer) handleLogin(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// loginRetryAfter applies the lockout policy to both the username and the
+// client IP and returns the longer of the two waits. An IP gets more slack
+// than a username since several players can share one address.
+func (s *APIServer) loginRetryAfter(username, ip string) (time.Duration, bool) {
+	now := time.Now()
+	since := now.Add(-s.lockout.Window)
+
+	var wait time.Duration
+	var locked bool
+
+	userFailures, err := s.db.GetUsernameLoginFailures(username, since)
+	if err != nil {
+		log.Printf("Failed to check login failures for %s: %v", username, err)
+	} else {
+		wait, locked = s.lockout.RetryAfter(userFailures.Count, userFailures.LastFailure, now)
+	}
+
+	ipPolicy := s.lockout
+	ipPolicy.FreeAttempts *= 3
+	ipPolicy.LockoutAfter *= 3
+
+	ipFailures, err := s.db.GetIPLoginFailures(ip, since)
+	if err != nil {
+		log.Printf("Failed to check login failures for %s: %v", ip, err)
+	} else if ipWait, ipLocked := ipPolicy.RetryAfter(ipFailures.Count, ipFailures.LastFailure, now); ipWait > wait {
+		wait, locked = ipWait, ipLocked
+	}
+
+	return wait, locked
+}
+
+// keyedLocks serializes work per key, e.g. the logins for one username.
+type keyedLocks struct {
+	mutex sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// lock locks each key in turn and returns a function that unlocks them.
+// Callers must always pass their keys in the same order, so that two of
+// them can't each hold a key the other is waiting for.
+func (k *keyedLocks) lock(keys ...string) func() {
+	held := make([]string, 0, len(keys))
+	for _, key := range keys {
+		k.mutex.Lock()
+		if k.locks == nil {
+			k.locks = make(map[string]*keyedLock)
+		}
+		l, ok := k.locks[key]
+		if !ok {
+			l = &keyedLock{}
+			k.locks[key] = l
+		}
+		l.waiters++
+		k.mutex.Unlock()
+
+		l.Lock()
+		held = append(held, key)
+	}
+
+	return func() {
+		k.mutex.Lock()
+		defer k.mutex.Unlock()
+		for _, key := range held {
+			l := k.locks[key]
+			l.Unlock()
+			l.waiters--
+			if l.waiters == 0 {
+				delete(k.locks, key)
+			}
+		}
+	}
+}
+
+func (s *APIServer) recordLoginAttempt(attempt database.LoginAttempt) {
+	if err := s.db.RecordLoginAttempt(attempt); err != nil {
+		log.Printf("Failed to record login attempt for %s: %v", attempt.Username, err)
+	}
+}
+
+func loginThrottled(w http.ResponseWriter, wait time.Duration, locked bool) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	message := fmt.Sprintf("too many failed login attempts, try again in %d seconds", seconds)
+	if locked {
+		message = fmt.Sprintf("account temporarily locked after repeated failed logins, try again in %d minutes", int(math.Ceil(wait.Minutes())))
+	}
+	writeJSON(w, http.StatusTooManyRequests, apiError{Error: message})
+}
+
+func (s *APIServer) handleGetLoginHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	history, err := s.db.GetLoginHistory(user.UserID, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to fetch login history"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
 func createJWT(userID int, username, secret string) (string, error) {
 	claims := &jwt.MapClaims{
 		"expiresAt": jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 7)), // 1 week
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+)
+
+// handleMasterConnection plays Master mode over /ws/game?mode=master.
+func (s *APIServer) handleMasterConnection(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Failed to upgrade connection:", err)
+		return
+	}
+	defer conn.Close()
+
+	gameLoop(conn, tetris.NewMaster(), masterMode{})
+}
+
+type masterMode struct{}
+
+func (masterMode) update(game *tetris.Tetris) (bool, map[string]interface{}) {
+	master := game.GetState().Master
+	return false, map[string]interface{}{
+		"mode":          "master",
+		"grade":         master.Grade,
+		"level":         master.Level,
+		"section_times": master.SectionTimes,
+		"completed":     game.TopOutReason() == tetris.MasterCompleted,
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func (s *APIServer) handleGetMatch(w http.ResponseWriter, r *http.Request) {
+	matchID := r.PathValue("id")
+	if matchID == "" {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "match id is required"})
+		return
+	}
+
+	match, err := s.db.GetMultiplayerMatch(matchID)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "match not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, match)
+}
+
+func (s *APIServer) handleGetUserMatches(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if username == "" {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "username is required"})
+		return
+	}
+
+	limitStr := r.URL.Query().Get("limit")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	offsetStr := r.URL.Query().Get("offset")
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	userID, err := s.getUserIDByUsername(username)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "user not found"})
+		return
+	}
+
+	matches, err := s.db.GetUserMatches(userID, limit, offset)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to fetch matches"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"matches": matches,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
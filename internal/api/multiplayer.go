@@ -3,11 +3,14 @@ package api
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"io"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/isaacjstriker/devware/internal/auth"
 	"github.com/isaacjstriker/devware/internal/database"
+	"github.com/isaacjstriker/devware/internal/multiplayer"
 )
 
 func generateRoomID() string {
@@ -20,11 +23,17 @@ func generateRoomID() string {
 }
 
 type CreateRoomRequest struct {
-	Name       string                 `json:"name"`
-	GameType   string                 `json:"game_type"`
-	MaxPlayers int                    `json:"max_players"`
-	IsPrivate  bool                   `json:"is_private"`
-	Settings   map[string]interface{} `json:"settings,omitempty"`
+	Name       string `json:"name"`
+	GameType   string `json:"game_type"`
+	MaxPlayers int    `json:"max_players"`
+	IsPrivate  bool   `json:"is_private"`
+	// Password, if set, is asked of players joining without the invite code.
+	Password string                `json:"password,omitempty"`
+	Settings database.RoomSettings `json:"settings"`
+}
+
+type JoinRoomRequest struct {
+	Password string `json:"password,omitempty"`
 }
 
 func (s *APIServer) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
@@ -46,17 +55,46 @@ func (s *APIServer) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("Creating room: parsed request - Name: %s, GameType: %s, MaxPlayers: %d", req.Name, req.GameType, req.MaxPlayers)
 
+	if err := multiplayer.ValidateRoomSettings(&req.Settings, req.MaxPlayers); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	if err := validateRoomPassword(req.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	var passwordHash string
+	if req.Password != "" {
+		var err error
+		passwordHash, err = auth.HashPassword(req.Password)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to create room"})
+			return
+		}
+	}
+
+	inviteCode, err := generateInviteCode()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to create room"})
+		return
+	}
+
 	room := &database.MultiplayerRoom{
 		ID:         generateRoomID(),
 		Name:       req.Name,
 		GameType:   req.GameType,
 		MaxPlayers: req.MaxPlayers,
 		Status:     "waiting",
-		CreatedBy:  user.UserID,
+		HostID:     user.UserID,
 		CreatedAt:  time.Now(),
 		Settings:   req.Settings,
 		Players:    []database.MultiplayerPlayer{},
 		Spectators: []int{},
+
+		IsPrivate:    req.IsPrivate,
+		InviteCode:   inviteCode,
+		PasswordHash: passwordHash,
 	}
 	log.Printf("Creating room: room object created - ID: %s", room.ID)
 
@@ -71,14 +109,15 @@ func (s *APIServer) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Creating room: failed to add creator as player - %v", err)
 	} else {
 		log.Printf("Creating room: successfully added creator as player")
+		s.assignTeam(room.ID, user.UserID)
 	}
 
 	updatedRoom, err := s.db.GetMultiplayerRoom(room.ID)
 	if err != nil {
 		log.Printf("Creating room: failed to get updated room - %v", err)
-		writeJSON(w, http.StatusCreated, room)
+		writeJSON(w, http.StatusCreated, s.withInvite(r, room))
 	} else {
-		writeJSON(w, http.StatusCreated, updatedRoom)
+		writeJSON(w, http.StatusCreated, s.withInvite(r, updatedRoom))
 	}
 }
 
@@ -95,18 +134,43 @@ func (s *APIServer) handleJoinRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var req JoinRoomRequest
+	if err := readJSON(r, &req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request format"})
+		return
+	}
+
+	room, err := s.db.GetMultiplayerRoom(roomID)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "room not found"})
+		return
+	}
+
+	// Private rooms without a password can only be joined by invite code.
+	if !inRoom(room, user.UserID) {
+		if room.HasPassword && !auth.CheckPassword(req.Password, room.PasswordHash) {
+			writeJSON(w, http.StatusForbidden, apiError{Error: "incorrect room password"})
+			return
+		}
+		if room.IsPrivate && !room.HasPassword {
+			writeJSON(w, http.StatusForbidden, apiError{Error: "this room can only be joined with an invite"})
+			return
+		}
+	}
+
 	if err := s.db.JoinMultiplayerRoom(roomID, user.UserID); err != nil {
 		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
 		return
 	}
+	s.assignTeam(roomID, user.UserID)
 
-	room, err := s.db.GetMultiplayerRoom(roomID)
+	room, err = s.db.GetMultiplayerRoom(roomID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to get room"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, room)
+	writeJSON(w, http.StatusOK, s.withInvite(r, room))
 }
 
 func (s *APIServer) handleLeaveRoom(w http.ResponseWriter, r *http.Request) {
@@ -128,10 +192,14 @@ func (s *APIServer) handleLeaveRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.db.LeaveMultiplayerRoom(roomID, user.UserID); err != nil {
+	newHost, err := s.db.LeaveMultiplayerRoom(roomID, user.UserID)
+	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to leave room"})
 		return
 	}
+	if newHost != 0 && s.wsHub != nil {
+		s.wsHub.NotifyHostChanged(roomID, newHost)
+	}
 
 	if room.Status == "playing" || room.Status == "active" {
 		log.Printf("Player %s left active room %s, ending match", user.Username, roomID)
@@ -252,3 +320,29 @@ func (s *APIServer) handlePlayerReady(w http.ResponseWriter, r *http.Request) {
 func (s *APIServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	s.wsHub.ServeWS(w, r)
 }
+
+func (s *APIServer) handleGetProtocolSchema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, multiplayer.ProtocolSchema())
+}
+
+// assignTeam puts a player who has just joined a team room on the smallest
+// team. They can switch with a choose_team message before readying up.
+func (s *APIServer) assignTeam(roomID string, userID int) {
+	room, err := s.db.GetMultiplayerRoom(roomID)
+	if err != nil {
+		log.Printf("Failed to get room %s for team assignment: %v", roomID, err)
+		return
+	}
+	if multiplayer.RoomMode(room.Settings) != multiplayer.ModeTeams {
+		return
+	}
+	for _, player := range room.Players {
+		if player.UserID == userID && player.Team != 0 {
+			return
+		}
+	}
+
+	if err := s.db.SetPlayerTeam(roomID, userID, multiplayer.AssignTeam(room)); err != nil {
+		log.Printf("Failed to assign team in room %s: %v", roomID, err)
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+// inviteAlphabet leaves out letters and digits that are easy to mix up when
+// a code is read aloud or typed from a screenshot.
+const (
+	inviteAlphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	inviteCodeLength = 8
+)
+
+func generateInviteCode() (string, error) {
+	bytes := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	code := make([]byte, inviteCodeLength)
+	for i, b := range bytes {
+		code[i] = inviteAlphabet[int(b)%len(inviteAlphabet)]
+	}
+	return string(code), nil
+}
+
+// normalizeInviteCode accepts codes typed in lower case or split up with
+// dashes and spaces.
+func normalizeInviteCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func validateRoomPassword(password string) error {
+	if password == "" {
+		return nil
+	}
+	if len(password) < 4 || len(password) > 72 {
+		return fmt.Errorf("room password must be between 4 and 72 characters")
+	}
+	return nil
+}
+
+// roomInvite is a room as shown to its own players, with the invite code.
+type roomInvite struct {
+	*database.MultiplayerRoom
+	InviteCode string `json:"invite_code"`
+	InviteLink string `json:"invite_link"`
+}
+
+func (s *APIServer) inviteLink(r *http.Request, code string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if s.config.TrustProxyHeaders {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		}
+	}
+	return fmt.Sprintf("%s://%s/?invite=%s", scheme, r.Host, code)
+}
+
+func (s *APIServer) withInvite(r *http.Request, room *database.MultiplayerRoom) roomInvite {
+	return roomInvite{
+		MultiplayerRoom: room,
+		InviteCode:      room.InviteCode,
+		InviteLink:      s.inviteLink(r, room.InviteCode),
+	}
+}
+
+func inRoom(room *database.MultiplayerRoom, userID int) bool {
+	for _, player := range room.Players {
+		if player.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *APIServer) handleGetRoomInvite(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+
+	room, err := s.db.GetMultiplayerRoom(r.PathValue("roomId"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "room not found"})
+		return
+	}
+	if !inRoom(room, user.UserID) {
+		permissionDenied(w)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"invite_code": room.InviteCode,
+		"invite_link": s.inviteLink(r, room.InviteCode),
+	})
+}
+
+func (s *APIServer) handleJoinRoomByInvite(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+
+	roomID, err := s.db.GetRoomIDByInviteCode(normalizeInviteCode(r.PathValue("code")))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "invite not found"})
+		return
+	}
+
+	if err := s.db.JoinMultiplayerRoom(roomID, user.UserID); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	s.assignTeam(roomID, user.UserID)
+
+	room, err := s.db.GetMultiplayerRoom(roomID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to get room"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.withInvite(r, room))
+}
+
+// hostedRoom loads a waiting room for one of its host's controls, writing
+// the error response and returning nil if the user may not change it.
+func (s *APIServer) hostedRoom(w http.ResponseWriter, r *http.Request) (*UserInfo, *database.MultiplayerRoom) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return nil, nil
+	}
+
+	room, err := s.db.GetMultiplayerRoom(r.PathValue("roomId"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "room not found"})
+		return nil, nil
+	}
+	if room.HostID != user.UserID {
+		permissionDenied(w)
+		return nil, nil
+	}
+	if room.Status != "waiting" {
+		writeJSON(w, http.StatusConflict, apiError{Error: "room is in a game"})
+		return nil, nil
+	}
+	return user, room
+}
+
+type RoomPlayerRequest struct {
+	UserID int `json:"user_id"`
+}
+
+func (s *APIServer) handleKickPlayer(w http.ResponseWriter, r *http.Request) {
+	user, room := s.hostedRoom(w, r)
+	if room == nil {
+		return
+	}
+
+	var req RoomPlayerRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request format"})
+		return
+	}
+	if req.UserID == user.UserID {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "you can't kick yourself"})
+		return
+	}
+
+	var kicked *database.MultiplayerPlayer
+	for i := range room.Players {
+		if room.Players[i].UserID == req.UserID {
+			kicked = &room.Players[i]
+		}
+	}
+	if kicked == nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "player not in room"})
+		return
+	}
+
+	if _, err := s.db.LeaveMultiplayerRoom(room.ID, kicked.UserID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to kick player"})
+		return
+	}
+	log.Printf("Player %s kicked from room %s by %s", kicked.Username, room.ID, user.Username)
+
+	if s.wsHub != nil {
+		s.wsHub.NotifyPlayerKicked(room.ID, kicked.UserID, kicked.Username)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "player kicked"})
+}
+
+func (s *APIServer) handleTransferRoom(w http.ResponseWriter, r *http.Request) {
+	user, room := s.hostedRoom(w, r)
+	if room == nil {
+		return
+	}
+
+	var req RoomPlayerRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request format"})
+		return
+	}
+	if req.UserID == user.UserID {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "you are already the host"})
+		return
+	}
+	if !inRoom(room, req.UserID) {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "player not in room"})
+		return
+	}
+
+	if err := s.db.SetRoomHost(room.ID, req.UserID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to transfer room"})
+		return
+	}
+	log.Printf("Room %s transferred from user %d to user %d", room.ID, user.UserID, req.UserID)
+
+	if s.wsHub != nil {
+		s.wsHub.NotifyHostChanged(room.ID, req.UserID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "room transferred"})
+}
+
+type LockRoomRequest struct {
+	Locked bool `json:"locked"`
+}
+
+func (s *APIServer) handleLockRoom(w http.ResponseWriter, r *http.Request) {
+	_, room := s.hostedRoom(w, r)
+	if room == nil {
+		return
+	}
+
+	var req LockRoomRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request format"})
+		return
+	}
+
+	if err := s.db.SetRoomLocked(room.ID, req.Locked); err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to lock room"})
+		return
+	}
+
+	if s.wsHub != nil {
+		s.wsHub.NotifyRoomUpdated(room.ID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"locked": req.Locked})
+}
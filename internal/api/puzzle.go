@@ -0,0 +1,96 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+)
+
+func (s *APIServer) handleGetPuzzles(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, tetris.Puzzles())
+}
+
+func (s *APIServer) handleGetPuzzle(w http.ResponseWriter, r *http.Request) {
+	puzzle, ok := tetris.FindPuzzle(r.PathValue("puzzleId"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "puzzle not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, puzzle)
+}
+
+func (s *APIServer) handleGetPuzzleCompletions(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "user not found in context"})
+		return
+	}
+
+	completions, err := s.db.GetPuzzleCompletions(user.UserID)
+	if err != nil {
+		log.Printf("Failed to get puzzle completions: %v", err)
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to get puzzle completions"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, completions)
+}
+
+// handlePuzzleConnection plays a puzzle over /ws/game?mode=puzzle&id=...
+// Passing a token records the completion against the user.
+func (s *APIServer) handlePuzzleConnection(w http.ResponseWriter, r *http.Request) {
+	puzzle, ok := tetris.FindPuzzle(r.URL.Query().Get("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "puzzle not found"})
+		return
+	}
+
+	user, ok := s.optionalTokenUser(w, r)
+	if !ok {
+		return
+	}
+
+	game, err := puzzle.NewGame()
+	if err != nil {
+		log.Printf("Failed to set up puzzle %s: %v", puzzle.ID, err)
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to set up puzzle"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Failed to upgrade connection:", err)
+		return
+	}
+	defer conn.Close()
+
+	gameLoop(conn, game, &puzzleMode{server: s, puzzle: puzzle, user: user})
+}
+
+type puzzleMode struct {
+	server *APIServer
+	puzzle tetris.Puzzle
+	user   *UserInfo
+}
+
+func (m *puzzleMode) update(game *tetris.Tetris) (bool, map[string]interface{}) {
+	status := m.puzzle.Status(game)
+	if status == tetris.PuzzlePlaying {
+		return false, nil
+	}
+
+	piecesUsed := game.GetState().Stats.PiecesPlaced
+	if status == tetris.PuzzleSolved && m.user != nil {
+		if err := m.server.db.RecordPuzzleCompletion(m.user.UserID, m.puzzle.ID, piecesUsed); err != nil {
+			log.Printf("Failed to record puzzle completion: %v", err)
+		}
+	}
+
+	return true, map[string]interface{}{
+		"mode":        "puzzle",
+		"puzzle_id":   m.puzzle.ID,
+		"status":      status,
+		"pieces_used": piecesUsed,
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/isaacjstriker/devware/internal/ratelimit"
+)
+
+type rateLimiters struct {
+	ip    *ratelimit.Limiter
+	user  *ratelimit.Limiter
+	login *ratelimit.Limiter
+	// register is separate from login so signing up doesn't use up the
+	// attempts someone has to log in.
+	register *ratelimit.Limiter
+	rooms    *ratelimit.Limiter
+}
+
+// limitRequests applies the general per-IP and per-user limits to every
+// /api/ route.
+func (s *APIServer) limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, retryAfter := s.limiters.ip.Allow("ip:" + s.clientIP(r)); !ok {
+			tooManyRequests(w, retryAfter)
+			return
+		}
+
+		if userInfo, ok := s.userFromRequest(r); ok {
+			if ok, retryAfter := s.limiters.user.Allow(fmt.Sprintf("user:%d", userInfo.UserID)); !ok {
+				tooManyRequests(w, retryAfter)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit guards a single route with a stricter limiter, keyed by client IP
+// and, when the request carries a valid token, by user as well.
+func rateLimit(s *APIServer, limiter *ratelimit.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, retryAfter := limiter.Allow("ip:" + s.clientIP(r)); !ok {
+			tooManyRequests(w, retryAfter)
+			return
+		}
+
+		if userInfo, ok := s.userFromRequest(r); ok {
+			if ok, retryAfter := limiter.Allow(fmt.Sprintf("user:%d", userInfo.UserID)); !ok {
+				tooManyRequests(w, retryAfter)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+	writeJSON(w, http.StatusTooManyRequests, apiError{Error: "too many requests"})
+}
+
+func (s *APIServer) clientIP(r *http.Request) string {
+	if s.config.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// userFromRequest returns the user behind a bearer token without rejecting
+// the request when there is none.
+func (s *APIServer) userFromRequest(r *http.Request) (*UserInfo, bool) {
+	if user, ok := GetUserFromContext(r.Context()); ok {
+		return user, true
+	}
+
+	const bearerPrefix = "Bearer "
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, bearerPrefix) {
+		return nil, false
+	}
+
+	userInfo, err := s.validateJWT(authHeader[len(bearerPrefix):])
+	if err != nil {
+		return nil, false
+	}
+	return userInfo, true
+}
@@ -11,6 +11,15 @@ type ScoreSubmission struct {
 	Metadata map[string]interface{} `json:"metadata"`
 }
 
+// saveScore saves a score, letting the hub tell the player about any
+// achievements it unlocked.
+func (s *APIServer) saveScore(userID int, gameType string, score int, metadata map[string]interface{}) error {
+	if s.wsHub == nil {
+		return s.db.SaveGameScore(userID, gameType, score, metadata)
+	}
+	return s.wsHub.SaveScore(userID, gameType, score, metadata)
+}
+
 func (s *APIServer) handleSubmitScore(w http.ResponseWriter, r *http.Request) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
@@ -47,7 +56,13 @@ func (s *APIServer) handleSubmitScore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.db.SaveGameScore(userInfo.UserID, submission.GameType, submission.Score, submission.Metadata)
+	// Dig and co-op results and finesse reports are only recorded by the
+	// server when those games end.
+	delete(submission.Metadata, "dig")
+	delete(submission.Metadata, "coop")
+	delete(submission.Metadata, "finesse")
+
+	err = s.saveScore(userInfo.UserID, submission.GameType, submission.Score, submission.Metadata)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to save score"})
 		return
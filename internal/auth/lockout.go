@@ -0,0 +1,61 @@
+package auth
+
+import "time"
+
+// LockoutPolicy describes how repeated login failures slow down and
+// eventually block further attempts.
+type LockoutPolicy struct {
+	// Window is how far back failures are counted.
+	Window time.Duration
+	// FreeAttempts is the number of failures allowed before any delay.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure past FreeAttempts; it
+	// doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter is the number of failures that locks the account (or IP)
+	// for LockoutDuration.
+	LockoutAfter    int
+	LockoutDuration time.Duration
+}
+
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		Window:          time.Hour,
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+	}
+}
+
+// RetryAfter returns how long the caller has to wait before another attempt
+// is allowed and whether that wait is a full lockout. A zero duration means
+// the attempt may proceed now.
+func (p LockoutPolicy) RetryAfter(failures int, lastFailure time.Time, now time.Time) (time.Duration, bool) {
+	if failures <= p.FreeAttempts || lastFailure.IsZero() {
+		return 0, false
+	}
+
+	locked := p.LockoutAfter > 0 && failures >= p.LockoutAfter
+
+	var delay time.Duration
+	if locked {
+		delay = p.LockoutDuration
+	} else {
+		delay = p.BaseDelay
+		for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+
+	wait := lastFailure.Add(delay).Sub(now)
+	if wait <= 0 {
+		return 0, false
+	}
+	return wait, locked
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyRetryAfter(t *testing.T) {
+	now := time.Now()
+	policy := DefaultLockoutPolicy()
+
+	noLockout := policy
+	noLockout.LockoutAfter = 0
+
+	tests := []struct {
+		name        string
+		policy      LockoutPolicy
+		failures    int
+		lastFailure time.Time
+		wait        time.Duration
+		locked      bool
+	}{
+		{name: "no failures", policy: policy, failures: 0, lastFailure: now},
+		{name: "free attempts", policy: policy, failures: 3, lastFailure: now},
+		{name: "no last failure", policy: policy, failures: 5},
+		{name: "first delay", policy: policy, failures: 4, lastFailure: now, wait: time.Second},
+		{name: "delay doubles", policy: policy, failures: 5, lastFailure: now, wait: 2 * time.Second},
+		{name: "delay doubles again", policy: policy, failures: 9, lastFailure: now, wait: 32 * time.Second},
+		{name: "delay partly served", policy: policy, failures: 6, lastFailure: now.Add(-time.Second), wait: 3 * time.Second},
+		{name: "delay served", policy: policy, failures: 6, lastFailure: now.Add(-time.Minute)},
+		{name: "delay capped", policy: noLockout, failures: 30, lastFailure: now, wait: 5 * time.Minute},
+		{name: "locked out", policy: policy, failures: 10, lastFailure: now, wait: 15 * time.Minute, locked: true},
+		{name: "lockout partly served", policy: policy, failures: 12, lastFailure: now.Add(-10 * time.Minute), wait: 5 * time.Minute, locked: true},
+		{name: "lockout served", policy: policy, failures: 12, lastFailure: now.Add(-15 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, locked := tt.policy.RetryAfter(tt.failures, tt.lastFailure, now)
+			if wait != tt.wait || locked != tt.locked {
+				t.Errorf("RetryAfter(%d) = %v, %v; want %v, %v", tt.failures, wait, locked, tt.wait, tt.locked)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -20,6 +21,39 @@ type Config struct {
 	ServerHost  string
 	SupabaseURL string
 	SupabaseKey string
+
+	// TrustProxyHeaders makes the rate limiter key clients by X-Forwarded-For,
+	// which is only safe behind a reverse proxy that sets it.
+	TrustProxyHeaders bool
+
+	RateLimitPerMinute         int
+	RateLimitBurst             int
+	LoginRateLimitPerMinute    int
+	LoginRateLimitBurst        int
+	RegisterRateLimitPerMinute int
+	RegisterRateLimitBurst     int
+	RoomRateLimitPerMinute     int
+	RoomRateLimitBurst         int
+
+	LoginLockoutAfter   int
+	LoginLockoutMinutes int
+
+	WSMessagesPerSecond   int
+	WSMessageBurst        int
+	WSRateWarnAfter       int
+	WSRateDisconnectAfter int
+
+	// AdminUsers are the usernames allowed to moderate chat.
+	AdminUsers []string
+
+	ChatMessagesPerMinute int
+	ChatMessageBurst      int
+	ChatHistorySize       int
+	// ChatPersist keeps chat messages in the database so room history
+	// survives restarts; otherwise it is only held in memory.
+	ChatPersist bool
+	// ChatBlockedWords are masked out of chat messages.
+	ChatBlockedWords []string
 }
 
 func Load() (*Config, error) {
@@ -34,6 +68,33 @@ func Load() (*Config, error) {
 		ServerPort:  getPort(),
 		ServerHost:  getEnv("SERVER_HOST", "0.0.0.0"),
 		JWTSecret:   os.Getenv("JWT_SECRET"),
+
+		TrustProxyHeaders: getEnvAsBool("TRUST_PROXY_HEADERS", false),
+
+		RateLimitPerMinute:         getEnvAsInt("RATE_LIMIT_PER_MINUTE", 120),
+		RateLimitBurst:             getEnvAsInt("RATE_LIMIT_BURST", 30),
+		LoginRateLimitPerMinute:    getEnvAsInt("LOGIN_RATE_LIMIT_PER_MINUTE", 10),
+		LoginRateLimitBurst:        getEnvAsInt("LOGIN_RATE_LIMIT_BURST", 5),
+		RegisterRateLimitPerMinute: getEnvAsInt("REGISTER_RATE_LIMIT_PER_MINUTE", 5),
+		RegisterRateLimitBurst:     getEnvAsInt("REGISTER_RATE_LIMIT_BURST", 3),
+		RoomRateLimitPerMinute:     getEnvAsInt("ROOM_RATE_LIMIT_PER_MINUTE", 6),
+		RoomRateLimitBurst:         getEnvAsInt("ROOM_RATE_LIMIT_BURST", 3),
+
+		LoginLockoutAfter:   getEnvAsInt("LOGIN_LOCKOUT_AFTER", 10),
+		LoginLockoutMinutes: getEnvAsInt("LOGIN_LOCKOUT_MINUTES", 15),
+
+		WSMessagesPerSecond:   getEnvAsInt("WS_MESSAGES_PER_SECOND", 30),
+		WSMessageBurst:        getEnvAsInt("WS_MESSAGE_BURST", 60),
+		WSRateWarnAfter:       getEnvAsInt("WS_RATE_WARN_AFTER", 10),
+		WSRateDisconnectAfter: getEnvAsInt("WS_RATE_DISCONNECT_AFTER", 100),
+
+		AdminUsers: getEnvAsList("ADMIN_USERS"),
+
+		ChatMessagesPerMinute: getEnvAsInt("CHAT_MESSAGES_PER_MINUTE", 20),
+		ChatMessageBurst:      getEnvAsInt("CHAT_MESSAGE_BURST", 5),
+		ChatHistorySize:       getEnvAsInt("CHAT_HISTORY_SIZE", 100),
+		ChatPersist:           getEnvAsBool("CHAT_PERSIST", false),
+		ChatBlockedWords:      getEnvAsList("CHAT_BLOCKED_WORDS"),
 	}
 
 	if cfg.JWTSecret == "" {
@@ -104,6 +165,17 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsList splits a comma-separated variable, dropping empty entries.
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getPort() int {
 	if port := os.Getenv("PORT"); port != "" {
 		if parsed, err := strconv.Atoi(port); err == nil {
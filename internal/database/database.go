@@ -10,6 +10,8 @@ import (
 
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
+
+	"github.com/isaacjstriker/devware/games/tetris"
 )
 
 type DB struct {
@@ -34,18 +36,71 @@ type GameScore struct {
 }
 
 type MultiplayerRoom struct {
-	ID         string                 `json:"id"`
-	Name       string                 `json:"name"`
-	GameType   string                 `json:"game_type"`
-	MaxPlayers int                    `json:"max_players"`
-	Status     string                 `json:"status"`
-	CreatedBy  int                    `json:"created_by"`
-	CreatedAt  time.Time              `json:"created_at"`
-	StartedAt  *time.Time             `json:"started_at,omitempty"`
-	FinishedAt *time.Time             `json:"finished_at,omitempty"`
-	Settings   map[string]interface{} `json:"settings,omitempty"`
-	Players    []MultiplayerPlayer    `json:"players,omitempty"`
-	Spectators []int                  `json:"spectators,omitempty"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	GameType   string `json:"game_type"`
+	MaxPlayers int    `json:"max_players"`
+	Status     string `json:"status"`
+	// HostID is the player who runs the room: only they can change its
+	// settings or start a game. It starts as the room's creator and moves
+	// to another player when the host leaves.
+	HostID     int                 `json:"host_id"`
+	CreatedAt  time.Time           `json:"created_at"`
+	StartedAt  *time.Time          `json:"started_at,omitempty"`
+	FinishedAt *time.Time          `json:"finished_at,omitempty"`
+	Settings   RoomSettings        `json:"settings"`
+	Players    []MultiplayerPlayer `json:"players,omitempty"`
+	Spectators []int               `json:"spectators,omitempty"`
+	// CurrentPlayers is filled in by room listings.
+	CurrentPlayers int `json:"current_players,omitempty"`
+	// IsPrivate rooms are left out of room listings. IsLocked rooms take
+	// no new players, whatever they join with.
+	IsPrivate   bool `json:"is_private"`
+	IsLocked    bool `json:"is_locked"`
+	HasPassword bool `json:"has_password"`
+	// InviteCode joins the room without its password. It is only shown to
+	// the room's players.
+	InviteCode   string `json:"-"`
+	PasswordHash string `json:"-"`
+}
+
+// RoomSettings are the options a room plays with. Zero values mean the
+// default; multiplayer.ValidateRoomSettings checks them and fills the
+// defaults in before a room is created.
+type RoomSettings struct {
+	StartingLevel int           `json:"starting_level,omitempty"`
+	Mode          string        `json:"mode,omitempty"`
+	Rules         *tetris.Rules `json:"rules,omitempty"`
+	// Teams is the number of teams in a team room.
+	Teams int `json:"teams,omitempty"`
+	// FirstTo is the number of round wins that take a set.
+	FirstTo int `json:"first_to,omitempty"`
+	// Countdown is the seconds counted down before a game starts. It is a
+	// pointer because zero, starting at once, is a valid choice.
+	Countdown *int `json:"countdown,omitempty"`
+}
+
+// UnmarshalJSON reads rules as an overlay on tetris.DefaultRules, so a room
+// only has to give the rules it changes. The result is not validated.
+func (s *RoomSettings) UnmarshalJSON(data []byte) error {
+	type plain RoomSettings
+	aux := struct {
+		*plain
+		Rules json.RawMessage `json:"rules"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.Rules = nil
+	if len(aux.Rules) > 0 && string(aux.Rules) != "null" {
+		rules := tetris.DefaultRules()
+		if err := json.Unmarshal(aux.Rules, &rules); err != nil {
+			return err
+		}
+		s.Rules = &rules
+	}
+	return nil
 }
 
 type MultiplayerPlayer struct {
@@ -58,17 +113,103 @@ type MultiplayerPlayer struct {
 	FinishedAt *time.Time             `json:"finished_at,omitempty"`
 	GameState  map[string]interface{} `json:"game_state,omitempty"`
 	IsReady    bool                   `json:"is_ready"`
+	// Team is the player's team in team rooms, numbered from 1, or 0.
+	Team int `json:"team"`
 }
 
 type MultiplayerGame struct {
-	ID         string              `json:"id"`
-	RoomID     string              `json:"room_id"`
-	GameType   string              `json:"game_type"`
-	Duration   int                 `json:"duration"`
-	StartedAt  time.Time           `json:"started_at"`
-	FinishedAt time.Time           `json:"finished_at"`
-	Winner     *int                `json:"winner,omitempty"`
-	Players    []MultiplayerPlayer `json:"players"`
+	ID         string        `json:"id"`
+	RoomID     string        `json:"room_id"`
+	GameType   string        `json:"game_type"`
+	Duration   int           `json:"duration"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Winner     *int          `json:"winner,omitempty"`
+	Players    []MatchPlayer `json:"players"`
+	// SetID links a round of a first-to-N set to its MatchSet.
+	SetID    *string                `json:"set_id,omitempty"`
+	Settings *RoomSettings          `json:"settings,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// MatchPlayer is one player's result in a finished multiplayer game.
+type MatchPlayer struct {
+	UserID    int                    `json:"user_id"`
+	Username  string                 `json:"username"`
+	Team      int                    `json:"team,omitempty"`
+	Placement int                    `json:"placement"`
+	Score     int                    `json:"score"`
+	Lines     int                    `json:"lines"`
+	Stats     map[string]interface{} `json:"stats,omitempty"`
+}
+
+// MatchSet is a first-to-N series of games played in one room. Wins counts
+// the rounds each user has won.
+type MatchSet struct {
+	ID         string      `json:"id"`
+	RoomID     string      `json:"room_id"`
+	FirstTo    int         `json:"first_to"`
+	Wins       map[int]int `json:"wins"`
+	Winner     *int        `json:"winner,omitempty"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+type LoginAttempt struct {
+	ID          int       `json:"id"`
+	UserID      *int      `json:"user_id,omitempty"`
+	Username    string    `json:"username"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	Success     bool      `json:"success"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// LoginFailures summarises the failed login attempts since the last
+// successful one.
+type LoginFailures struct {
+	Count       int
+	LastFailure time.Time
+}
+
+// PuzzleCompletion is a user's best result on a training puzzle.
+type PuzzleCompletion struct {
+	PuzzleID       string    `json:"puzzle_id"`
+	PiecesUsed     int       `json:"pieces_used"`
+	TimesCompleted int       `json:"times_completed"`
+	CompletedAt    time.Time `json:"completed_at"`
+}
+
+// ChatMessage is a message sent to a room's chat or the lobby. Channel is the
+// room ID, or the lobby's.
+type ChatMessage struct {
+	ID       string    `json:"id"`
+	Channel  string    `json:"-"`
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Text     string    `json:"text"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// Kinds of chat ignore. A mute hides the other user's messages; a block also
+// hides yours from them.
+const (
+	ChatMute  = "mute"
+	ChatBlock = "block"
+)
+
+// Friend is another user on a user's friends list, or in a friend request
+// to or from them.
+type Friend struct {
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Since    time.Time `json:"since"`
+}
+
+// FriendRequests are a user's pending friend requests.
+type FriendRequests struct {
+	Incoming []Friend `json:"incoming"`
+	Outgoing []Friend `json:"outgoing"`
 }
 
 type LeaderboardEntry struct {
@@ -161,8 +302,16 @@ func (db *DB) CreateTables() error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			started_at TIMESTAMP,
 			finished_at TIMESTAMP,
-			settings JSONB
+			settings JSONB,
+			is_private BOOLEAN NOT NULL DEFAULT false,
+			is_locked BOOLEAN NOT NULL DEFAULT false,
+			invite_code VARCHAR(12) UNIQUE,
+			password_hash VARCHAR(255)
 		)`,
+		`ALTER TABLE multiplayer_rooms ADD COLUMN IF NOT EXISTS is_private BOOLEAN NOT NULL DEFAULT false`,
+		`ALTER TABLE multiplayer_rooms ADD COLUMN IF NOT EXISTS is_locked BOOLEAN NOT NULL DEFAULT false`,
+		`ALTER TABLE multiplayer_rooms ADD COLUMN IF NOT EXISTS invite_code VARCHAR(12) UNIQUE`,
+		`ALTER TABLE multiplayer_rooms ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255)`,
 		`CREATE TABLE IF NOT EXISTS multiplayer_players (
 			room_id VARCHAR(50) REFERENCES multiplayer_rooms(id) ON DELETE CASCADE,
 			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
@@ -173,17 +322,83 @@ func (db *DB) CreateTables() error {
 			finished_at TIMESTAMP,
 			game_state JSONB,
 			is_ready BOOLEAN DEFAULT FALSE,
+			team INTEGER DEFAULT 0,
 			PRIMARY KEY (room_id, user_id)
 		)`,
+		`ALTER TABLE multiplayer_players ADD COLUMN IF NOT EXISTS team INTEGER DEFAULT 0`,
+		`CREATE TABLE IF NOT EXISTS multiplayer_sets (
+			id VARCHAR(50) PRIMARY KEY,
+			room_id VARCHAR(50) NOT NULL,
+			first_to INTEGER NOT NULL,
+			wins JSONB,
+			winner INTEGER REFERENCES users(id),
+			started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMP
+		)`,
 		`CREATE TABLE IF NOT EXISTS multiplayer_games (
 			id VARCHAR(50) PRIMARY KEY,
-			room_id VARCHAR(50) REFERENCES multiplayer_rooms(id) ON DELETE CASCADE,
+			room_id VARCHAR(50),
 			game_type VARCHAR(50) NOT NULL,
 			duration INTEGER NOT NULL,
 			started_at TIMESTAMP NOT NULL,
 			finished_at TIMESTAMP NOT NULL,
 			winner INTEGER REFERENCES users(id),
-			metadata JSONB
+			metadata JSONB,
+			set_id VARCHAR(50) REFERENCES multiplayer_sets(id) ON DELETE SET NULL
+		)`,
+		`ALTER TABLE multiplayer_games ADD COLUMN IF NOT EXISTS set_id VARCHAR(50) REFERENCES multiplayer_sets(id) ON DELETE SET NULL`,
+		`ALTER TABLE multiplayer_games ADD COLUMN IF NOT EXISTS settings JSONB`,
+		// Match history outlives its room, like multiplayer_sets.
+		`ALTER TABLE multiplayer_games DROP CONSTRAINT IF EXISTS multiplayer_games_room_id_fkey`,
+		`CREATE TABLE IF NOT EXISTS multiplayer_game_players (
+			game_id VARCHAR(50) REFERENCES multiplayer_games(id) ON DELETE CASCADE,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			team INTEGER DEFAULT 0,
+			placement INTEGER NOT NULL,
+			score INTEGER NOT NULL DEFAULT 0,
+			lines INTEGER NOT NULL DEFAULT 0,
+			stats JSONB,
+			PRIMARY KEY (game_id, user_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS login_attempts (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			username VARCHAR(50) NOT NULL,
+			ip_address VARCHAR(64) NOT NULL,
+			user_agent VARCHAR(255),
+			success BOOLEAN NOT NULL,
+			attempted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS puzzle_completions (
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			puzzle_id VARCHAR(64) NOT NULL,
+			pieces_used INTEGER NOT NULL,
+			times_completed INTEGER DEFAULT 1,
+			completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, puzzle_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS chat_messages (
+			id VARCHAR(50) PRIMARY KEY,
+			channel VARCHAR(50) NOT NULL,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			text TEXT NOT NULL,
+			sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			deleted_at TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS chat_ignores (
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			target_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			kind VARCHAR(10) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, target_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS friendships (
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			friend_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			accepted_at TIMESTAMP,
+			PRIMARY KEY (user_id, friend_id)
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_game_scores_user_game ON game_scores(user_id, game_type)`,
 		`CREATE INDEX IF NOT EXISTS idx_game_scores_type_score ON game_scores(game_type, score DESC)`,
@@ -191,6 +406,13 @@ func (db *DB) CreateTables() error {
 		`CREATE INDEX IF NOT EXISTS idx_multiplayer_rooms_status ON multiplayer_rooms(status, created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_multiplayer_players_room ON multiplayer_players(room_id, joined_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_multiplayer_games_type ON multiplayer_games(game_type, finished_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_multiplayer_games_set ON multiplayer_games(set_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_multiplayer_game_players_user ON multiplayer_game_players(user_id, game_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_messages_channel ON chat_messages(channel, sent_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_friendships_friend ON friendships(friend_id, status)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username, attempted_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address, attempted_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_attempts_user ON login_attempts(user_id, attempted_at DESC)`,
 	}
 
 	for _, query := range queries {
@@ -252,6 +474,169 @@ func (db *DB) GetUserByUsername(username string) (*User, string, error) {
 	return &user, passwordHash, nil
 }
 
+func (db *DB) UpdateLastLogin(userID int) error {
+	query := `UPDATE users SET last_login = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := db.conn.Exec(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last login: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) RecordLoginAttempt(attempt LoginAttempt) error {
+	query := `
+		INSERT INTO login_attempts (user_id, username, ip_address, user_agent, success)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	userAgent := attempt.UserAgent
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	_, err := db.conn.Exec(query, attempt.UserID, attempt.Username, attempt.IPAddress, userAgent, attempt.Success)
+	if err != nil {
+		return fmt.Errorf("failed to record login attempt: %w", err)
+	}
+	return nil
+}
+
+// GetUsernameLoginFailures counts failed logins for a username since its last
+// successful login, ignoring anything older than since.
+func (db *DB) GetUsernameLoginFailures(username string, since time.Time) (LoginFailures, error) {
+	query := `
+		SELECT COUNT(*), MAX(attempted_at)
+		FROM login_attempts
+		WHERE username = $1 AND success = FALSE AND attempted_at > $2
+		  AND attempted_at > COALESCE(
+		      (SELECT MAX(attempted_at) FROM login_attempts WHERE username = $1 AND success = TRUE),
+		      '-infinity'::timestamp)
+	`
+	return db.scanLoginFailures(query, username, since)
+}
+
+// GetIPLoginFailures counts failed logins from an IP address since since.
+// Unlike a username's failures these are not cleared by a successful login,
+// or someone could keep guessing other accounts' passwords by logging into
+// their own every few tries.
+func (db *DB) GetIPLoginFailures(ipAddress string, since time.Time) (LoginFailures, error) {
+	query := `
+		SELECT COUNT(*), MAX(attempted_at)
+		FROM login_attempts
+		WHERE ip_address = $1 AND success = FALSE AND attempted_at > $2
+	`
+	return db.scanLoginFailures(query, ipAddress, since)
+}
+
+func (db *DB) scanLoginFailures(query string, key string, since time.Time) (LoginFailures, error) {
+	var failures LoginFailures
+	var lastFailure sql.NullTime
+
+	err := db.conn.QueryRow(query, key, since).Scan(&failures.Count, &lastFailure)
+	if err != nil {
+		return failures, fmt.Errorf("failed to count login failures: %w", err)
+	}
+	if lastFailure.Valid {
+		failures.LastFailure = lastFailure.Time
+	}
+
+	return failures, nil
+}
+
+// PruneLoginAttempts deletes attempts that no longer count towards a
+// lockout: those for usernames that don't exist once they are older than
+// unknownBefore, and everyone else's once they are older than before, which
+// is kept longer so users can still see their login history.
+func (db *DB) PruneLoginAttempts(unknownBefore, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM login_attempts
+		WHERE (user_id IS NULL AND attempted_at < $1) OR attempted_at < $2
+	`
+	result, err := db.conn.Exec(query, unknownBefore, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune login attempts: %w", err)
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pruned login attempts: %w", err)
+	}
+	return pruned, nil
+}
+
+func (db *DB) GetLoginHistory(userID int, limit int) ([]LoginAttempt, error) {
+	query := `
+		SELECT id, user_id, username, ip_address, COALESCE(user_agent, ''), success, attempted_at
+		FROM login_attempts
+		WHERE user_id = $1
+		ORDER BY attempted_at DESC
+		LIMIT $2
+	`
+
+	rows, err := db.conn.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []LoginAttempt{}
+	for rows.Next() {
+		var attempt LoginAttempt
+		err := rows.Scan(
+			&attempt.ID, &attempt.UserID, &attempt.Username, &attempt.IPAddress,
+			&attempt.UserAgent, &attempt.Success, &attempt.AttemptedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan login attempt: %w", err)
+		}
+		history = append(history, attempt)
+	}
+
+	return history, nil
+}
+
+// RecordPuzzleCompletion stores a solved puzzle, keeping the fewest pieces
+// the user has needed and counting how many times they have solved it.
+func (db *DB) RecordPuzzleCompletion(userID int, puzzleID string, piecesUsed int) error {
+	query := `
+		INSERT INTO puzzle_completions (user_id, puzzle_id, pieces_used)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, puzzle_id) DO UPDATE SET
+			pieces_used = LEAST(puzzle_completions.pieces_used, EXCLUDED.pieces_used),
+			times_completed = puzzle_completions.times_completed + 1,
+			completed_at = CURRENT_TIMESTAMP
+	`
+	if _, err := db.conn.Exec(query, userID, puzzleID, piecesUsed); err != nil {
+		return fmt.Errorf("failed to record puzzle completion: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetPuzzleCompletions(userID int) ([]PuzzleCompletion, error) {
+	query := `
+		SELECT puzzle_id, pieces_used, times_completed, completed_at
+		FROM puzzle_completions
+		WHERE user_id = $1
+		ORDER BY completed_at DESC
+	`
+
+	rows, err := db.conn.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get puzzle completions: %w", err)
+	}
+	defer rows.Close()
+
+	completions := []PuzzleCompletion{}
+	for rows.Next() {
+		var completion PuzzleCompletion
+		err := rows.Scan(&completion.PuzzleID, &completion.PiecesUsed, &completion.TimesCompleted, &completion.CompletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan puzzle completion: %w", err)
+		}
+		completions = append(completions, completion)
+	}
+
+	return completions, nil
+}
+
 func (db *DB) SaveGameScore(userID int, gameType string, score int, metadata map[string]interface{}) error {
 	query := `
 		INSERT INTO game_scores (user_id, game_type, score, metadata, played_at)
@@ -294,6 +679,10 @@ func (db *DB) GetFilteredLeaderboard(gameType string, limit int, filter Leaderbo
 
 	var orderBy string
 	var selectFields string
+	// Dig runs are only ranked in their own category, and co-op games,
+	// whose score is shared by the whole team, aren't ranked at all; neither
+	// is comparable with regular games.
+	categoryCondition := "AND NOT COALESCE(gs.metadata ?| ARRAY['dig', 'coop'], FALSE)"
 
 	switch filter.Category {
 	case "speed":
@@ -335,6 +724,20 @@ func (db *DB) GetFilteredLeaderboard(gameType string, limit int, filter Leaderbo
 			AVG(COALESCE((gs.metadata->>'ppm')::float, 0)) as avg_ppm
 		`
 		orderBy = "best_time DESC NULLS LAST"
+	case "dig":
+		selectFields = `
+			u.username,
+			MAX(gs.score) as best_score,
+			AVG(gs.score) as avg_score,
+			COUNT(gs.id) as games_played,
+			MAX(gs.played_at) as last_played,
+			MIN((gs.metadata->'dig'->>'time')::float) as best_time,
+			AVG((gs.metadata->'dig'->>'time')::float) as total_time,
+			SUM(COALESCE((gs.metadata->'dig'->>'lines')::int, 0)) as total_lines,
+			AVG(COALESCE((gs.metadata->>'ppm')::float, 0)) as avg_ppm
+		`
+		categoryCondition = "AND gs.metadata ? 'dig'"
+		orderBy = "best_time ASC NULLS LAST"
 	default:
 		selectFields = `
 			u.username,
@@ -368,7 +771,7 @@ func (db *DB) GetFilteredLeaderboard(gameType string, limit int, filter Leaderbo
 	query := "SELECT " + selectFields + `
         FROM users u
         JOIN game_scores gs ON u.id = gs.user_id
-        WHERE gs.game_type = $1 ` + timeCondition + ` ` + userFilter + `
+        WHERE gs.game_type = $1 ` + timeCondition + ` ` + categoryCondition + ` ` + userFilter + `
         GROUP BY u.id, u.username
         ORDER BY ` + orderBy + `
         LIMIT ` + limitPlaceholder
@@ -583,10 +986,12 @@ func (db *DB) CreateMultiplayerRoom(room *MultiplayerRoom) error {
 	}
 
 	query := `
-		INSERT INTO multiplayer_rooms (id, name, game_type, max_players, created_by, settings)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO multiplayer_rooms (id, name, game_type, max_players, created_by, settings,
+		                               is_private, invite_code, password_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
 	`
-	_, err = db.conn.Exec(query, room.ID, room.Name, room.GameType, room.MaxPlayers, room.CreatedBy, settingsJSON)
+	_, err = db.conn.Exec(query, room.ID, room.Name, room.GameType, room.MaxPlayers, room.HostID, settingsJSON,
+		room.IsPrivate, room.InviteCode, room.PasswordHash)
 	if err != nil {
 		return fmt.Errorf("failed to create room: %w", err)
 	}
@@ -597,7 +1002,8 @@ func (db *DB) CreateMultiplayerRoom(room *MultiplayerRoom) error {
 func (db *DB) GetMultiplayerRoom(roomID string) (*MultiplayerRoom, error) {
 	query := `
 		SELECT r.id, r.name, r.game_type, r.max_players, r.status, r.created_by, 
-		       r.created_at, r.started_at, r.finished_at, r.settings
+		       r.created_at, r.started_at, r.finished_at, r.settings,
+		       r.is_private, r.is_locked, COALESCE(r.invite_code, ''), COALESCE(r.password_hash, '')
 		FROM multiplayer_rooms r
 		WHERE r.id = $1
 	`
@@ -606,7 +1012,8 @@ func (db *DB) GetMultiplayerRoom(roomID string) (*MultiplayerRoom, error) {
 	var settingsJSON []byte
 	err := db.conn.QueryRow(query, roomID).Scan(
 		&room.ID, &room.Name, &room.GameType, &room.MaxPlayers, &room.Status,
-		&room.CreatedBy, &room.CreatedAt, &room.StartedAt, &room.FinishedAt, &settingsJSON,
+		&room.HostID, &room.CreatedAt, &room.StartedAt, &room.FinishedAt, &settingsJSON,
+		&room.IsPrivate, &room.IsLocked, &room.InviteCode, &room.PasswordHash,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get room: %w", err)
@@ -614,9 +1021,10 @@ func (db *DB) GetMultiplayerRoom(roomID string) (*MultiplayerRoom, error) {
 
 	if len(settingsJSON) > 0 {
 		if err := json.Unmarshal(settingsJSON, &room.Settings); err != nil {
-			room.Settings = make(map[string]interface{})
+			room.Settings = RoomSettings{}
 		}
 	}
+	room.HasPassword = room.PasswordHash != ""
 
 	players, err := db.GetRoomPlayers(roomID)
 	if err != nil {
@@ -631,10 +1039,11 @@ func (db *DB) GetAvailableRooms(gameType string) ([]MultiplayerRoom, error) {
 	query := `
 		SELECT r.id, r.name, r.game_type, r.max_players, r.status, r.created_by, 
 		       r.created_at, r.started_at, r.finished_at, r.settings,
+		       r.is_locked, r.password_hash IS NOT NULL,
 		       COUNT(p.user_id) as current_players
 		FROM multiplayer_rooms r
 		LEFT JOIN multiplayer_players p ON r.id = p.room_id
-		WHERE r.game_type = $1 AND r.status = 'waiting'
+		WHERE r.game_type = $1 AND r.status = 'waiting' AND NOT r.is_private
 		GROUP BY r.id, r.name, r.game_type, r.max_players, r.status, r.created_by, 
 		         r.created_at, r.started_at, r.finished_at, r.settings
 		HAVING COUNT(p.user_id) < r.max_players
@@ -651,12 +1060,11 @@ func (db *DB) GetAvailableRooms(gameType string) ([]MultiplayerRoom, error) {
 	for rows.Next() {
 		var room MultiplayerRoom
 		var settingsJSON []byte
-		var currentPlayers int
 
 		err := rows.Scan(
 			&room.ID, &room.Name, &room.GameType, &room.MaxPlayers, &room.Status,
-			&room.CreatedBy, &room.CreatedAt, &room.StartedAt, &room.FinishedAt,
-			&settingsJSON, &currentPlayers,
+			&room.HostID, &room.CreatedAt, &room.StartedAt, &room.FinishedAt,
+			&settingsJSON, &room.IsLocked, &room.HasPassword, &room.CurrentPlayers,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan room: %w", err)
@@ -664,15 +1072,10 @@ func (db *DB) GetAvailableRooms(gameType string) ([]MultiplayerRoom, error) {
 
 		if len(settingsJSON) > 0 {
 			if err := json.Unmarshal(settingsJSON, &room.Settings); err != nil {
-				room.Settings = make(map[string]interface{})
+				room.Settings = RoomSettings{}
 			}
 		}
 
-		if room.Settings == nil {
-			room.Settings = make(map[string]interface{})
-		}
-		room.Settings["current_players"] = currentPlayers
-
 		rooms = append(rooms, room)
 	}
 
@@ -689,6 +1092,10 @@ func (db *DB) JoinMultiplayerRoom(roomID string, userID int) error {
 		return fmt.Errorf("room is not accepting new players")
 	}
 
+	if room.IsLocked {
+		return fmt.Errorf("room is locked")
+	}
+
 	if len(room.Players) >= room.MaxPlayers {
 		return fmt.Errorf("room is full")
 	}
@@ -706,11 +1113,44 @@ func (db *DB) JoinMultiplayerRoom(roomID string, userID int) error {
 	return nil
 }
 
-func (db *DB) LeaveMultiplayerRoom(roomID string, userID int) error {
+// GetRoomIDByInviteCode looks up the room an invite code belongs to.
+func (db *DB) GetRoomIDByInviteCode(code string) (string, error) {
+	query := `SELECT id FROM multiplayer_rooms WHERE invite_code = $1`
+	var roomID string
+	if err := db.conn.QueryRow(query, code).Scan(&roomID); err != nil {
+		return "", fmt.Errorf("failed to get room by invite code: %w", err)
+	}
+	return roomID, nil
+}
+
+// SetRoomHost hands a room over to another of its players.
+func (db *DB) SetRoomHost(roomID string, userID int) error {
+	query := `UPDATE multiplayer_rooms SET created_by = $2 WHERE id = $1`
+	_, err := db.conn.Exec(query, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set room host: %w", err)
+	}
+	return nil
+}
+
+// SetRoomLocked opens or closes a room to new players.
+func (db *DB) SetRoomLocked(roomID string, locked bool) error {
+	query := `UPDATE multiplayer_rooms SET is_locked = $2 WHERE id = $1`
+	_, err := db.conn.Exec(query, roomID, locked)
+	if err != nil {
+		return fmt.Errorf("failed to set room lock: %w", err)
+	}
+	return nil
+}
+
+// LeaveMultiplayerRoom removes a player, deleting the room once it is
+// empty. When the host leaves, the player who has been in the room longest
+// takes over; their user ID is returned, or 0 if the host didn't change.
+func (db *DB) LeaveMultiplayerRoom(roomID string, userID int) (int, error) {
 	query := `DELETE FROM multiplayer_players WHERE room_id = $1 AND user_id = $2`
 	_, err := db.conn.Exec(query, roomID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to leave room: %w", err)
+		return 0, fmt.Errorf("failed to leave room: %w", err)
 	}
 
 	countQuery := `SELECT COUNT(*) FROM multiplayer_players WHERE room_id = $1`
@@ -721,15 +1161,36 @@ func (db *DB) LeaveMultiplayerRoom(roomID string, userID int) error {
 		if _, err := db.conn.Exec(deleteQuery, roomID); err != nil {
 			log.Printf("Error deleting empty room %s: %v", roomID, err)
 		}
+		return 0, nil
 	}
 
-	return nil
+	migrateQuery := `
+		UPDATE multiplayer_rooms
+		SET created_by = (
+			SELECT user_id FROM multiplayer_players
+			WHERE room_id = $1
+			ORDER BY joined_at ASC
+			LIMIT 1
+		)
+		WHERE id = $1 AND created_by = $2
+		RETURNING created_by
+	`
+	var newHost int
+	err = db.conn.QueryRow(migrateQuery, roomID, userID).Scan(&newHost)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate room host: %w", err)
+	}
+
+	return newHost, nil
 }
 
 func (db *DB) GetRoomPlayers(roomID string) ([]MultiplayerPlayer, error) {
 	query := `
 		SELECT p.user_id, u.username, p.position, p.score, p.status, 
-		       p.joined_at, p.finished_at, p.game_state, p.is_ready
+		       p.joined_at, p.finished_at, p.game_state, p.is_ready, p.team
 		FROM multiplayer_players p
 		JOIN users u ON p.user_id = u.id
 		WHERE p.room_id = $1
@@ -750,6 +1211,7 @@ func (db *DB) GetRoomPlayers(roomID string) ([]MultiplayerPlayer, error) {
 		err := rows.Scan(
 			&player.UserID, &player.Username, &player.Position, &player.Score,
 			&player.Status, &player.JoinedAt, &player.FinishedAt, &gameStateJSON, &player.IsReady,
+			&player.Team,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan player: %w", err)
@@ -781,6 +1243,22 @@ func (db *DB) UpdatePlayerReady(roomID string, userID int, isReady bool) error {
 	return nil
 }
 
+// SetPlayerTeam moves a player to a team and clears their ready flag, so a
+// team change is always confirmed before the game starts.
+func (db *DB) SetPlayerTeam(roomID string, userID int, team int) error {
+	query := `
+		UPDATE multiplayer_players 
+		SET team = $3, is_ready = false
+		WHERE room_id = $1 AND user_id = $2
+	`
+	_, err := db.conn.Exec(query, roomID, userID, team)
+	if err != nil {
+		return fmt.Errorf("failed to set player team: %w", err)
+	}
+
+	return nil
+}
+
 func (db *DB) StartMultiplayerGame(roomID string) error {
 	query := `
 		SELECT COUNT(*) as total, COUNT(CASE WHEN is_ready THEN 1 END) as ready
@@ -947,7 +1425,7 @@ func (db *DB) GetFinishedPlayerCount(roomID string) (int, error) {
 
 func (db *DB) GetGameResults(roomID string) ([]map[string]interface{}, error) {
 	query := `
-		SELECT mp.user_id, u.username, mp.score, mp.position, mp.finished_at
+		SELECT mp.user_id, u.username, mp.score, mp.position, mp.finished_at, mp.team
 		FROM multiplayer_players mp
 		JOIN users u ON mp.user_id = u.id
 		WHERE mp.room_id = $1 AND mp.status = 'finished'
@@ -963,10 +1441,10 @@ func (db *DB) GetGameResults(roomID string) ([]map[string]interface{}, error) {
 	for rows.Next() {
 		var userID int
 		var username string
-		var score, position int
+		var score, position, team int
 		var finishedAt time.Time
 
-		err := rows.Scan(&userID, &username, &score, &position, &finishedAt)
+		err := rows.Scan(&userID, &username, &score, &position, &finishedAt, &team)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan result row: %w", err)
 		}
@@ -977,12 +1455,221 @@ func (db *DB) GetGameResults(roomID string) ([]map[string]interface{}, error) {
 			"score":      score,
 			"position":   position,
 			"finishedAt": finishedAt,
+			"team":       team,
 		})
 	}
 
 	return results, nil
 }
 
+// SaveMultiplayerGame records a finished game with each player's result.
+func (db *DB) SaveMultiplayerGame(game *MultiplayerGame) error {
+	metadataJSON, err := json.Marshal(game.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	settingsJSON, err := json.Marshal(game.Settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO multiplayer_games (id, room_id, game_type, duration, started_at, finished_at, winner, metadata, set_id, settings)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = tx.Exec(query, game.ID, game.RoomID, game.GameType, game.Duration,
+		game.StartedAt, game.FinishedAt, game.Winner, metadataJSON, game.SetID, settingsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to save multiplayer game: %w", err)
+	}
+
+	playerQuery := `
+		INSERT INTO multiplayer_game_players (game_id, user_id, team, placement, score, lines, stats)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	for _, player := range game.Players {
+		statsJSON, err := json.Marshal(player.Stats)
+		if err != nil {
+			return fmt.Errorf("failed to marshal player stats: %w", err)
+		}
+		_, err = tx.Exec(playerQuery, game.ID, player.UserID, player.Team, player.Placement,
+			player.Score, player.Lines, statsJSON)
+		if err != nil {
+			return fmt.Errorf("failed to save multiplayer game player: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit multiplayer game: %w", err)
+	}
+	return nil
+}
+
+// GetMultiplayerMatch returns a finished game with every player's result.
+func (db *DB) GetMultiplayerMatch(gameID string) (*MultiplayerGame, error) {
+	query := `
+		SELECT id, room_id, game_type, duration, started_at, finished_at, winner, set_id, settings, metadata
+		FROM multiplayer_games
+		WHERE id = $1
+	`
+	game, err := scanMultiplayerGame(db.conn.QueryRow(query, gameID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get match: %w", err)
+	}
+
+	if err := db.loadMatchPlayers([]*MultiplayerGame{game}); err != nil {
+		return nil, err
+	}
+	return game, nil
+}
+
+// GetUserMatches returns a page of the games a user has played, newest
+// first, each with every player's result.
+func (db *DB) GetUserMatches(userID int, limit, offset int) ([]*MultiplayerGame, error) {
+	query := `
+		SELECT g.id, g.room_id, g.game_type, g.duration, g.started_at, g.finished_at, g.winner, g.set_id, g.settings, g.metadata
+		FROM multiplayer_games g
+		JOIN multiplayer_game_players p ON p.game_id = g.id
+		WHERE p.user_id = $1
+		ORDER BY g.finished_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := db.conn.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user matches: %w", err)
+	}
+	defer rows.Close()
+
+	games := []*MultiplayerGame{}
+	for rows.Next() {
+		game, err := scanMultiplayerGame(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan match: %w", err)
+		}
+		games = append(games, game)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get user matches: %w", err)
+	}
+
+	if err := db.loadMatchPlayers(games); err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+func scanMultiplayerGame(row interface{ Scan(...interface{}) error }) (*MultiplayerGame, error) {
+	var game MultiplayerGame
+	var settingsJSON, metadataJSON []byte
+	err := row.Scan(
+		&game.ID, &game.RoomID, &game.GameType, &game.Duration, &game.StartedAt,
+		&game.FinishedAt, &game.Winner, &game.SetID, &settingsJSON, &metadataJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(settingsJSON) > 0 {
+		if err := json.Unmarshal(settingsJSON, &game.Settings); err != nil {
+			game.Settings = nil
+		}
+	}
+	if len(metadataJSON) > 0 {
+		if err := json.Unmarshal(metadataJSON, &game.Metadata); err != nil {
+			game.Metadata = nil
+		}
+	}
+	return &game, nil
+}
+
+// loadMatchPlayers fills in the players of each game, best placement first.
+func (db *DB) loadMatchPlayers(games []*MultiplayerGame) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*MultiplayerGame, len(games))
+	ids := make([]string, 0, len(games))
+	for _, game := range games {
+		game.Players = []MatchPlayer{}
+		byID[game.ID] = game
+		ids = append(ids, game.ID)
+	}
+
+	query := `
+		SELECT p.game_id, p.user_id, u.username, p.team, p.placement, p.score, p.lines, p.stats
+		FROM multiplayer_game_players p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.game_id = ANY($1)
+		ORDER BY p.placement ASC, p.score DESC
+	`
+	rows, err := db.conn.Query(query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to get match players: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var gameID string
+		var player MatchPlayer
+		var statsJSON []byte
+		err := rows.Scan(&gameID, &player.UserID, &player.Username, &player.Team,
+			&player.Placement, &player.Score, &player.Lines, &statsJSON)
+		if err != nil {
+			return fmt.Errorf("failed to scan match player: %w", err)
+		}
+		if len(statsJSON) > 0 {
+			if err := json.Unmarshal(statsJSON, &player.Stats); err != nil {
+				player.Stats = nil
+			}
+		}
+		if game, ok := byID[gameID]; ok {
+			game.Players = append(game.Players, player)
+		}
+	}
+	return rows.Err()
+}
+
+// CreateMatchSet records the start of a set, before its first game is saved.
+func (db *DB) CreateMatchSet(set *MatchSet) error {
+	query := `
+		INSERT INTO multiplayer_sets (id, room_id, first_to, started_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := db.conn.Exec(query, set.ID, set.RoomID, set.FirstTo, set.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create match set: %w", err)
+	}
+
+	return nil
+}
+
+// FinishMatchSet stores a set's final round wins and winner.
+func (db *DB) FinishMatchSet(set *MatchSet) error {
+	winsJSON, err := json.Marshal(set.Wins)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wins: %w", err)
+	}
+
+	query := `
+		UPDATE multiplayer_sets 
+		SET wins = $2, winner = $3, finished_at = $4
+		WHERE id = $1
+	`
+	_, err = db.conn.Exec(query, set.ID, winsJSON, set.Winner, set.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to finish match set: %w", err)
+	}
+
+	return nil
+}
+
 func (db *DB) UpdateRoomStatus(roomID string, status string) error {
 	query := `UPDATE multiplayer_rooms SET status = $2 WHERE id = $1`
 	_, err := db.conn.Exec(query, roomID, status)
@@ -1015,7 +1702,7 @@ func (db *DB) UpdatePlayerStatus(roomID string, userID int, status string) error
 	return nil
 }
 
-func (db *DB) UpdateRoomSettings(roomID string, settings map[string]interface{}) error {
+func (db *DB) UpdateRoomSettings(roomID string, settings RoomSettings) error {
 	settingsJSON, err := json.Marshal(settings)
 	if err != nil {
 		return fmt.Errorf("failed to marshal settings: %w", err)
@@ -1028,6 +1715,303 @@ func (db *DB) UpdateRoomSettings(roomID string, settings map[string]interface{})
 	return nil
 }
 
+func (db *DB) SaveChatMessage(message *ChatMessage) error {
+	query := `
+		INSERT INTO chat_messages (id, channel, user_id, text, sent_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := db.conn.Exec(query, message.ID, message.Channel, message.UserID, message.Text, message.SentAt)
+	if err != nil {
+		return fmt.Errorf("failed to save chat message: %w", err)
+	}
+	return nil
+}
+
+// GetChatHistory returns the channel's last limit messages that haven't been
+// deleted, oldest first.
+func (db *DB) GetChatHistory(channel string, limit int) ([]ChatMessage, error) {
+	query := `
+		SELECT m.id, m.channel, m.user_id, u.username, m.text, m.sent_at
+		FROM chat_messages m
+		JOIN users u ON m.user_id = u.id
+		WHERE m.channel = $1 AND m.deleted_at IS NULL
+		ORDER BY m.sent_at DESC
+		LIMIT $2
+	`
+	rows, err := db.conn.Query(query, channel, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat history: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []ChatMessage
+	for rows.Next() {
+		var message ChatMessage
+		err := rows.Scan(&message.ID, &message.Channel, &message.UserID, &message.Username, &message.Text, &message.SentAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get chat history: %w", err)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// DeleteChatMessage hides a message from the history. The row is kept for
+// moderation.
+func (db *DB) DeleteChatMessage(id string) error {
+	query := `UPDATE chat_messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`
+	result, err := db.conn.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete chat message: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("chat message not found")
+	}
+	return nil
+}
+
+// GetChatIgnores returns the users a user has muted or blocked, mapped to
+// the kind of ignore.
+func (db *DB) GetChatIgnores(userID int) (map[int]string, error) {
+	query := `SELECT target_id, kind FROM chat_ignores WHERE user_id = $1`
+	rows, err := db.conn.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat ignores: %w", err)
+	}
+	defer rows.Close()
+
+	ignores := make(map[int]string)
+	for rows.Next() {
+		var targetID int
+		var kind string
+		if err := rows.Scan(&targetID, &kind); err != nil {
+			return nil, fmt.Errorf("failed to scan chat ignore: %w", err)
+		}
+		ignores[targetID] = kind
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get chat ignores: %w", err)
+	}
+	return ignores, nil
+}
+
+// GetChatIgnoresOf returns the muted and blocked users of each of a set of
+// users, as GetChatIgnores does for one. Every user asked for has an entry.
+func (db *DB) GetChatIgnoresOf(userIDs []int) (map[int]map[int]string, error) {
+	ignores := make(map[int]map[int]string, len(userIDs))
+	for _, userID := range userIDs {
+		ignores[userID] = make(map[int]string)
+	}
+	if len(userIDs) == 0 {
+		return ignores, nil
+	}
+
+	query := `SELECT user_id, target_id, kind FROM chat_ignores WHERE user_id = ANY($1)`
+	rows, err := db.conn.Query(query, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat ignores: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, targetID int
+		var kind string
+		if err := rows.Scan(&userID, &targetID, &kind); err != nil {
+			return nil, fmt.Errorf("failed to scan chat ignore: %w", err)
+		}
+		if ignores[userID] != nil {
+			ignores[userID][targetID] = kind
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get chat ignores: %w", err)
+	}
+	return ignores, nil
+}
+
+// SetChatIgnore mutes or blocks targetID for userID, or clears whichever was
+// set when kind is empty.
+func (db *DB) SetChatIgnore(userID, targetID int, kind string) error {
+	var err error
+	if kind == "" {
+		_, err = db.conn.Exec(`DELETE FROM chat_ignores WHERE user_id = $1 AND target_id = $2`, userID, targetID)
+	} else {
+		query := `
+			INSERT INTO chat_ignores (user_id, target_id, kind)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, target_id) DO UPDATE SET kind = EXCLUDED.kind, created_at = CURRENT_TIMESTAMP
+		`
+		_, err = db.conn.Exec(query, userID, targetID, kind)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set chat ignore: %w", err)
+	}
+	return nil
+}
+
+// SendFriendRequest asks toID to be fromID's friend. If toID had already
+// asked fromID, that request is accepted instead and accepted is true.
+func (db *DB) SendFriendRequest(fromID, toID int) (accepted bool, err error) {
+	query := `
+		UPDATE friendships SET status = 'accepted', accepted_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND friend_id = $2 AND status = 'pending'
+	`
+	result, err := db.conn.Exec(query, toID, fromID)
+	if err != nil {
+		return false, fmt.Errorf("failed to send friend request: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		return true, nil
+	}
+
+	var exists bool
+	query = `
+		SELECT EXISTS (
+			SELECT 1 FROM friendships
+			WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)
+		)
+	`
+	if err := db.conn.QueryRow(query, fromID, toID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to send friend request: %w", err)
+	}
+	if exists {
+		return false, fmt.Errorf("friend request already sent")
+	}
+
+	query = `INSERT INTO friendships (user_id, friend_id) VALUES ($1, $2)`
+	if _, err := db.conn.Exec(query, fromID, toID); err != nil {
+		return false, fmt.Errorf("failed to send friend request: %w", err)
+	}
+	return false, nil
+}
+
+// AcceptFriendRequest accepts requesterID's pending request to userID.
+func (db *DB) AcceptFriendRequest(userID, requesterID int) error {
+	query := `
+		UPDATE friendships SET status = 'accepted', accepted_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND friend_id = $2 AND status = 'pending'
+	`
+	result, err := db.conn.Exec(query, requesterID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to accept friend request: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("friend request not found")
+	}
+	return nil
+}
+
+// RemoveFriend unfriends two users, or declines or cancels a request
+// between them.
+func (db *DB) RemoveFriend(userID, otherID int) error {
+	query := `
+		DELETE FROM friendships
+		WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)
+	`
+	result, err := db.conn.Exec(query, userID, otherID)
+	if err != nil {
+		return fmt.Errorf("failed to remove friend: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("not friends with that user")
+	}
+	return nil
+}
+
+func (db *DB) AreFriends(userID, otherID int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM friendships
+			WHERE status = 'accepted'
+			AND ((user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1))
+		)
+	`
+	var friends bool
+	if err := db.conn.QueryRow(query, userID, otherID).Scan(&friends); err != nil {
+		return false, fmt.Errorf("failed to check friendship: %w", err)
+	}
+	return friends, nil
+}
+
+// GetFriends returns a user's accepted friends, ordered by username.
+func (db *DB) GetFriends(userID int) ([]Friend, error) {
+	query := `
+		SELECT u.id, u.username, f.accepted_at
+		FROM friendships f
+		JOIN users u ON u.id = CASE WHEN f.user_id = $1 THEN f.friend_id ELSE f.user_id END
+		WHERE (f.user_id = $1 OR f.friend_id = $1) AND f.status = 'accepted'
+		ORDER BY u.username
+	`
+	return db.queryFriends(query, userID)
+}
+
+func (db *DB) GetFriendRequests(userID int) (*FriendRequests, error) {
+	incoming, err := db.queryFriends(`
+		SELECT u.id, u.username, f.created_at
+		FROM friendships f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.friend_id = $1 AND f.status = 'pending'
+		ORDER BY f.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	outgoing, err := db.queryFriends(`
+		SELECT u.id, u.username, f.created_at
+		FROM friendships f
+		JOIN users u ON u.id = f.friend_id
+		WHERE f.user_id = $1 AND f.status = 'pending'
+		ORDER BY f.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &FriendRequests{Incoming: incoming, Outgoing: outgoing}, nil
+}
+
+func (db *DB) queryFriends(query string, userID int) ([]Friend, error) {
+	rows, err := db.conn.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get friends: %w", err)
+	}
+	defer rows.Close()
+
+	friends := []Friend{}
+	for rows.Next() {
+		var friend Friend
+		var since sql.NullTime
+		if err := rows.Scan(&friend.UserID, &friend.Username, &since); err != nil {
+			return nil, fmt.Errorf("failed to scan friend: %w", err)
+		}
+		friend.Since = since.Time
+		friends = append(friends, friend)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get friends: %w", err)
+	}
+	return friends, nil
+}
+
+// GetFriendIDs returns the user IDs of a user's accepted friends.
+func (db *DB) GetFriendIDs(userID int) ([]int, error) {
+	friends, err := db.GetFriends(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(friends))
+	for i, friend := range friends {
+		ids[i] = friend.UserID
+	}
+	return ids, nil
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
@@ -0,0 +1,432 @@
+package multiplayer
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/isaacjstriker/devware/internal/database"
+	"github.com/isaacjstriker/devware/internal/ratelimit"
+)
+
+// lobbyRoomID is the room the room browser connects to. Its chat is the
+// lobby channel.
+const lobbyRoomID = "browse"
+
+const maxChatLength = 500
+
+// ChatFilter screens chat messages before they are sent, e.g. for
+// profanity. Filter returns the text to send, which may be censored, or an
+// error saying why the message was rejected.
+type ChatFilter interface {
+	Filter(text string) (string, error)
+}
+
+// WordFilter masks each of a list of words with asterisks, matching whole
+// words regardless of case.
+type WordFilter struct {
+	words map[string]bool
+}
+
+func NewWordFilter(words []string) *WordFilter {
+	f := &WordFilter{words: make(map[string]bool, len(words))}
+	for _, word := range words {
+		f.words[strings.ToLower(word)] = true
+	}
+	return f
+}
+
+func (f *WordFilter) Filter(text string) (string, error) {
+	runes := []rune(text)
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && f.words[strings.ToLower(string(runes[start:i]))] {
+			for j := start; j < i; j++ {
+				runes[j] = '*'
+			}
+		}
+		start = -1
+	}
+	return string(runes), nil
+}
+
+// ChatOptions configures room and lobby chat.
+type ChatOptions struct {
+	PerMinute int
+	Burst     int
+	// HistorySize is how many recent messages are kept for each room.
+	HistorySize int
+	// Persist saves messages to the database, so a room's history can be
+	// loaded again after it has been dropped from memory.
+	Persist bool
+	// Admins are the usernames allowed to delete messages.
+	Admins []string
+	// Filter, if set, screens every message.
+	Filter ChatFilter
+}
+
+type chatState struct {
+	options ChatOptions
+	limiter *ratelimit.Limiter
+	admins  map[string]bool
+
+	mutex sync.Mutex
+	// history holds each room's recent messages, oldest first.
+	history map[string][]database.ChatMessage
+	// ignores caches the mutes and blocks of each connected user.
+	ignores map[int]map[int]string
+}
+
+func newChatState(options ChatOptions) *chatState {
+	c := &chatState{
+		options: options,
+		admins:  make(map[string]bool, len(options.Admins)),
+		history: make(map[string][]database.ChatMessage),
+		ignores: make(map[int]map[int]string),
+	}
+	if options.PerMinute > 0 {
+		c.limiter = ratelimit.NewLimiter(options.PerMinute, options.Burst)
+	}
+	for _, username := range options.Admins {
+		c.admins[username] = true
+	}
+	return c
+}
+
+// forget drops a user's cached ignores once they have no client left.
+func (c *chatState) forget(userID int) {
+	c.mutex.Lock()
+	delete(c.ignores, userID)
+	c.mutex.Unlock()
+}
+
+// dropHistory drops a room's messages from memory.
+func (c *chatState) dropHistory(roomID string) {
+	c.mutex.Lock()
+	delete(c.history, roomID)
+	c.mutex.Unlock()
+}
+
+func chatChannel(roomID string) string {
+	if roomID == lobbyRoomID {
+		return "lobby"
+	}
+	return "room"
+}
+
+// IsChatAdmin reports whether the user may moderate chat.
+func (h *Hub) IsChatAdmin(username string) bool {
+	return h.chat.admins[username]
+}
+
+// chatHistory returns a room's recent messages, loading them from the
+// database the first time if chat is persisted.
+func (h *Hub) chatHistory(roomID string) []database.ChatMessage {
+	c := h.chat
+	c.mutex.Lock()
+	messages, ok := c.history[roomID]
+	c.mutex.Unlock()
+	if ok || !c.options.Persist {
+		return messages
+	}
+
+	loaded, err := h.db.GetChatHistory(roomID, c.options.HistorySize)
+	if err != nil {
+		log.Printf("Failed to load chat history for room %s: %v", roomID, err)
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if messages, ok := c.history[roomID]; ok {
+		return messages
+	}
+	c.history[roomID] = loaded
+	return loaded
+}
+
+func (h *Hub) appendChat(message database.ChatMessage) {
+	h.chatHistory(message.Channel)
+
+	c := h.chat
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	messages := append(c.history[message.Channel], message)
+	if len(messages) > c.options.HistorySize {
+		messages = append([]database.ChatMessage(nil), messages[len(messages)-c.options.HistorySize:]...)
+	}
+	c.history[message.Channel] = messages
+}
+
+// loadChatIgnores caches the mutes and blocks of whichever of the users
+// aren't cached yet, in one query, so that sending a message to a room
+// doesn't look each recipient up in turn.
+func (h *Hub) loadChatIgnores(userIDs []int) {
+	c := h.chat
+	c.mutex.Lock()
+	var missing []int
+	for _, userID := range userIDs {
+		if _, ok := c.ignores[userID]; !ok {
+			missing = append(missing, userID)
+		}
+	}
+	c.mutex.Unlock()
+	if len(missing) == 0 {
+		return
+	}
+
+	loaded, err := h.db.GetChatIgnoresOf(missing)
+	if err != nil {
+		log.Printf("Failed to load chat ignores for %d users: %v", len(missing), err)
+		return
+	}
+	c.mutex.Lock()
+	for userID, ignores := range loaded {
+		if _, ok := c.ignores[userID]; !ok {
+			c.ignores[userID] = ignores
+		}
+	}
+	c.mutex.Unlock()
+}
+
+// chatIgnore returns whether userID has muted or blocked targetID.
+func (h *Hub) chatIgnore(userID, targetID int) string {
+	c := h.chat
+	c.mutex.Lock()
+	_, ok := c.ignores[userID]
+	c.mutex.Unlock()
+
+	if !ok {
+		loaded, err := h.db.GetChatIgnores(userID)
+		if err != nil {
+			log.Printf("Failed to load chat ignores for user %d: %v", userID, err)
+			return ""
+		}
+		c.mutex.Lock()
+		if _, ok := c.ignores[userID]; !ok {
+			c.ignores[userID] = loaded
+		}
+		c.mutex.Unlock()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ignores[userID][targetID]
+}
+
+// chatHidden reports whether a message from senderID is kept from
+// recipientID, because the recipient ignores the sender or the sender
+// blocked the recipient.
+func (h *Hub) chatHidden(senderID, recipientID int) bool {
+	if senderID == recipientID {
+		return false
+	}
+	return h.chatIgnore(recipientID, senderID) != "" ||
+		h.chatIgnore(senderID, recipientID) == database.ChatBlock
+}
+
+// canChat reports whether the user may read and post in a room's chat:
+// anyone in the lobby, otherwise only the room's players. Room sockets are
+// already limited to players, but someone can leave or be kicked while
+// still connected.
+func (h *Hub) canChat(roomID string, userID int) bool {
+	return roomID == lobbyRoomID || h.isRoomPlayer(roomID, userID)
+}
+
+func (h *Hub) handleChatMessage(message WebSocketMessage, payload *ChatMessagePayload) {
+	if message.RoomID == "" || message.UserID == 0 {
+		return
+	}
+	if !h.canChat(message.RoomID, message.UserID) {
+		h.rejectMessage(message, "you're not in this room")
+		return
+	}
+	c := h.chat
+
+	if c.limiter != nil {
+		if ok, wait := c.limiter.Allow(strconv.Itoa(message.UserID)); !ok {
+			h.rejectMessage(message, fmt.Sprintf("you're sending messages too fast, try again in %ds", int(wait.Seconds())+1))
+			return
+		}
+	}
+
+	text := strings.TrimSpace(payload.Text)
+	if c.options.Filter != nil {
+		filtered, err := c.options.Filter.Filter(text)
+		if err != nil {
+			h.rejectMessage(message, err.Error())
+			return
+		}
+		text = filtered
+	}
+
+	username, err := h.getUsernameByID(message.UserID)
+	if err != nil {
+		log.Printf("Failed to get username for chat message from user %d: %v", message.UserID, err)
+		return
+	}
+
+	chatMessage := database.ChatMessage{
+		ID:       generateRecordID(),
+		Channel:  message.RoomID,
+		UserID:   message.UserID,
+		Username: username,
+		Text:     text,
+		SentAt:   time.Now(),
+	}
+	if c.options.Persist {
+		if err := h.db.SaveChatMessage(&chatMessage); err != nil {
+			log.Printf("Failed to save chat message in room %s: %v", message.RoomID, err)
+		}
+	}
+	h.appendChat(chatMessage)
+
+	clients := h.roomClients(message.RoomID)
+	userIDs := make([]int, 0, len(clients)+1)
+	userIDs = append(userIDs, chatMessage.UserID)
+	for _, client := range clients {
+		userIDs = append(userIDs, client.UserID)
+	}
+	h.loadChatIgnores(userIDs)
+
+	for _, client := range clients {
+		if h.chatHidden(chatMessage.UserID, client.UserID) {
+			continue
+		}
+		h.sendToClient(client, WebSocketMessage{
+			Type:   "chat_message",
+			RoomID: message.RoomID,
+			Data: map[string]interface{}{
+				"channel": chatChannel(message.RoomID),
+				"message": chatMessage,
+			},
+		})
+	}
+}
+
+// sendChatHistory sends a newly connected client its room's recent
+// messages, leaving out any it would not have been sent.
+func (h *Hub) sendChatHistory(client *Client) {
+	if !h.canChat(client.RoomID, client.UserID) {
+		return
+	}
+	// Caching the client's ignores now, off the hub's goroutine, saves
+	// looking them up when the next message is sent to the room.
+	h.loadChatIgnores([]int{client.UserID})
+	history := h.chatHistory(client.RoomID)
+	messages := make([]database.ChatMessage, 0, len(history))
+	for _, chatMessage := range history {
+		if !h.chatHidden(chatMessage.UserID, client.UserID) {
+			messages = append(messages, chatMessage)
+		}
+	}
+
+	h.sendToClient(client, WebSocketMessage{
+		Type:   "chat_history",
+		RoomID: client.RoomID,
+		Data: map[string]interface{}{
+			"channel":  chatChannel(client.RoomID),
+			"messages": messages,
+		},
+	})
+}
+
+func (h *Hub) handleChatIgnore(message WebSocketMessage, payload *ChatIgnorePayload) {
+	if message.UserID == 0 {
+		return
+	}
+	if payload.UserID == message.UserID {
+		h.rejectMessage(message, "you can't mute or block yourself")
+		return
+	}
+
+	if err := h.db.SetChatIgnore(message.UserID, payload.UserID, payload.Kind); err != nil {
+		log.Printf("Failed to update chat ignores of user %d: %v", message.UserID, err)
+		h.rejectMessage(message, "failed to update your chat settings")
+		return
+	}
+
+	c := h.chat
+	c.mutex.Lock()
+	if ignores, ok := c.ignores[message.UserID]; ok {
+		if payload.Kind == "" {
+			delete(ignores, payload.UserID)
+		} else {
+			ignores[payload.UserID] = payload.Kind
+		}
+	}
+	c.mutex.Unlock()
+
+	h.sendToUser(message.UserID, WebSocketMessage{
+		Type:   "chat_ignore_updated",
+		RoomID: message.RoomID,
+		Data: map[string]interface{}{
+			"user_id": payload.UserID,
+			"kind":    payload.Kind,
+		},
+	})
+}
+
+func (h *Hub) handleChatDelete(message WebSocketMessage, payload *ChatDeletePayload) {
+	username, err := h.getUsernameByID(message.UserID)
+	if err != nil || !h.IsChatAdmin(username) {
+		h.rejectMessage(message, "only admins can delete messages")
+		return
+	}
+	if err := h.DeleteChatMessage(payload.ID); err != nil {
+		h.rejectMessage(message, err.Error())
+		return
+	}
+	log.Printf("Chat message %s deleted by %s", payload.ID, username)
+}
+
+// DeleteChatMessage removes a message from its room's history and tells
+// the room it is gone.
+func (h *Hub) DeleteChatMessage(id string) error {
+	c := h.chat
+	roomID := ""
+	c.mutex.Lock()
+	for channel, messages := range c.history {
+		for i, chatMessage := range messages {
+			if chatMessage.ID == id {
+				roomID = channel
+				c.history[channel] = append(messages[:i:i], messages[i+1:]...)
+				break
+			}
+		}
+		if roomID != "" {
+			break
+		}
+	}
+	c.mutex.Unlock()
+
+	if c.options.Persist {
+		if err := h.db.DeleteChatMessage(id); err != nil && roomID == "" {
+			return err
+		}
+	} else if roomID == "" {
+		return fmt.Errorf("chat message not found")
+	}
+
+	if roomID != "" {
+		h.broadcastToRoom(roomID, WebSocketMessage{
+			Type:   "chat_deleted",
+			RoomID: roomID,
+			Data: map[string]interface{}{
+				"channel": chatChannel(roomID),
+				"id":      id,
+			},
+		})
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package multiplayer
+
+import (
+	"log"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+)
+
+// coopPlayer returns the player index of a user in a co-op game, or -1.
+func (game *MultiplayerGame) coopPlayer(userID int) int {
+	for i, id := range game.CoopPlayers {
+		if id == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// broadcastCoopState sends the shared board to everyone in the room. Co-op
+// games aren't delta streamed, so every client gets the full state. Callers
+// must hold the game's mutex.
+func (h *Hub) broadcastCoopState(roomID string, game *MultiplayerGame) {
+	state := game.Coop.GetState()
+	h.broadcastToRoom(roomID, WebSocketMessage{
+		Type:   "coop_game_state",
+		RoomID: roomID,
+		Data: map[string]interface{}{
+			"board":    state.Board,
+			"players":  state.Players,
+			"userIDs":  game.CoopPlayers,
+			"score":    state.Score,
+			"lines":    state.Lines,
+			"level":    state.Level,
+			"gameOver": state.GameOver,
+			"topOut":   state.TopOut,
+			"frame":    state.Frame,
+			"stats":    state.Stats,
+		},
+	})
+}
+
+// finishCoopGame records the shared result for every participant and tells
+// the room how the game went. Everyone finishes in first place together.
+func (h *Hub) finishCoopGame(roomID string, game *MultiplayerGame) {
+	game.mutex.RLock()
+	state := game.Coop.GetState()
+	userIDs := append([]int(nil), game.CoopPlayers...)
+	game.mutex.RUnlock()
+
+	usernames := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		username, err := h.getUsernameByID(userID)
+		if err != nil {
+			log.Printf("Failed to get username for co-op player %d: %v", userID, err)
+			username = "Unknown Player"
+		}
+		usernames[i] = username
+	}
+
+	for _, userID := range userIDs {
+		if err := h.db.FinishPlayerGame(roomID, userID, state.Score, 1); err != nil {
+			log.Printf("Failed to finish co-op player %d: %v", userID, err)
+		}
+
+		metadata := map[string]interface{}{
+			"time_played":   state.Stats.TimePlayed,
+			"lines_cleared": state.Lines,
+			"pieces_placed": state.Stats.PiecesPlaced,
+			"coop": map[string]interface{}{
+				"room_id": roomID,
+				"players": usernames,
+				"lines":   state.Lines,
+			},
+		}
+		if err := h.SaveScore(userID, "tetris", state.Score, metadata); err != nil {
+			log.Printf("Failed to save co-op score for player %d: %v", userID, err)
+		}
+	}
+
+	h.broadcastToRoom(roomID, WebSocketMessage{
+		Type:   "coop_game_over",
+		RoomID: roomID,
+		Data: map[string]interface{}{
+			"score":   state.Score,
+			"lines":   state.Lines,
+			"reason":  state.TopOut,
+			"userIDs": userIDs,
+			"players": usernames,
+			"stats":   state.Stats,
+		},
+	})
+}
+
+// handleCoopInput applies a game_input to the sender's piece in a co-op
+// game. Callers must hold the game's mutex.
+func (h *Hub) handleCoopInput(message WebSocketMessage, payload *GameInputPayload, game *MultiplayerGame) {
+	player := game.coopPlayer(message.UserID)
+	if player < 0 {
+		log.Printf("Player %d not found in co-op game for room %s", message.UserID, message.RoomID)
+		return
+	}
+	if game.Coop.IsGameOver() {
+		return
+	}
+
+	if payload.Seq > 0 {
+		if !game.Coop.QueueInput(player, tetris.Input{Seq: payload.Seq, Frame: payload.Frame, Action: payload.Action}) {
+			log.Printf("Dropped stale input %d from player %d in room %s", payload.Seq, message.UserID, message.RoomID)
+			return
+		}
+	} else {
+		game.Coop.HandleInput(player, payload.Action)
+	}
+
+	h.broadcastCoopState(message.RoomID, game)
+}
@@ -0,0 +1,131 @@
+package multiplayer
+
+import (
+	"log"
+	"time"
+
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+const (
+	defaultCountdown = 3
+	maxCountdown     = 10
+)
+
+// RoomCountdown returns how many seconds a room counts down once everyone
+// is ready.
+func RoomCountdown(settings database.RoomSettings) int {
+	if settings.Countdown == nil {
+		return defaultCountdown
+	}
+	return *settings.Countdown
+}
+
+// countdown is the pre-game countdown running in a room. Closing cancel
+// stops it before the game starts.
+type countdown struct {
+	cancel     chan struct{}
+	startFrame uint32
+}
+
+// startCountdown counts down and then starts the room's game, broadcasting
+// every second that's left. It does nothing if the room is already counting
+// down or playing.
+func (h *Hub) startCountdown(roomID string, seconds int) {
+	h.mutex.Lock()
+	_, counting := h.countdowns[roomID]
+	_, playing := h.multiplayerGames[roomID]
+	if counting || playing {
+		h.mutex.Unlock()
+		return
+	}
+	cd := &countdown{
+		cancel:     make(chan struct{}),
+		startFrame: h.currentFrame() + uint32(time.Duration(seconds)*time.Second/tickInterval),
+	}
+	h.countdowns[roomID] = cd
+	h.mutex.Unlock()
+
+	log.Printf("Starting %ds countdown in room %s", seconds, roomID)
+	h.broadcastToRoom(roomID, WebSocketMessage{
+		Type:   "countdown_started",
+		RoomID: roomID,
+		Data: map[string]interface{}{
+			"seconds":     seconds,
+			"start_frame": cd.startFrame,
+			"message":     "All players ready! Game starting...",
+		},
+	})
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for remaining := seconds; remaining > 0; remaining-- {
+			h.broadcastToRoom(roomID, WebSocketMessage{
+				Type:   "countdown_tick",
+				RoomID: roomID,
+				Data: map[string]interface{}{
+					"remaining": remaining,
+				},
+			})
+
+			select {
+			case <-cd.cancel:
+				return
+			case <-ticker.C:
+			}
+		}
+
+		h.mutex.Lock()
+		current := h.countdowns[roomID]
+		if current == cd {
+			delete(h.countdowns, roomID)
+		}
+		h.mutex.Unlock()
+		if current != cd {
+			return
+		}
+
+		// The ready check is repeated here so a player who joined during the
+		// countdown holds the start back.
+		if err := h.db.StartMultiplayerGame(roomID); err != nil {
+			log.Printf("Countdown in room %s ended without a start: %v", roomID, err)
+			h.broadcastCountdownCancelled(roomID, err.Error())
+			return
+		}
+		h.broadcast <- WebSocketMessage{
+			Type:   "start_multiplayer_game",
+			RoomID: roomID,
+			Data: map[string]interface{}{
+				"start_frame": cd.startFrame,
+			},
+		}
+	}()
+}
+
+// cancelCountdown stops the room's countdown, if any, and tells the room why.
+func (h *Hub) cancelCountdown(roomID string, reason string) {
+	h.mutex.Lock()
+	cd, ok := h.countdowns[roomID]
+	if ok {
+		delete(h.countdowns, roomID)
+		close(cd.cancel)
+	}
+	h.mutex.Unlock()
+
+	if ok {
+		log.Printf("Cancelled countdown in room %s: %s", roomID, reason)
+		h.broadcastCountdownCancelled(roomID, reason)
+	}
+}
+
+func (h *Hub) broadcastCountdownCancelled(roomID string, reason string) {
+	h.broadcastToRoom(roomID, WebSocketMessage{
+		Type:   "countdown_cancelled",
+		RoomID: roomID,
+		Data: map[string]interface{}{
+			"reason": reason,
+		},
+	})
+}
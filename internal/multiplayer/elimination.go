@@ -0,0 +1,285 @@
+package multiplayer
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+)
+
+// badgeBoosts are the attack bonuses, in percent, for KO badge points. A KO
+// is worth one point plus the points of the player knocked out.
+var badgeBoosts = []struct {
+	points int
+	boost  int
+}{
+	{30, 100},
+	{14, 75},
+	{6, 50},
+	{2, 25},
+}
+
+func badgeBoost(points int) int {
+	for _, level := range badgeBoosts {
+		if points >= level.points {
+			return level.boost
+		}
+	}
+	return 0
+}
+
+// eliminationState tracks a match played to the last team standing: battle
+// royales, where everyone is on a team of their own, and team battles.
+// Attacks go to a random opponent who is still in, and a team is placed when
+// its last member tops out.
+type eliminationState struct {
+	mode    string
+	players map[int]*eliminationPlayer
+	// teamsAlive is the number of teams with a member still in.
+	teamsAlive int
+}
+
+type eliminationPlayer struct {
+	Team int  `json:"team"`
+	Out  bool `json:"out"`
+	// Placement is the team's finishing place, 0 while the team is still in.
+	Placement int `json:"placement"`
+	KOs       int `json:"kos"`
+	// Badges are KO badge points, which boost attack in battle royales.
+	Badges int `json:"badges"`
+	// lastAttacker is credited with the KO if the player tops out.
+	lastAttacker int
+}
+
+// newEliminationState starts a match between the given players, keyed by
+// user ID with their team.
+func newEliminationState(mode string, teams map[int]int) *eliminationState {
+	state := &eliminationState{
+		mode:    mode,
+		players: make(map[int]*eliminationPlayer, len(teams)),
+	}
+	alive := make(map[int]bool)
+	for userID, team := range teams {
+		state.players[userID] = &eliminationPlayer{Team: team}
+		alive[team] = true
+	}
+	state.teamsAlive = len(alive)
+	return state
+}
+
+// opponents lists the players still in who aren't on the user's team.
+func (e *eliminationState) opponents(userID int) []int {
+	team := e.players[userID].Team
+	var targets []int
+	for id, player := range e.players {
+		if !player.Out && player.Team != team {
+			targets = append(targets, id)
+		}
+	}
+	sort.Ints(targets)
+	return targets
+}
+
+func (e *eliminationState) teamOut(team int) bool {
+	for _, player := range e.players {
+		if player.Team == team && !player.Out {
+			return false
+		}
+	}
+	return true
+}
+
+// exchangeAttacks sends each player's attack to a random opponent who is
+// still in, boosted by their badges in a battle royale. Callers must hold
+// the game's mutex.
+func (h *Hub) exchangeAttacks(game *MultiplayerGame) {
+	for userID, tetrisGame := range game.Players {
+		attack := tetrisGame.TakeAttack()
+		player := game.Elimination.players[userID]
+		if attack == 0 || player.Out {
+			continue
+		}
+
+		targets := game.Elimination.opponents(userID)
+		if len(targets) == 0 {
+			continue
+		}
+		targetID := targets[rand.Intn(len(targets))]
+
+		if game.Elimination.mode == ModeRoyale {
+			attack += attack * badgeBoost(player.Badges) / 100
+		}
+		game.Players[targetID].ReceiveGarbage(attack)
+		game.Elimination.players[targetID].lastAttacker = userID
+	}
+}
+
+// eliminatePlayers knocks out everyone who has topped out since the last
+// tick, credits their KOs and places any team left with nobody in. Players
+// eliminated in the same tick are handled in user ID order. Callers must
+// hold the game's mutex.
+func (h *Hub) eliminatePlayers(roomID string, game *MultiplayerGame) {
+	var toppedOut []int
+	for userID, tetrisGame := range game.Players {
+		if tetrisGame.IsGameOver() && !game.Elimination.players[userID].Out {
+			toppedOut = append(toppedOut, userID)
+		}
+	}
+	sort.Ints(toppedOut)
+
+	for _, userID := range toppedOut {
+		player := game.Elimination.players[userID]
+		player.Out = true
+
+		koBy := 0
+		if attacker, ok := game.Elimination.players[player.lastAttacker]; ok && attacker.Team != player.Team {
+			koBy = player.lastAttacker
+			attacker.KOs++
+			attacker.Badges += 1 + player.Badges
+		}
+
+		if game.Elimination.teamOut(player.Team) {
+			placement := game.Elimination.teamsAlive
+			game.Elimination.teamsAlive--
+			for _, member := range game.Elimination.players {
+				if member.Team == player.Team {
+					member.Placement = placement
+				}
+			}
+
+			if game.Elimination.mode == ModeTeams {
+				h.broadcastToRoom(roomID, WebSocketMessage{
+					Type:   "team_eliminated",
+					RoomID: roomID,
+					Data: map[string]interface{}{
+						"team":       player.Team,
+						"placement":  placement,
+						"teamsAlive": game.Elimination.teamsAlive,
+					},
+				})
+			}
+		}
+
+		h.broadcastToRoom(roomID, WebSocketMessage{
+			Type:   "player_eliminated",
+			RoomID: roomID,
+			UserID: userID,
+			Data: map[string]interface{}{
+				"userID":    userID,
+				"team":      player.Team,
+				"placement": player.Placement,
+				"koBy":      koBy,
+				"alive":     game.Elimination.alive(),
+			},
+		})
+	}
+}
+
+// alive counts the players still in.
+func (e *eliminationState) alive() int {
+	alive := 0
+	for _, player := range e.players {
+		if !player.Out {
+			alive++
+		}
+	}
+	return alive
+}
+
+// eliminationOver reports whether at most one team is left. Callers must
+// hold the game's mutex.
+func (game *MultiplayerGame) eliminationOver() bool {
+	return game.Elimination.teamsAlive <= 1
+}
+
+// eliminationWinners returns the players on the team placed first. Callers
+// must hold the game's mutex.
+func (game *MultiplayerGame) eliminationWinners() []int {
+	var winners []int
+	for userID, player := range game.Elimination.players {
+		if player.Placement == 1 {
+			winners = append(winners, userID)
+		}
+	}
+	sort.Ints(winners)
+	return winners
+}
+
+// finishEliminationGame places the surviving team first, records every
+// placement and sends the final standings.
+func (h *Hub) finishEliminationGame(roomID string, game *MultiplayerGame) {
+	type standing struct {
+		UserID int `json:"userID"`
+		Score  int `json:"score"`
+		eliminationPlayer
+	}
+	type teamStanding struct {
+		Team      int   `json:"team"`
+		Placement int   `json:"placement"`
+		Score     int   `json:"score"`
+		Players   []int `json:"players"`
+	}
+
+	game.mutex.Lock()
+	mode := game.Elimination.mode
+	standings := make([]standing, 0, len(game.Players))
+	for userID, tetrisGame := range game.Players {
+		player := game.Elimination.players[userID]
+		if player.Placement == 0 {
+			player.Placement = 1
+		}
+		standings = append(standings, standing{UserID: userID, Score: tetrisGame.GetScore(), eliminationPlayer: *player})
+	}
+	game.mutex.Unlock()
+
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Placement != standings[j].Placement {
+			return standings[i].Placement < standings[j].Placement
+		}
+		return standings[i].UserID < standings[j].UserID
+	})
+
+	var teams []teamStanding
+	for _, s := range standings {
+		if err := h.db.FinishPlayerGame(roomID, s.UserID, s.Score, s.Placement); err != nil {
+			log.Printf("Failed to finish player %d: %v", s.UserID, err)
+		}
+
+		if len(teams) == 0 || teams[len(teams)-1].Team != s.Team {
+			teams = append(teams, teamStanding{Team: s.Team, Placement: s.Placement})
+		}
+		teams[len(teams)-1].Score += s.Score
+		teams[len(teams)-1].Players = append(teams[len(teams)-1].Players, s.UserID)
+	}
+
+	message := WebSocketMessage{
+		Type:   "royale_complete",
+		RoomID: roomID,
+		Data: map[string]interface{}{
+			"standings": standings,
+		},
+	}
+	if mode == ModeTeams {
+		message.Type = "team_battle_complete"
+		message.Data["teams"] = teams
+	}
+	h.broadcastToRoom(roomID, message)
+}
+
+// forfeitPlayer knocks out a player who left a battle royale or team battle
+// so the match carries on without them. It reports whether the room is
+// playing one.
+func (h *Hub) forfeitPlayer(roomID string, userID int) bool {
+	h.mutex.RLock()
+	game, exists := h.multiplayerGames[roomID]
+	h.mutex.RUnlock()
+	if !exists || game.Elimination == nil {
+		return false
+	}
+
+	game.mutex.Lock()
+	if tetrisGame, ok := game.Players[userID]; ok {
+		tetrisGame.Forfeit()
+	}
+	game.mutex.Unlock()
+	return true
+}
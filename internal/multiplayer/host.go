@@ -0,0 +1,134 @@
+package multiplayer
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+// hostGracePeriod is how long a disconnected host keeps the room, so a page
+// reload doesn't hand it to someone else.
+const hostGracePeriod = 30 * time.Second
+
+// rejectMessage tells the sender why their message was not applied.
+func (h *Hub) rejectMessage(message WebSocketMessage, reason string) {
+	h.sendToUserInRoom(message.UserID, message.RoomID, WebSocketMessage{
+		Type:   "error",
+		RoomID: message.RoomID,
+		Error:  reason,
+	})
+}
+
+// hostRoom loads the room a message was sent to and checks that its sender
+// is the host. Anyone else gets an error saying they can't do what they
+// asked, and ok is false.
+func (h *Hub) hostRoom(message WebSocketMessage, action string) (*database.MultiplayerRoom, bool) {
+	room, err := h.db.GetMultiplayerRoom(message.RoomID)
+	if err != nil {
+		log.Printf("Failed to get room %s: %v", message.RoomID, err)
+		return nil, false
+	}
+	if room.HostID != message.UserID {
+		log.Printf("User %d tried to %s in room %s without being host", message.UserID, action, message.RoomID)
+		h.rejectMessage(message, fmt.Sprintf("only the host can %s", action))
+		return nil, false
+	}
+	return room, true
+}
+
+// handleStartGame lets the host start the countdown once the room could
+// start on its own, saying what's missing otherwise.
+func (h *Hub) handleStartGame(message WebSocketMessage) {
+	if message.RoomID == "" {
+		return
+	}
+	room, ok := h.hostRoom(message, "start the game")
+	if !ok {
+		return
+	}
+
+	if room.Status != "waiting" {
+		h.rejectMessage(message, "the game has already started")
+		return
+	}
+	mode := RoomMode(room.Settings)
+	if minPlayers, _ := PlayerLimits(mode); len(room.Players) < minPlayers {
+		h.rejectMessage(message, fmt.Sprintf("%s rooms need at least %d players", mode, minPlayers))
+		return
+	}
+	for _, player := range room.Players {
+		if !player.IsReady {
+			h.rejectMessage(message, fmt.Sprintf("%s is not ready", player.Username))
+			return
+		}
+	}
+	if mode == ModeTeams {
+		if err := teamBalance(room); err != nil {
+			h.rejectMessage(message, err.Error())
+			return
+		}
+	}
+
+	h.startCountdown(room.ID, RoomCountdown(room.Settings))
+}
+
+// NotifyHostChanged tells the room who its new host is.
+func (h *Hub) NotifyHostChanged(roomID string, hostID int) {
+	room, err := h.db.GetMultiplayerRoom(roomID)
+	if err != nil {
+		log.Printf("Failed to get room %s after host change: %v", roomID, err)
+		return
+	}
+
+	username, err := h.getUsernameByID(hostID)
+	if err != nil {
+		log.Printf("Failed to get username for new host %d: %v", hostID, err)
+		username = "Unknown Player"
+	}
+	log.Printf("%s is now host of room %s", username, roomID)
+
+	h.broadcastToRoom(roomID, WebSocketMessage{
+		Type:   "host_changed",
+		RoomID: roomID,
+		Data: map[string]interface{}{
+			"host_id":  hostID,
+			"username": username,
+			"room":     room,
+		},
+	})
+}
+
+// migrateHostLater hands the room to the longest-waiting connected player
+// if its host disconnected and hasn't come back within hostGracePeriod.
+func (h *Hub) migrateHostLater(roomID string, hostID int) {
+	time.AfterFunc(hostGracePeriod, func() {
+		room, err := h.db.GetMultiplayerRoom(roomID)
+		if err != nil || room.HostID != hostID {
+			return
+		}
+
+		h.mutex.RLock()
+		connected := make(map[int]bool)
+		for client := range h.rooms[roomID] {
+			connected[client.UserID] = true
+		}
+		h.mutex.RUnlock()
+
+		if connected[hostID] {
+			return
+		}
+		for _, player := range room.Players {
+			if player.UserID == hostID || !connected[player.UserID] {
+				continue
+			}
+			if err := h.db.SetRoomHost(roomID, player.UserID); err != nil {
+				log.Printf("Failed to migrate host of room %s: %v", roomID, err)
+				return
+			}
+			h.NotifyHostChanged(roomID, player.UserID)
+			return
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package multiplayer
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+// matchPlayers collects each player's final result. Winners are placed
+// first; elimination games use their own placements, and everyone else is
+// ranked by score. Callers must hold the game's mutex.
+func (game *MultiplayerGame) matchPlayers(winners []int) []database.MatchPlayer {
+	if game.Coop != nil {
+		state := game.Coop.GetState()
+		players := make([]database.MatchPlayer, 0, len(game.CoopPlayers))
+		for _, userID := range game.CoopPlayers {
+			players = append(players, database.MatchPlayer{
+				UserID:    userID,
+				Placement: 1,
+				Score:     state.Score,
+				Lines:     state.Lines,
+				Stats: map[string]interface{}{
+					"level":         state.Level,
+					"time_played":   state.Stats.TimePlayed,
+					"pieces_placed": state.Stats.PiecesPlaced,
+					"line_stats":    state.Stats.LineStats,
+				},
+			})
+		}
+		return players
+	}
+
+	won := make(map[int]bool, len(winners))
+	for _, userID := range winners {
+		won[userID] = true
+	}
+
+	players := make([]database.MatchPlayer, 0, len(game.Players))
+	for userID, tetrisGame := range game.Players {
+		state := tetrisGame.GetState()
+		player := database.MatchPlayer{
+			UserID: userID,
+			Score:  state.Score,
+			Lines:  state.Lines,
+			Stats: map[string]interface{}{
+				"level":         state.Level,
+				"time_played":   state.Stats.TimePlayed,
+				"pieces_placed": state.Stats.PiecesPlaced,
+				"ppm":           state.Stats.PPM,
+				"line_stats":    state.Stats.LineStats,
+				"clears":        tetrisGame.ClearStats(),
+				"top_out":       state.TopOut,
+			},
+		}
+		if won[userID] {
+			player.Placement = 1
+		}
+		if game.Elimination != nil {
+			if e, ok := game.Elimination.players[userID]; ok {
+				player.Team = e.Team
+				player.Placement = e.Placement
+				player.Stats["kos"] = e.KOs
+				player.Stats["badges"] = e.Badges
+			}
+		}
+		players = append(players, player)
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		a, b := players[i], players[j]
+		if (a.Placement == 0) != (b.Placement == 0) {
+			return a.Placement != 0
+		}
+		if a.Placement != b.Placement {
+			return a.Placement < b.Placement
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.UserID < b.UserID
+	})
+
+	// Players without a placement yet are ranked after the winners by score,
+	// sharing a place when they tie.
+	for i := range players {
+		if players[i].Placement != 0 {
+			continue
+		}
+		if i > 0 && players[i-1].Score == players[i].Score && !won[players[i-1].UserID] {
+			players[i].Placement = players[i-1].Placement
+		} else {
+			players[i].Placement = i + 1
+		}
+	}
+	return players
+}
+
+// record builds the record of a game that has just ended, with each
+// player's result and the room's settings.
+func (game *MultiplayerGame) record(winners []int) *database.MultiplayerGame {
+	finishedAt := time.Now()
+	record := &database.MultiplayerGame{
+		ID:         generateRecordID(),
+		RoomID:     game.RoomID,
+		GameType:   game.GameType,
+		Duration:   int(finishedAt.Sub(game.StartTime).Seconds()),
+		StartedAt:  game.StartTime,
+		FinishedAt: finishedAt,
+		Settings:   &game.Settings,
+		Metadata: map[string]interface{}{
+			"winners": winners,
+		},
+	}
+	if len(winners) > 0 {
+		record.Winner = &winners[0]
+	}
+	if game.Elimination != nil {
+		record.Metadata["mode"] = game.Elimination.mode
+	} else if game.Coop != nil {
+		record.Metadata["mode"] = ModeCoop
+	} else {
+		record.Metadata["mode"] = ModeVersus
+	}
+	if game.Set != nil {
+		record.SetID = &game.Set.ID
+		record.Metadata["round"] = game.Set.Round
+	}
+
+	game.mutex.RLock()
+	record.Players = game.matchPlayers(winners)
+	game.mutex.RUnlock()
+	return record
+}
+
+func (h *Hub) saveGameRecord(record *database.MultiplayerGame) {
+	if err := h.db.SaveMultiplayerGame(record); err != nil {
+		log.Printf("Failed to save game for room %s: %v", record.RoomID, err)
+	}
+}
+
+// recordAbandonedGame saves a game cut short by a disconnect. The players
+// who stayed share the win and the one who left is placed last.
+func (h *Hub) recordAbandonedGame(game *MultiplayerGame, leaverID int) {
+	game.mutex.RLock()
+	var winners []int
+	for userID := range game.Players {
+		if userID != leaverID {
+			winners = append(winners, userID)
+		}
+	}
+	game.mutex.RUnlock()
+	sort.Ints(winners)
+
+	record := game.record(winners)
+	record.Metadata["abandoned"] = true
+	h.saveGameRecord(record)
+}
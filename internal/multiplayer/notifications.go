@@ -0,0 +1,56 @@
+package multiplayer
+
+import "log"
+
+// NotifyUser sends a message to every user-level socket the user has open,
+// see ServeUserWS. This is how anything not tied to a room reaches them,
+// e.g. invites, achievements and moderator messages. It reports whether the
+// user had a socket to send it to.
+func (h *Hub) NotifyUser(userID int, messageType string, data map[string]interface{}) bool {
+	delivered := false
+	for _, client := range h.userClients(userID) {
+		if client.RoomID != "" {
+			continue
+		}
+		h.sendToClient(client, WebSocketMessage{Type: messageType, Data: data})
+		delivered = true
+	}
+	return delivered
+}
+
+// SaveScore saves a finished game's score and tells the player about any
+// achievements it unlocked.
+func (h *Hub) SaveScore(userID int, gameType string, score int, metadata map[string]interface{}) error {
+	before, err := h.db.GetUserAchievements(userID, gameType)
+	if err != nil {
+		log.Printf("Failed to get achievements of user %d: %v", userID, err)
+	}
+
+	if err := h.db.SaveGameScore(userID, gameType, score, metadata); err != nil {
+		return err
+	}
+
+	after, err := h.db.GetUserAchievements(userID, gameType)
+	if err != nil {
+		log.Printf("Failed to get achievements of user %d: %v", userID, err)
+		return nil
+	}
+
+	had := make(map[string]bool, len(before))
+	for _, achievement := range before {
+		had[achievement] = true
+	}
+	var unlocked []string
+	for _, achievement := range after {
+		if !had[achievement] {
+			unlocked = append(unlocked, achievement)
+		}
+	}
+	if len(unlocked) > 0 {
+		h.NotifyUser(userID, "achievement_unlocked", map[string]interface{}{
+			"game_type":    gameType,
+			"achievements": unlocked,
+		})
+	}
+	return nil
+}
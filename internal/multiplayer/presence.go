@@ -0,0 +1,92 @@
+package multiplayer
+
+import "log"
+
+// Presence statuses, from least to most specific.
+const (
+	PresenceOffline    = "offline"
+	PresenceOnline     = "online"
+	PresenceSpectating = "spectating"
+	PresenceInGame     = "in_game"
+)
+
+// Presence is what a user is doing, as far as the hub can tell from their
+// connected clients. RoomID is the room they are playing or watching in.
+type Presence struct {
+	Status string `json:"status"`
+	RoomID string `json:"room_id,omitempty"`
+}
+
+// Presence returns the user's presence. A user playing in one room and
+// watching another is shown as playing.
+func (h *Hub) Presence(userID int) Presence {
+	connected := false
+	games := make(map[string]*MultiplayerGame)
+
+	h.mutex.RLock()
+	for client := range h.users[userID] {
+		connected = true
+		if game, ok := h.multiplayerGames[client.RoomID]; ok {
+			games[client.RoomID] = game
+		}
+	}
+	h.mutex.RUnlock()
+
+	if !connected {
+		return Presence{Status: PresenceOffline}
+	}
+
+	presence := Presence{Status: PresenceOnline}
+	for roomID, game := range games {
+		if game.hasPlayer(userID) {
+			return Presence{Status: PresenceInGame, RoomID: roomID}
+		}
+		presence = Presence{Status: PresenceSpectating, RoomID: roomID}
+	}
+	return presence
+}
+
+func (game *MultiplayerGame) hasPlayer(userID int) bool {
+	game.mutex.RLock()
+	defer game.mutex.RUnlock()
+	if game.Coop != nil {
+		return game.coopPlayer(userID) >= 0
+	}
+	_, ok := game.Players[userID]
+	return ok
+}
+
+// notifyPresenceChanged tells the user's friends what they are doing now.
+func (h *Hub) notifyPresenceChanged(userID int) {
+	friendIDs, err := h.db.GetFriendIDs(userID)
+	if err != nil {
+		log.Printf("Failed to get friends of user %d: %v", userID, err)
+		return
+	}
+	if len(friendIDs) == 0 {
+		return
+	}
+
+	presence := h.Presence(userID)
+	for _, friendID := range friendIDs {
+		h.NotifyUser(friendID, "presence_update", map[string]interface{}{
+			"user_id":  userID,
+			"presence": presence,
+		})
+	}
+}
+
+// notifyRoomPresence sends presence updates for everyone connected to a
+// room, after its game has started or ended.
+func (h *Hub) notifyRoomPresence(roomID string) {
+	h.mutex.RLock()
+	userIDs := make(map[int]bool)
+	for client := range h.rooms[roomID] {
+		userIDs[client.UserID] = true
+	}
+	h.mutex.RUnlock()
+
+	for userID := range userIDs {
+		h.notifyPresenceChanged(userID)
+	}
+}
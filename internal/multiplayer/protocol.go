@@ -0,0 +1,397 @@
+package multiplayer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+// Protocol versions understood by the hub. Version 1 is what clients that
+// don't ask for a version get; it tolerates unknown fields so older clients
+// keep working. Version 2 rejects anything not described by the schema.
+const (
+	MinProtocolVersion = 1
+	ProtocolVersion    = 2
+)
+
+const subprotocolPrefix = "notris.v"
+
+// maxMessageSize bounds a single inbound websocket frame.
+const maxMessageSize = 4096
+
+// Payload is the typed body of an inbound message's data field.
+type Payload interface {
+	Validate() error
+}
+
+type EmptyPayload struct{}
+
+func (p *EmptyPayload) Validate() error { return nil }
+
+type HeartbeatPayload struct {
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+func (p *HeartbeatPayload) Validate() error { return nil }
+
+type GameStatePayload struct {
+	Board     [][]int `json:"board,omitempty" schema:"maxItems=64"`
+	Score     int     `json:"score" schema:"min=0"`
+	Level     int     `json:"level" schema:"min=0"`
+	Lines     int     `json:"lines" schema:"min=0"`
+	GameOver  bool    `json:"gameOver"`
+	Paused    bool    `json:"paused"`
+	Timestamp int64   `json:"timestamp,omitempty"`
+}
+
+func (p *GameStatePayload) Validate() error {
+	if p.Score < 0 || p.Level < 0 || p.Lines < 0 {
+		return fmt.Errorf("score, level and lines must be non-negative")
+	}
+	if len(p.Board) > 64 {
+		return fmt.Errorf("board has too many rows")
+	}
+	for _, row := range p.Board {
+		if len(row) > 64 {
+			return fmt.Errorf("board has too many columns")
+		}
+	}
+	return nil
+}
+
+func (p *GameStatePayload) data() map[string]interface{} {
+	return map[string]interface{}{
+		"board":     p.Board,
+		"score":     p.Score,
+		"level":     p.Level,
+		"lines":     p.Lines,
+		"gameOver":  p.GameOver,
+		"paused":    p.Paused,
+		"timestamp": p.Timestamp,
+	}
+}
+
+type PlayerReadyPayload struct {
+	Ready bool `json:"ready"`
+}
+
+func (p *PlayerReadyPayload) Validate() error { return nil }
+
+// GameInputPayload is one input for the sender's game. Clients that predict
+// locally set Seq (starting at 1) and the engine Frame they applied it at;
+// without a Seq the input is applied as soon as it arrives.
+type GameInputPayload struct {
+	Action string `json:"action" schema:"required"`
+	Seq    uint32 `json:"seq,omitempty"`
+	Frame  uint64 `json:"frame,omitempty"`
+}
+
+func (p *GameInputPayload) Validate() error {
+	if p.Action == "" {
+		return fmt.Errorf("action is required")
+	}
+	if !tetris.IsValidInput(p.Action) {
+		return fmt.Errorf("unknown action %q", p.Action)
+	}
+	return nil
+}
+
+func (p *GameInputPayload) schemaEnums() map[string][]string {
+	return map[string][]string{"action": tetris.WebInputs()}
+}
+
+type PlayerFinishedPayload struct {
+	Score    int                    `json:"score" schema:"min=0"`
+	Lines    int                    `json:"lines" schema:"min=0"`
+	Position int                    `json:"position,omitempty" schema:"min=0"`
+	Stats    map[string]interface{} `json:"stats,omitempty"`
+}
+
+func (p *PlayerFinishedPayload) Validate() error {
+	if p.Score < 0 || p.Lines < 0 || p.Position < 0 {
+		return fmt.Errorf("score, lines and position must be non-negative")
+	}
+	return nil
+}
+
+type MultiplayerInitPayload struct {
+	StartingLevel int `json:"startingLevel" schema:"required,min=1,max=29"`
+}
+
+func (p *MultiplayerInitPayload) Validate() error {
+	if p.StartingLevel < 1 || p.StartingLevel > 29 {
+		return fmt.Errorf("startingLevel must be between 1 and 29")
+	}
+	return nil
+}
+
+type SetLevelPayload struct {
+	Level int `json:"level" schema:"required,min=1,max=29"`
+}
+
+func (p *SetLevelPayload) Validate() error {
+	if p.Level < 1 || p.Level > 29 {
+		return fmt.Errorf("level must be between 1 and 29")
+	}
+	return nil
+}
+
+type PlayerDisconnectPayload struct {
+	Reason    string `json:"reason,omitempty" schema:"maxLength=64"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+func (p *PlayerDisconnectPayload) Validate() error {
+	if len(p.Reason) > 64 {
+		return fmt.Errorf("reason is too long")
+	}
+	return nil
+}
+
+// SetHandlingPayload sets the sender's DAS/ARR/SDF, in 50ms engine frames.
+// It applies to the current game straight away and to later games in the
+// same session.
+type SetHandlingPayload struct {
+	DAS int `json:"das" schema:"required,min=0,max=20"`
+	ARR int `json:"arr" schema:"required,min=0,max=10"`
+	SDF int `json:"sdf" schema:"required,min=0,max=100"`
+}
+
+func (p *SetHandlingPayload) Validate() error {
+	return p.handling().Validate()
+}
+
+func (p *SetHandlingPayload) handling() tetris.Handling {
+	return tetris.Handling{DAS: p.DAS, ARR: p.ARR, SDF: p.SDF}
+}
+
+// ChooseTeamPayload moves the sender to a team in a team room's waiting
+// room. Teams are numbered from 1.
+type ChooseTeamPayload struct {
+	Team int `json:"team" schema:"required,min=1,max=4"`
+}
+
+func (p *ChooseTeamPayload) Validate() error {
+	if p.Team < 1 || p.Team > maxTeams {
+		return fmt.Errorf("team must be between 1 and %d", maxTeams)
+	}
+	return nil
+}
+
+// ChatMessagePayload is a chat message to the sender's room, or to the lobby
+// when sent from the room browser.
+type ChatMessagePayload struct {
+	Text string `json:"text" schema:"required,maxLength=500"`
+}
+
+func (p *ChatMessagePayload) Validate() error {
+	if strings.TrimSpace(p.Text) == "" {
+		return fmt.Errorf("text is required")
+	}
+	if utf8.RuneCountInString(p.Text) > maxChatLength {
+		return fmt.Errorf("text must be at most %d characters", maxChatLength)
+	}
+	return nil
+}
+
+// ChatIgnorePayload mutes or blocks another user's chat. Leaving out kind
+// clears it again.
+type ChatIgnorePayload struct {
+	UserID int    `json:"user_id" schema:"required,min=1"`
+	Kind   string `json:"kind,omitempty"`
+}
+
+func (p *ChatIgnorePayload) Validate() error {
+	if p.UserID < 1 {
+		return fmt.Errorf("user_id is required")
+	}
+	switch p.Kind {
+	case "", database.ChatMute, database.ChatBlock:
+		return nil
+	}
+	return fmt.Errorf("unknown kind %q", p.Kind)
+}
+
+func (p *ChatIgnorePayload) schemaEnums() map[string][]string {
+	return map[string][]string{"kind": {database.ChatMute, database.ChatBlock}}
+}
+
+// ChatDeletePayload removes a chat message. Only admins may send it.
+type ChatDeletePayload struct {
+	ID string `json:"id" schema:"required,maxLength=50"`
+}
+
+func (p *ChatDeletePayload) Validate() error {
+	if p.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if len(p.ID) > 50 {
+		return fmt.Errorf("id is too long")
+	}
+	return nil
+}
+
+// inboundPayloads maps every message type a client may send to its payload.
+var inboundPayloads = map[string]func() Payload{
+	"game_state":        func() Payload { return &GameStatePayload{} },
+	"player_ready":      func() Payload { return &PlayerReadyPayload{} },
+	"start_game":        func() Payload { return &EmptyPayload{} },
+	"game_input":        func() Payload { return &GameInputPayload{} },
+	"player_finished":   func() Payload { return &PlayerFinishedPayload{} },
+	"spectate_request":  func() Payload { return &EmptyPayload{} },
+	"multiplayerInit":   func() Payload { return &MultiplayerInitPayload{} },
+	"setLevel":          func() Payload { return &SetLevelPayload{} },
+	"player_disconnect": func() Payload { return &PlayerDisconnectPayload{} },
+	"heartbeat":         func() Payload { return &HeartbeatPayload{} },
+	"state_ack":         func() Payload { return &StateAckPayload{} },
+	"set_handling":      func() Payload { return &SetHandlingPayload{} },
+	"choose_team":       func() Payload { return &ChooseTeamPayload{} },
+	"chat_message":      func() Payload { return &ChatMessagePayload{} },
+	"chat_ignore":       func() Payload { return &ChatIgnorePayload{} },
+	"chat_delete":       func() Payload { return &ChatDeletePayload{} },
+}
+
+// inboundMessage is the wire envelope of a client message before its data
+// has been decoded into a typed Payload. room_id and user_id are accepted for
+// compatibility but always replaced by the values bound to the connection.
+type inboundMessage struct {
+	Type   string          `json:"type"`
+	RoomID string          `json:"room_id,omitempty"`
+	UserID int             `json:"user_id,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// Error codes sent back in the data of an "error" message.
+const (
+	errCodeMalformed   = "malformed_message"
+	errCodeUnknownType = "unknown_type"
+	errCodeInvalid     = "invalid_payload"
+)
+
+type protocolError struct {
+	Code        string
+	MessageType string
+	Err         error
+}
+
+func (e *protocolError) Error() string {
+	return e.Err.Error()
+}
+
+// decodeMessage parses and validates a raw client frame for the given
+// protocol version.
+func decodeMessage(version int, raw []byte) (WebSocketMessage, *protocolError) {
+	var envelope inboundMessage
+	if err := strictUnmarshal(version, raw, &envelope); err != nil {
+		return WebSocketMessage{}, &protocolError{Code: errCodeMalformed, Err: fmt.Errorf("invalid message: %w", err)}
+	}
+
+	newPayload, ok := inboundPayloads[envelope.Type]
+	if !ok {
+		return WebSocketMessage{}, &protocolError{
+			Code:        errCodeUnknownType,
+			MessageType: envelope.Type,
+			Err:         fmt.Errorf("unknown message type %q", envelope.Type),
+		}
+	}
+
+	payload := newPayload()
+	if len(envelope.Data) > 0 && !bytes.Equal(envelope.Data, []byte("null")) {
+		if err := strictUnmarshal(version, envelope.Data, payload); err != nil {
+			return WebSocketMessage{}, &protocolError{
+				Code:        errCodeInvalid,
+				MessageType: envelope.Type,
+				Err:         fmt.Errorf("invalid data for %s: %w", envelope.Type, err),
+			}
+		}
+	}
+
+	if err := payload.Validate(); err != nil {
+		return WebSocketMessage{}, &protocolError{
+			Code:        errCodeInvalid,
+			MessageType: envelope.Type,
+			Err:         fmt.Errorf("invalid data for %s: %w", envelope.Type, err),
+		}
+	}
+
+	return WebSocketMessage{Type: envelope.Type, Payload: payload}, nil
+}
+
+func strictUnmarshal(version int, raw []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if version >= 2 {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// negotiateProtocol picks the protocol version for a new connection from the
+// "protocol" query parameter or, failing that, the "notris.vN" websocket
+// subprotocols the client offers. Clients asking for a newer version than the
+// server speaks get the newest one it does; clients asking for nothing get
+// version 1. The returned subprotocol, if any, must be echoed in the upgrade
+// response.
+func negotiateProtocol(r *http.Request) (int, string, error) {
+	if value := r.URL.Query().Get("protocol"); value != "" {
+		requested, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid protocol version %q", value)
+		}
+		if requested < MinProtocolVersion {
+			return 0, "", fmt.Errorf("protocol version %d is no longer supported (minimum %d)", requested, MinProtocolVersion)
+		}
+		if requested > ProtocolVersion {
+			requested = ProtocolVersion
+		}
+		return requested, "", nil
+	}
+
+	offered := websocketSubprotocols(r)
+	if len(offered) == 0 {
+		return MinProtocolVersion, "", nil
+	}
+
+	chosen := 0
+	for _, subprotocol := range offered {
+		version, err := strconv.Atoi(strings.TrimPrefix(subprotocol, subprotocolPrefix))
+		if err == nil && version >= MinProtocolVersion && version <= ProtocolVersion && version > chosen {
+			chosen = version
+		}
+	}
+	if chosen == 0 {
+		return 0, "", fmt.Errorf("none of the offered protocol versions are supported")
+	}
+	return chosen, subprotocolPrefix + strconv.Itoa(chosen), nil
+}
+
+func websocketSubprotocols(r *http.Request) []string {
+	var subprotocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, value := range strings.Split(header, ",") {
+			value = strings.TrimSpace(value)
+			if strings.HasPrefix(value, subprotocolPrefix) {
+				subprotocols = append(subprotocols, value)
+			}
+		}
+	}
+	return subprotocols
+}
+
+func (c *Client) sendProtocolError(perr *protocolError) {
+	c.Hub.sendToClient(c, WebSocketMessage{
+		Type:   "error",
+		RoomID: c.RoomID,
+		Error:  perr.Error(),
+		Data: map[string]interface{}{
+			"code":         perr.Code,
+			"message_type": perr.MessageType,
+		},
+	})
+}
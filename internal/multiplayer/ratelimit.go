@@ -0,0 +1,84 @@
+package multiplayer
+
+import (
+	"log"
+	"time"
+
+	"github.com/isaacjstriker/devware/internal/ratelimit"
+)
+
+// MessageLimits controls how fast a single websocket client may send
+// messages to the hub and how the hub escalates when it doesn't comply.
+type MessageLimits struct {
+	PerSecond float64
+	Burst     int
+	// WarnAfter is the number of dropped messages after which the client is
+	// sent a rate_limited warning (repeated every WarnAfter drops).
+	WarnAfter int
+	// DisconnectAfter is the number of dropped messages after which the
+	// client is disconnected.
+	DisconnectAfter int
+}
+
+// violationResetAfter is how long a client has to stay within its limit
+// before its dropped-message count is forgiven.
+const violationResetAfter = 10 * time.Second
+
+type rateAction int
+
+const (
+	rateAllow rateAction = iota
+	rateDrop
+	rateWarn
+	rateDisconnect
+)
+
+func newMessageBucket(limits MessageLimits) *ratelimit.Bucket {
+	if limits.PerSecond <= 0 {
+		return nil
+	}
+	return ratelimit.NewBucket(limits.PerSecond, limits.Burst)
+}
+
+// checkMessageRate is called from readPump for every incoming message and
+// decides whether it is processed, dropped, warned about or ends the
+// connection.
+func (c *Client) checkMessageRate() rateAction {
+	if c.limiter == nil {
+		return rateAllow
+	}
+
+	now := time.Now()
+	if c.violations > 0 && now.Sub(c.lastViolation) > violationResetAfter {
+		c.violations = 0
+	}
+
+	if c.limiter.Allow() {
+		return rateAllow
+	}
+
+	c.violations++
+	c.lastViolation = now
+
+	limits := c.Hub.messageLimits
+	if limits.DisconnectAfter > 0 && c.violations >= limits.DisconnectAfter {
+		return rateDisconnect
+	}
+	if limits.WarnAfter > 0 && c.violations%limits.WarnAfter == 0 {
+		return rateWarn
+	}
+	return rateDrop
+}
+
+func (c *Client) warnRateLimited() {
+	log.Printf("Client %s (user %d) is sending messages too fast, %d dropped", c.ID, c.UserID, c.violations)
+
+	c.Hub.sendToClient(c, WebSocketMessage{
+		Type:   "rate_limited",
+		RoomID: c.RoomID,
+		Data: map[string]interface{}{
+			"dropped": c.violations,
+			"message": "You are sending messages too fast; some were ignored",
+		},
+	})
+}
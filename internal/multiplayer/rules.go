@@ -0,0 +1,125 @@
+package multiplayer
+
+import (
+	"fmt"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+const maxStartingLevel = 29
+
+// RoomRules returns the rules a room plays by: tetris.DefaultRules unless
+// the room set its own.
+func RoomRules(settings database.RoomSettings) tetris.Rules {
+	if settings.Rules == nil {
+		return tetris.DefaultRules()
+	}
+	return *settings.Rules
+}
+
+// Room modes, set by a room's "mode" setting.
+const (
+	ModeVersus = "versus"
+	ModeCoop   = "coop"
+	ModeRoyale = "royale"
+	ModeTeams  = "teams"
+)
+
+// RoomMode returns a room's mode. Rooms without one are versus.
+func RoomMode(settings database.RoomSettings) string {
+	if settings.Mode == "" {
+		return ModeVersus
+	}
+	return settings.Mode
+}
+
+// RoomStartingLevel returns the level a room's games start on.
+func RoomStartingLevel(settings database.RoomSettings) int {
+	if settings.StartingLevel == 0 {
+		return 1
+	}
+	return settings.StartingLevel
+}
+
+// PlayerLimits returns the fewest and most players a room of the given mode
+// can hold.
+func PlayerLimits(mode string) (int, int) {
+	switch mode {
+	case ModeCoop:
+		return tetris.MinCoopPlayers, tetris.MaxCoopPlayers
+	case ModeRoyale:
+		return 16, 99
+	case ModeTeams:
+		return 4, maxTeams * maxTeamSize
+	}
+	return 2, 8
+}
+
+// ValidateRoomSettings checks the settings of a new room with room for
+// maxPlayers, and fills in the default for every setting left out.
+func ValidateRoomSettings(settings *database.RoomSettings, maxPlayers int) error {
+	if settings.StartingLevel == 0 {
+		settings.StartingLevel = 1
+	}
+	if settings.StartingLevel < 1 || settings.StartingLevel > maxStartingLevel {
+		return fmt.Errorf("starting_level must be between 1 and %d", maxStartingLevel)
+	}
+
+	if settings.Rules != nil {
+		if err := settings.Rules.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if settings.Mode == "" {
+		settings.Mode = ModeVersus
+	}
+	switch settings.Mode {
+	case ModeVersus, ModeCoop, ModeRoyale, ModeTeams:
+	default:
+		return fmt.Errorf("unknown mode %q", settings.Mode)
+	}
+
+	minPlayers, most := PlayerLimits(settings.Mode)
+	if maxPlayers < minPlayers || maxPlayers > most {
+		return fmt.Errorf("max_players must be between %d and %d for %s rooms", minPlayers, most, settings.Mode)
+	}
+
+	if settings.Mode == ModeTeams {
+		if settings.Teams == 0 {
+			settings.Teams = 2
+		}
+		if settings.Teams < 2 || settings.Teams > maxTeams {
+			return fmt.Errorf("teams must be between 2 and %d", maxTeams)
+		}
+		if maxPlayers%settings.Teams != 0 {
+			return fmt.Errorf("max_players must divide evenly into %d teams", settings.Teams)
+		}
+		if size := maxPlayers / settings.Teams; size < 2 || size > maxTeamSize {
+			return fmt.Errorf("teams must have between 2 and %d players", maxTeamSize)
+		}
+	} else if settings.Teams != 0 {
+		return fmt.Errorf("teams can only be set for team rooms")
+	}
+
+	if settings.FirstTo == 0 {
+		settings.FirstTo = 1
+	}
+	if settings.FirstTo < 1 || settings.FirstTo > maxFirstTo {
+		return fmt.Errorf("first_to must be between 1 and %d", maxFirstTo)
+	}
+	if settings.Mode == ModeCoop && settings.FirstTo > 1 {
+		return fmt.Errorf("co-op rooms can't play sets")
+	}
+
+	if settings.Countdown == nil {
+		seconds := defaultCountdown
+		settings.Countdown = &seconds
+	}
+	if *settings.Countdown < 0 || *settings.Countdown > maxCountdown {
+		return fmt.Errorf("countdown must be between 0 and %d seconds", maxCountdown)
+	}
+
+	return nil
+}
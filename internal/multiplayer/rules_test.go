@@ -0,0 +1,85 @@
+package multiplayer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+func TestValidateRoomSettings(t *testing.T) {
+	countdown := func(seconds int) *int { return &seconds }
+	badRules := tetris.DefaultRules()
+	badRules.Width = 3
+
+	tests := []struct {
+		name       string
+		settings   database.RoomSettings
+		maxPlayers int
+		// want is the settings with defaults filled in, for valid rooms.
+		want  database.RoomSettings
+		valid bool
+	}{
+		{
+			name:       "defaults filled in",
+			maxPlayers: 2,
+			want:       database.RoomSettings{StartingLevel: 1, Mode: ModeVersus, FirstTo: 1, Countdown: countdown(defaultCountdown)},
+			valid:      true,
+		},
+		{
+			name:       "zero countdown kept",
+			settings:   database.RoomSettings{Mode: ModeVersus, Countdown: countdown(0)},
+			maxPlayers: 8,
+			want:       database.RoomSettings{StartingLevel: 1, Mode: ModeVersus, FirstTo: 1, Countdown: countdown(0)},
+			valid:      true,
+		},
+		{
+			name:       "teams default to two",
+			settings:   database.RoomSettings{Mode: ModeTeams},
+			maxPlayers: 6,
+			want:       database.RoomSettings{StartingLevel: 1, Mode: ModeTeams, Teams: 2, FirstTo: 1, Countdown: countdown(defaultCountdown)},
+			valid:      true,
+		},
+		{
+			name:       "royale set",
+			settings:   database.RoomSettings{Mode: ModeRoyale, FirstTo: 3, StartingLevel: 5},
+			maxPlayers: 99,
+			want:       database.RoomSettings{StartingLevel: 5, Mode: ModeRoyale, FirstTo: 3, Countdown: countdown(defaultCountdown)},
+			valid:      true,
+		},
+		{name: "starting level too high", settings: database.RoomSettings{StartingLevel: maxStartingLevel + 1}, maxPlayers: 2},
+		{name: "invalid rules", settings: database.RoomSettings{Rules: &badRules}, maxPlayers: 2},
+		{name: "unknown mode", settings: database.RoomSettings{Mode: "zombies"}, maxPlayers: 2},
+		{name: "too many for versus", maxPlayers: 9},
+		{name: "too few for royale", settings: database.RoomSettings{Mode: ModeRoyale}, maxPlayers: 15},
+		{name: "too many for co-op", settings: database.RoomSettings{Mode: ModeCoop}, maxPlayers: tetris.MaxCoopPlayers + 1},
+		{name: "too many teams", settings: database.RoomSettings{Mode: ModeTeams, Teams: maxTeams + 1}, maxPlayers: 10},
+		{name: "teams don't divide", settings: database.RoomSettings{Mode: ModeTeams, Teams: 3}, maxPlayers: 8},
+		{name: "teams too big", settings: database.RoomSettings{Mode: ModeTeams, Teams: 2}, maxPlayers: 8},
+		{name: "teams outside team rooms", settings: database.RoomSettings{Teams: 2}, maxPlayers: 4},
+		{name: "first to too high", settings: database.RoomSettings{FirstTo: maxFirstTo + 1}, maxPlayers: 2},
+		{name: "co-op set", settings: database.RoomSettings{Mode: ModeCoop, FirstTo: 2}, maxPlayers: 2},
+		{name: "countdown too long", settings: database.RoomSettings{Countdown: countdown(maxCountdown + 1)}, maxPlayers: 2},
+		{name: "negative countdown", settings: database.RoomSettings{Countdown: countdown(-1)}, maxPlayers: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := tt.settings
+			err := ValidateRoomSettings(&settings, tt.maxPlayers)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("ValidateRoomSettings accepted %+v for %d players", tt.settings, tt.maxPlayers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateRoomSettings returned %v", err)
+			}
+			if !reflect.DeepEqual(settings, tt.want) {
+				t.Errorf("settings = %+v, want %+v", settings, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package multiplayer
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemaEnumer is implemented by payloads whose string fields only accept a
+// fixed set of values that can't be expressed in a struct tag.
+type schemaEnumer interface {
+	schemaEnums() map[string][]string
+}
+
+// ProtocolSchema generates a JSON Schema document describing every message a
+// client may send to the hub. It is built from the payload structs
+// themselves, so it can't drift from what the server actually accepts.
+func ProtocolSchema() map[string]interface{} {
+	types := make([]string, 0, len(inboundPayloads))
+	for messageType := range inboundPayloads {
+		types = append(types, messageType)
+	}
+	sort.Strings(types)
+
+	defs := make(map[string]interface{})
+	variants := make([]interface{}, 0, len(types))
+
+	for _, messageType := range types {
+		payload := inboundPayloads[messageType]()
+		payloadType := reflect.TypeOf(payload).Elem()
+		defs[payloadType.Name()] = payloadSchema(payload, payloadType)
+
+		variants = append(variants, map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":    map[string]interface{}{"const": messageType},
+				"room_id": map[string]interface{}{"type": "string"},
+				"user_id": map[string]interface{}{"type": "integer"},
+				"data":    map[string]interface{}{"$ref": "#/$defs/" + payloadType.Name()},
+			},
+			"required":             []string{"type"},
+			"additionalProperties": false,
+		})
+	}
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         "https://notris-online.onrender.com/api/ws/schema",
+		"title":       "Notris room websocket protocol (client to server)",
+		"description": "Connect to /ws/room/{roomId}?token=...&protocol=N. Every server reply to an invalid message has type \"error\" with data.code set to one of malformed_message, unknown_type or invalid_payload.",
+		"version":     ProtocolVersion,
+		"minVersion":  MinProtocolVersion,
+		"oneOf":       variants,
+		"$defs":       defs,
+	}
+}
+
+func payloadSchema(payload Payload, payloadType reflect.Type) map[string]interface{} {
+	var enums map[string][]string
+	if enumer, ok := payload.(schemaEnumer); ok {
+		enums = enumer.schemaEnums()
+	}
+
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < payloadType.NumField(); i++ {
+		field := payloadType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		property := typeSchema(field.Type)
+		for _, rule := range strings.Split(field.Tag.Get("schema"), ",") {
+			key, value, _ := strings.Cut(rule, "=")
+			switch key {
+			case "required":
+				required = append(required, name)
+			case "min":
+				property["minimum"], _ = strconv.Atoi(value)
+			case "max":
+				property["maximum"], _ = strconv.Atoi(value)
+			case "maxItems":
+				property["maxItems"], _ = strconv.Atoi(value)
+			case "maxLength":
+				property["maxLength"], _ = strconv.Atoi(value)
+			}
+		}
+		if values, ok := enums[name]; ok {
+			property["enum"] = values
+		}
+
+		properties[name] = property
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" || !field.IsExported() {
+				continue
+			}
+			properties[name] = typeSchema(field.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,255 @@
+package multiplayer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+const (
+	maxFirstTo = 9
+	// roundCountdown is the pause between the rounds of a set.
+	roundCountdown = 5 * time.Second
+)
+
+// RoomFirstTo returns how many round wins take a set in a room. Rooms that
+// don't play sets have 1.
+func RoomFirstTo(settings database.RoomSettings) int {
+	if settings.FirstTo == 0 {
+		return 1
+	}
+	return settings.FirstTo
+}
+
+// matchSet is a first-to-N set in progress in a room.
+type matchSet struct {
+	ID        string
+	FirstTo   int
+	Wins      map[int]int
+	Round     int
+	StartedAt time.Time
+}
+
+func (s *matchSet) data() map[string]interface{} {
+	return map[string]interface{}{
+		"id":       s.ID,
+		"first_to": s.FirstTo,
+		"wins":     s.Wins,
+		"round":    s.Round,
+	}
+}
+
+// winner returns the user who has taken the set: the only player with the
+// most wins, once that reaches the target. Players tied on the most wins at
+// or past the target play on until one of them wins a round alone, and
+// tiebreak reports that the set is in that state.
+func (s *matchSet) winner() (winner int, won, tiebreak bool) {
+	most, leaders := 0, 0
+	for userID, wins := range s.Wins {
+		switch {
+		case wins > most:
+			most, leaders, winner = wins, 1, userID
+		case wins == most:
+			leaders++
+		}
+	}
+	if most < s.FirstTo {
+		return 0, false, false
+	}
+	if leaders > 1 {
+		return 0, false, true
+	}
+	return winner, true, false
+}
+
+func generateRecordID() string {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return generateClientID()
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// newMatchSet returns a new set for a room that plays first-to-N, or nil
+// for single-game rooms. It isn't the room's set until claimSet makes it so.
+func newMatchSet(settings database.RoomSettings) *matchSet {
+	firstTo := RoomFirstTo(settings)
+	if firstTo <= 1 {
+		return nil
+	}
+	return &matchSet{
+		ID:        generateRecordID(),
+		FirstTo:   firstTo,
+		Wins:      make(map[int]int),
+		StartedAt: time.Now(),
+	}
+}
+
+// claimSet returns the room's set in progress, making set the room's set if
+// none is running, and reports whether it did. Callers must hold h.mutex.
+func (h *Hub) claimSet(roomID string, set *matchSet) (*matchSet, bool) {
+	if current, ok := h.sets[roomID]; ok {
+		return current, false
+	}
+	h.sets[roomID] = set
+	return set, true
+}
+
+// recordSet saves a set claimSet has just started. It goes to the database
+// outside the hub's lock so a slow write doesn't hold up every client.
+func (h *Hub) recordSet(roomID string, set *matchSet) {
+	err := h.db.CreateMatchSet(&database.MatchSet{
+		ID:        set.ID,
+		RoomID:    roomID,
+		FirstTo:   set.FirstTo,
+		StartedAt: set.StartedAt,
+	})
+	if err != nil {
+		log.Printf("Failed to record set for room %s: %v", roomID, err)
+	}
+}
+
+// setData returns the set score of the room's set in progress, or nil.
+func (h *Hub) setData(roomID string) map[string]interface{} {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if set, ok := h.sets[roomID]; ok {
+		return set.data()
+	}
+	return nil
+}
+
+// survivors returns the winners of a versus game: the players still in, or
+// the highest scorers if everyone topped out together. Callers must hold the
+// game's mutex.
+func (game *MultiplayerGame) survivors() []int {
+	var winners []int
+	for userID, tetrisGame := range game.Players {
+		if !tetrisGame.IsGameOver() {
+			winners = append(winners, userID)
+		}
+	}
+	if len(winners) == 0 {
+		best := -1
+		for userID, tetrisGame := range game.Players {
+			switch score := tetrisGame.GetScore(); {
+			case score > best:
+				best = score
+				winners = []int{userID}
+			case score == best:
+				winners = append(winners, userID)
+			}
+		}
+	}
+	sort.Ints(winners)
+	return winners
+}
+
+// finishRound records a game that has just ended and, in a set, credits the
+// winners with a round. The next round starts after a countdown until one
+// player has won the set.
+func (h *Hub) finishRound(roomID string, game *MultiplayerGame, winners []int) {
+	h.saveGameRecord(game.record(winners))
+
+	set := game.Set
+	if set == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	for _, userID := range winners {
+		set.Wins[userID]++
+	}
+	winner, won, tiebreak := set.winner()
+	if won {
+		delete(h.sets, roomID)
+	}
+	data := set.data()
+	h.mutex.Unlock()
+
+	data["winners"] = winners
+	if won {
+		h.completeSet(roomID, set, &winner)
+		data["set_winner"] = winner
+		h.broadcastToRoom(roomID, WebSocketMessage{
+			Type:   "set_complete",
+			RoomID: roomID,
+			Data:   data,
+		})
+		return
+	}
+
+	data["countdown"] = int(roundCountdown.Seconds())
+	data["tiebreak"] = tiebreak
+	h.broadcastToRoom(roomID, WebSocketMessage{
+		Type:   "set_update",
+		RoomID: roomID,
+		Data:   data,
+	})
+
+	time.AfterFunc(roundCountdown, func() {
+		h.startNextRound(roomID, set)
+	})
+}
+
+// startNextRound starts the set's next game, unless the set was abandoned
+// or a game is already running.
+func (h *Hub) startNextRound(roomID string, set *matchSet) {
+	h.mutex.RLock()
+	current := h.sets[roomID]
+	_, playing := h.multiplayerGames[roomID]
+	h.mutex.RUnlock()
+
+	if current != set || playing {
+		return
+	}
+
+	room, err := h.db.GetMultiplayerRoom(roomID)
+	if err != nil {
+		log.Printf("Failed to get room for next round: %v", err)
+		h.abandonSet(roomID)
+		return
+	}
+	mode := RoomMode(room.Settings)
+	if minPlayers, _ := PlayerLimits(mode); len(room.Players) < minPlayers {
+		log.Printf("Abandoning set in room %s: only %d players left", roomID, len(room.Players))
+		h.abandonSet(roomID)
+		return
+	}
+
+	h.broadcast <- WebSocketMessage{Type: "start_multiplayer_game", RoomID: roomID}
+}
+
+func (h *Hub) completeSet(roomID string, set *matchSet, winner *int) {
+	finishedAt := time.Now()
+	err := h.db.FinishMatchSet(&database.MatchSet{
+		ID:         set.ID,
+		RoomID:     roomID,
+		FirstTo:    set.FirstTo,
+		Wins:       set.Wins,
+		Winner:     winner,
+		StartedAt:  set.StartedAt,
+		FinishedAt: &finishedAt,
+	})
+	if err != nil {
+		log.Printf("Failed to record set result for room %s: %v", roomID, err)
+	}
+}
+
+// abandonSet ends the room's set without a winner, e.g. when a player leaves
+// mid-set.
+func (h *Hub) abandonSet(roomID string) {
+	h.mutex.Lock()
+	set, ok := h.sets[roomID]
+	delete(h.sets, roomID)
+	h.mutex.Unlock()
+
+	if ok {
+		h.completeSet(roomID, set, nil)
+	}
+}
@@ -0,0 +1,31 @@
+package multiplayer
+
+import "testing"
+
+func TestMatchSetWinner(t *testing.T) {
+	tests := []struct {
+		name     string
+		wins     map[int]int
+		winner   int
+		won      bool
+		tiebreak bool
+	}{
+		{name: "no rounds played", wins: map[int]int{}},
+		{name: "short of the target", wins: map[int]int{1: 2, 2: 1}},
+		{name: "one player reaches the target", wins: map[int]int{1: 3, 2: 1}, winner: 1, won: true},
+		{name: "two reach the target together", wins: map[int]int{1: 3, 2: 3, 3: 1}, tiebreak: true},
+		{name: "tiebreak won", wins: map[int]int{1: 4, 2: 3, 3: 1}, winner: 1, won: true},
+		{name: "tied below the target", wins: map[int]int{1: 2, 2: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &matchSet{FirstTo: 3, Wins: tt.wins}
+			winner, won, tiebreak := set.winner()
+			if winner != tt.winner || won != tt.won || tiebreak != tt.tiebreak {
+				t.Errorf("winner() = %d, %v, %v; want %d, %v, %v",
+					winner, won, tiebreak, tt.winner, tt.won, tt.tiebreak)
+			}
+		})
+	}
+}
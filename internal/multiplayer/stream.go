@@ -0,0 +1,541 @@
+package multiplayer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+)
+
+const (
+	tickInterval = 50 * time.Millisecond
+
+	// keyframeInterval is how many frames may pass before a client is sent
+	// full boards again even if it has been acknowledging deltas.
+	keyframeInterval = 40
+
+	// historyLength is how many past frames are kept per player to diff
+	// against. An ack older than this gets a full board instead.
+	historyLength = keyframeInterval
+
+	// royaleSummaryInterval is how many frames pass between the opponent
+	// summaries sent to full-state clients in a battle royale.
+	royaleSummaryInterval = 5
+)
+
+// streamMode is how a client wants multiplayer game state delivered,
+// negotiated with the "stream" and "format" query parameters in ServeWS.
+type streamMode int
+
+const (
+	// streamFull sends a complete player_game_state JSON message per
+	// player per tick. It is the default so existing clients keep working.
+	streamFull streamMode = iota
+	// streamDeltaJSON sends one state_frame per tick holding only what
+	// changed since the client's last acknowledged frame.
+	streamDeltaJSON
+	// streamDeltaBinary is streamDeltaJSON encoded with encodeFrameBinary.
+	streamDeltaBinary
+)
+
+func negotiateStream(r *http.Request) streamMode {
+	if r.URL.Query().Get("stream") != "delta" {
+		return streamFull
+	}
+	if r.URL.Query().Get("format") == "binary" {
+		return streamDeltaBinary
+	}
+	return streamDeltaJSON
+}
+
+func (m streamMode) String() string {
+	switch m {
+	case streamDeltaJSON:
+		return "delta/json"
+	case streamDeltaBinary:
+		return "delta/binary"
+	default:
+		return "full/json"
+	}
+}
+
+type StateAckPayload struct {
+	Frame uint32 `json:"frame" schema:"required"`
+}
+
+func (p *StateAckPayload) Validate() error { return nil }
+
+// acknowledge records the newest frame the client has applied. Acks can
+// arrive out of order, so older ones are ignored.
+func (c *Client) acknowledge(frame uint32) {
+	for {
+		current := c.ackFrame.Load()
+		if frame <= current || c.ackFrame.CompareAndSwap(current, frame) {
+			return
+		}
+	}
+}
+
+type frameSnapshot struct {
+	frame uint32
+	state tetris.Snapshot
+}
+
+// playerHistory is a ring buffer of a player's recent snapshots.
+type playerHistory struct {
+	frames [historyLength]frameSnapshot
+	count  int
+	next   int
+}
+
+func (ph *playerHistory) add(frame uint32, state tetris.Snapshot) {
+	ph.frames[ph.next] = frameSnapshot{frame: frame, state: state}
+	ph.next = (ph.next + 1) % historyLength
+	if ph.count < historyLength {
+		ph.count++
+	}
+}
+
+func (ph *playerHistory) latest() *tetris.Snapshot {
+	if ph.count == 0 {
+		return nil
+	}
+	return &ph.frames[(ph.next+historyLength-1)%historyLength].state
+}
+
+func (ph *playerHistory) at(frame uint32) (*tetris.Snapshot, bool) {
+	for i := 0; i < ph.count; i++ {
+		candidate := &ph.frames[(ph.next+historyLength-1-i)%historyLength]
+		if candidate.frame == frame {
+			return &candidate.state, true
+		}
+		if candidate.frame < frame {
+			break
+		}
+	}
+	return nil, false
+}
+
+// currentFrame numbers frames by ticks since the hub started, so a new game
+// in a room always starts past any frame a client may still be acking from
+// the previous one.
+func (h *Hub) currentFrame() uint32 {
+	return uint32(time.Since(h.startedAt) / tickInterval)
+}
+
+// recordFrame advances the game's frame counter and stores every player's
+// snapshot for it. Callers must hold game.mutex.
+func (game *MultiplayerGame) recordFrame() {
+	game.Frame++
+	if game.history == nil {
+		game.history = make(map[int]*playerHistory)
+	}
+	for userID, tetrisGame := range game.Players {
+		history, ok := game.history[userID]
+		if !ok {
+			history = &playerHistory{}
+			game.history[userID] = history
+		}
+		history.add(game.Frame, tetrisGame.Snapshot())
+	}
+}
+
+type stateFrame struct {
+	Frame    uint32        `json:"frame"`
+	Base     uint32        `json:"base,omitempty"`
+	Keyframe bool          `json:"keyframe"`
+	Players  []playerDelta `json:"players"`
+}
+
+// playerDelta describes one player's state relative to the frame's base.
+// When Full is set Board holds every locked cell; otherwise Cells lists the
+// [x, y, value] of each cell that changed and Piece is omitted if the active
+// piece didn't move.
+type playerDelta struct {
+	UserID   int                `json:"user_id"`
+	Full     bool               `json:"full,omitempty"`
+	Board    [][]int            `json:"board,omitempty"`
+	Cells    [][3]int           `json:"cells,omitempty"`
+	Piece    *tetris.PieceState `json:"piece,omitempty"`
+	GhostY   int                `json:"ghost_y"`
+	Hold     int                `json:"hold"`
+	Next     []int              `json:"next"`
+	Score    int                `json:"score"`
+	Lines    int                `json:"lines"`
+	Level    int                `json:"level"`
+	GameOver bool               `json:"game_over,omitempty"`
+	TopOut   string             `json:"top_out,omitempty"`
+	Paused   bool               `json:"paused,omitempty"`
+	// GameFrame and LastSeq echo the player's engine frame and last applied
+	// input so the owning client can reconcile its predictions.
+	GameFrame uint64 `json:"game_frame"`
+	LastSeq   uint32 `json:"last_seq"`
+}
+
+// buildFrame works out what client needs to catch up to the current frame,
+// or nil if it is already up to date. Callers must hold game.mutex.
+func (game *MultiplayerGame) buildFrame(client *Client) *stateFrame {
+	ack := client.ackFrame.Load()
+	keyframe := ack == 0 || game.Frame-client.lastKeyframe >= keyframeInterval
+
+	frame := &stateFrame{Frame: game.Frame, Keyframe: keyframe}
+	if !keyframe {
+		frame.Base = ack
+	}
+
+	userIDs := make([]int, 0, len(game.history))
+	for userID := range game.history {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+
+	for _, userID := range userIDs {
+		history := game.history[userID]
+		current := history.latest()
+		if current == nil {
+			continue
+		}
+
+		var base *tetris.Snapshot
+		if !keyframe {
+			base, _ = history.at(ack)
+		}
+
+		if delta, changed := diffSnapshot(userID, base, current); changed {
+			frame.Players = append(frame.Players, delta)
+		}
+	}
+
+	if keyframe {
+		client.lastKeyframe = game.Frame
+	} else if len(frame.Players) == 0 {
+		return nil
+	}
+
+	return frame
+}
+
+// diffSnapshot builds the delta from base to current. A nil base produces a
+// full description of the player.
+func diffSnapshot(userID int, base, current *tetris.Snapshot) (playerDelta, bool) {
+	delta := playerDelta{
+		UserID:   userID,
+		GhostY:   current.GhostY,
+		Hold:     current.Hold,
+		Next:     current.Next,
+		Score:    current.Score,
+		Lines:    current.Lines,
+		Level:    current.Level,
+		GameOver: current.GameOver,
+		TopOut:   current.TopOut,
+		Paused:   current.Paused,
+
+		GameFrame: current.Frame,
+		LastSeq:   current.LastInputSeq,
+	}
+
+	// A delta can't say the piece has gone, since an omitted piece means it
+	// didn't move, so a player whose piece disappeared is sent in full.
+	pieceGone := base != nil && base.Piece != nil && current.Piece == nil
+	if base == nil || len(base.Board) != len(current.Board) || pieceGone {
+		delta.Full = true
+		delta.Board = current.Board
+		delta.Piece = current.Piece
+		return delta, true
+	}
+
+	for y := range current.Board {
+		for x := range current.Board[y] {
+			if x >= len(base.Board[y]) || base.Board[y][x] != current.Board[y][x] {
+				delta.Cells = append(delta.Cells, [3]int{x, y, current.Board[y][x]})
+			}
+		}
+	}
+
+	pieceChanged := !samePiece(base.Piece, current.Piece)
+	if pieceChanged {
+		delta.Piece = current.Piece
+	}
+
+	changed := len(delta.Cells) > 0 || pieceChanged ||
+		base.GhostY != current.GhostY || base.Hold != current.Hold ||
+		!sameQueue(base.Next, current.Next) || base.Score != current.Score ||
+		base.Lines != current.Lines || base.Level != current.Level ||
+		base.GameOver != current.GameOver || base.Paused != current.Paused ||
+		base.LastInputSeq != current.LastInputSeq
+
+	return delta, changed
+}
+
+func samePiece(a, b *tetris.PieceState) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameQueue(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *stateFrame) data() map[string]interface{} {
+	return map[string]interface{}{
+		"frame":    f.Frame,
+		"base":     f.Base,
+		"keyframe": f.Keyframe,
+		"players":  f.Players,
+	}
+}
+
+// Binary frame layout (all integers big-endian):
+//
+//	u8  kind (1 = state frame)
+//	u32 frame, u32 base, u8 flags (bit 0 keyframe), u8 player count
+//	per player:
+//	  u32 user id, u8 flags (bit 0 full, bit 1 piece, bit 2 game over, bit 3 paused)
+//	  u32 score, u16 lines, u8 level, i8 hold, i8 ghost y
+//	  u32 game frame (low 32 bits), u32 last input seq
+//	  u8 next count, next count * u8 piece type
+//	  if piece: u8 type, i8 x, i8 y, u8 rotation
+//	  if full:  u8 width, u8 height, width*height * u8 cell (row-major)
+//	  else:     u16 cell count, count * (u8 x, u8 y, u8 value)
+const binaryStateFrame = 1
+
+const (
+	binaryFlagFull = 1 << iota
+	binaryFlagPiece
+	binaryFlagGameOver
+	binaryFlagPaused
+)
+
+func encodeFrameBinary(frame *stateFrame) []byte {
+	var buf bytes.Buffer
+	write := func(v interface{}) {
+		_ = binary.Write(&buf, binary.BigEndian, v)
+	}
+
+	var frameFlags uint8
+	if frame.Keyframe {
+		frameFlags |= 1
+	}
+
+	write(uint8(binaryStateFrame))
+	write(frame.Frame)
+	write(frame.Base)
+	write(frameFlags)
+	write(uint8(len(frame.Players)))
+
+	for _, player := range frame.Players {
+		var flags uint8
+		if player.Full {
+			flags |= binaryFlagFull
+		}
+		if player.Piece != nil {
+			flags |= binaryFlagPiece
+		}
+		if player.GameOver {
+			flags |= binaryFlagGameOver
+		}
+		if player.Paused {
+			flags |= binaryFlagPaused
+		}
+
+		write(uint32(player.UserID))
+		write(flags)
+		write(uint32(player.Score))
+		write(uint16(player.Lines))
+		write(uint8(player.Level))
+		write(int8(player.Hold))
+		write(int8(player.GhostY))
+		write(uint32(player.GameFrame))
+		write(player.LastSeq)
+		write(uint8(len(player.Next)))
+		for _, pieceType := range player.Next {
+			write(uint8(pieceType))
+		}
+
+		if player.Piece != nil {
+			write(uint8(player.Piece.Type))
+			write(int8(player.Piece.X))
+			write(int8(player.Piece.Y))
+			write(uint8(player.Piece.Rotation))
+		}
+
+		if player.Full {
+			width := 0
+			if len(player.Board) > 0 {
+				width = len(player.Board[0])
+			}
+			write(uint8(width))
+			write(uint8(len(player.Board)))
+			for _, row := range player.Board {
+				for _, cell := range row {
+					write(uint8(cell))
+				}
+			}
+		} else {
+			write(uint16(len(player.Cells)))
+			for _, cell := range player.Cells {
+				write(uint8(cell[0]))
+				write(uint8(cell[1]))
+				write(uint8(cell[2]))
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// streamFrame sends the current frame to every client in the room that
+// negotiated delta streaming. Callers must hold game.mutex.
+func (h *Hub) streamFrame(roomID string, game *MultiplayerGame) {
+	for _, client := range h.roomClients(roomID) {
+		if client.stream == streamFull {
+			continue
+		}
+
+		frame := game.buildFrame(client)
+		if frame == nil {
+			continue
+		}
+
+		message := WebSocketMessage{Type: "state_frame", RoomID: roomID}
+		if client.stream == streamDeltaBinary {
+			message.binary = encodeFrameBinary(frame)
+		} else {
+			message.Data = frame.data()
+		}
+		h.sendToClient(client, message)
+	}
+}
+
+// broadcastFullState sends a legacy player_game_state message to the room's
+// clients that didn't negotiate delta streaming.
+func (h *Hub) broadcastFullState(roomID string, message WebSocketMessage) {
+	for _, client := range h.roomClients(roomID) {
+		if client.stream == streamFull {
+			h.sendToClient(client, message)
+		}
+	}
+}
+
+// sendFullStateToUser sends a legacy player_game_state message to the
+// user's own full-state clients in the room.
+func (h *Hub) sendFullStateToUser(roomID string, userID int, message WebSocketMessage) {
+	for _, client := range h.userClients(userID) {
+		if client.RoomID == roomID && client.stream == streamFull {
+			h.sendToClient(client, message)
+		}
+	}
+}
+
+// royaleSummary is what a full-state client in a battle royale is told
+// about each player in place of their board.
+type royaleSummary struct {
+	UserID int `json:"user_id"`
+	Score  int `json:"score"`
+	Lines  int `json:"lines"`
+	Level  int `json:"level"`
+	// Height is how many rows the player's stack reaches up the board.
+	Height   int    `json:"height"`
+	Garbage  int    `json:"garbage"`
+	GameOver bool   `json:"game_over,omitempty"`
+	TopOut   string `json:"top_out,omitempty"`
+}
+
+// sendRoyaleSummaries sends the room's full-state clients a summary of
+// every player every royaleSummaryInterval frames, one message per client
+// instead of a board per player. Callers must hold game.mutex and have
+// recorded the frame.
+func (h *Hub) sendRoyaleSummaries(roomID string, game *MultiplayerGame) {
+	if game.Frame%royaleSummaryInterval != 0 {
+		return
+	}
+
+	userIDs := make([]int, 0, len(game.history))
+	for userID := range game.history {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+
+	summaries := make([]royaleSummary, 0, len(userIDs))
+	for _, userID := range userIDs {
+		state := game.history[userID].latest()
+		tetrisGame, ok := game.Players[userID]
+		if state == nil || !ok {
+			continue
+		}
+		summaries = append(summaries, royaleSummary{
+			UserID:   userID,
+			Score:    state.Score,
+			Lines:    state.Lines,
+			Level:    state.Level,
+			Height:   stackHeight(state.Board),
+			Garbage:  tetrisGame.PendingGarbage(),
+			GameOver: state.GameOver,
+			TopOut:   state.TopOut,
+		})
+	}
+
+	h.broadcastFullState(roomID, WebSocketMessage{
+		Type:   "royale_summary",
+		RoomID: roomID,
+		Data: map[string]interface{}{
+			"frame":   game.Frame,
+			"players": summaries,
+		},
+	})
+}
+
+// stackHeight counts the rows from the highest filled cell to the floor.
+func stackHeight(board [][]int) int {
+	for y, row := range board {
+		for _, cell := range row {
+			if cell != 0 {
+				return len(board) - y
+			}
+		}
+	}
+	return 0
+}
+
+func (h *Hub) roomClients(roomID string) []*Client {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	clients := make([]*Client, 0, len(h.rooms[roomID]))
+	for client := range h.rooms[roomID] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// sendToClient queues a message for a client, dropping the client if its
+// buffer is full. Clients are only closed under the write lock, so holding
+// the read lock while sending keeps this from racing with a disconnect.
+func (h *Hub) sendToClient(client *Client, message WebSocketMessage) {
+	h.mutex.RLock()
+	if !h.clients[client] {
+		h.mutex.RUnlock()
+		return
+	}
+	select {
+	case client.Send <- message:
+		h.mutex.RUnlock()
+		return
+	default:
+	}
+	h.mutex.RUnlock()
+	h.dropClient(client)
+}
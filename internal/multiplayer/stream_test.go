@@ -0,0 +1,350 @@
+package multiplayer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/isaacjstriker/devware/games/tetris"
+)
+
+func testBoard(width, height int, cells map[[2]int]int) [][]int {
+	board := make([][]int, height)
+	for y := range board {
+		board[y] = make([]int, width)
+	}
+	for pos, value := range cells {
+		board[pos[1]][pos[0]] = value
+	}
+	return board
+}
+
+func testSnapshot(cells map[[2]int]int, piece *tetris.PieceState) tetris.Snapshot {
+	return tetris.Snapshot{
+		Board:        testBoard(10, 20, cells),
+		Piece:        piece,
+		GhostY:       18,
+		Hold:         -1,
+		Next:         []int{0, 1, 2, 3, 4},
+		Score:        1200,
+		Lines:        8,
+		Level:        1,
+		Frame:        340,
+		LastInputSeq: 27,
+	}
+}
+
+// applyDelta rebuilds a player's state from a base and a delta, as a client
+// does.
+func applyDelta(base tetris.Snapshot, delta playerDelta) tetris.Snapshot {
+	state := base
+	if delta.Full {
+		state.Board = delta.Board
+		state.Piece = delta.Piece
+	} else {
+		state.Board = make([][]int, len(base.Board))
+		for y := range base.Board {
+			state.Board[y] = append([]int(nil), base.Board[y]...)
+		}
+		for _, cell := range delta.Cells {
+			state.Board[cell[1]][cell[0]] = cell[2]
+		}
+		if delta.Piece != nil {
+			state.Piece = delta.Piece
+		}
+	}
+
+	state.GhostY = delta.GhostY
+	state.Hold = delta.Hold
+	state.Next = delta.Next
+	state.Score = delta.Score
+	state.Lines = delta.Lines
+	state.Level = delta.Level
+	state.GameOver = delta.GameOver
+	state.TopOut = delta.TopOut
+	state.Paused = delta.Paused
+	state.Frame = delta.GameFrame
+	state.LastInputSeq = delta.LastSeq
+	return state
+}
+
+func TestDiffSnapshotRoundTrip(t *testing.T) {
+	piece := &tetris.PieceState{Type: 2, X: 4, Y: 0, Rotation: 0}
+	moved := &tetris.PieceState{Type: 2, X: 3, Y: 1, Rotation: 1}
+	base := testSnapshot(map[[2]int]int{{0, 19}: 1, {1, 19}: 1}, piece)
+
+	tests := []struct {
+		name    string
+		base    *tetris.Snapshot
+		current tetris.Snapshot
+		full    bool
+		changed bool
+		cells   int
+	}{
+		{
+			name:    "no base",
+			current: base,
+			full:    true,
+			changed: true,
+		},
+		{
+			name:    "unchanged",
+			base:    &base,
+			current: base,
+		},
+		{
+			name:    "piece moved",
+			base:    &base,
+			current: testSnapshot(map[[2]int]int{{0, 19}: 1, {1, 19}: 1}, moved),
+			changed: true,
+		},
+		{
+			name:    "cells changed",
+			base:    &base,
+			current: testSnapshot(map[[2]int]int{{0, 19}: 1, {5, 19}: 3, {6, 19}: 3}, piece),
+			changed: true,
+			cells:   3,
+		},
+		{
+			name: "score and queue changed",
+			base: &base,
+			current: func() tetris.Snapshot {
+				s := base
+				s.Score = 1500
+				s.Next = []int{1, 2, 3, 4, 5}
+				s.LastInputSeq = 30
+				return s
+			}(),
+			changed: true,
+		},
+		{
+			name: "piece gone",
+			base: &base,
+			current: func() tetris.Snapshot {
+				s := testSnapshot(map[[2]int]int{{0, 19}: 1, {1, 19}: 1}, nil)
+				s.Score = 1500
+				s.Next = []int{1, 2, 3, 4, 5}
+				s.LastInputSeq = 30
+				return s
+			}(),
+			full:    true,
+			changed: true,
+		},
+		{
+			name: "board resized",
+			base: &base,
+			current: func() tetris.Snapshot {
+				s := base
+				s.Board = testBoard(10, 22, nil)
+				return s
+			}(),
+			full:    true,
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, changed := diffSnapshot(7, tt.base, &tt.current)
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if delta.Full != tt.full {
+				t.Errorf("full = %v, want %v", delta.Full, tt.full)
+			}
+			if len(delta.Cells) != tt.cells {
+				t.Errorf("%d cells changed, want %d", len(delta.Cells), tt.cells)
+			}
+
+			var base tetris.Snapshot
+			if tt.base != nil {
+				base = *tt.base
+			}
+			if got := applyDelta(base, delta); !reflect.DeepEqual(got, tt.current) {
+				t.Errorf("applying the delta gave %+v, want %+v", got, tt.current)
+			}
+		})
+	}
+}
+
+func TestStateFrameJSONRoundTrip(t *testing.T) {
+	base := testSnapshot(map[[2]int]int{{0, 19}: 1}, &tetris.PieceState{Type: 1, X: 4})
+	current := testSnapshot(map[[2]int]int{{0, 19}: 1, {9, 19}: 4}, &tetris.PieceState{Type: 1, X: 5, Y: 2})
+
+	delta, _ := diffSnapshot(3, &base, &current)
+	frame := &stateFrame{Frame: 100, Base: 98, Players: []playerDelta{delta}}
+
+	encoded, err := json.Marshal(frame.data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded stateFrame
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&decoded, frame) {
+		t.Fatalf("decoded %+v, want %+v", decoded, *frame)
+	}
+	if got := applyDelta(base, decoded.Players[0]); !reflect.DeepEqual(got, current) {
+		t.Errorf("applying the decoded delta gave %+v, want %+v", got, current)
+	}
+}
+
+// decodeFrameBinary reads a frame written by encodeFrameBinary, following
+// the layout documented next to it.
+func decodeFrameBinary(t *testing.T, data []byte) *stateFrame {
+	t.Helper()
+	r := bytes.NewReader(data)
+	read := func(v interface{}) {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			t.Fatalf("frame ended early: %v", err)
+		}
+	}
+	var (
+		u8  uint8
+		i8  int8
+		u16 uint16
+		u32 uint32
+	)
+
+	read(&u8)
+	if u8 != binaryStateFrame {
+		t.Fatalf("kind = %d, want %d", u8, binaryStateFrame)
+	}
+	frame := &stateFrame{}
+	read(&frame.Frame)
+	read(&frame.Base)
+	read(&u8)
+	frame.Keyframe = u8&1 != 0
+	var count uint8
+	read(&count)
+
+	for i := 0; i < int(count); i++ {
+		var player playerDelta
+		var flags uint8
+		read(&u32)
+		player.UserID = int(u32)
+		read(&flags)
+		player.Full = flags&binaryFlagFull != 0
+		player.GameOver = flags&binaryFlagGameOver != 0
+		player.Paused = flags&binaryFlagPaused != 0
+		read(&u32)
+		player.Score = int(u32)
+		read(&u16)
+		player.Lines = int(u16)
+		read(&u8)
+		player.Level = int(u8)
+		read(&i8)
+		player.Hold = int(i8)
+		read(&i8)
+		player.GhostY = int(i8)
+		read(&u32)
+		player.GameFrame = uint64(u32)
+		read(&player.LastSeq)
+		read(&u8)
+		player.Next = make([]int, u8)
+		for j := range player.Next {
+			read(&u8)
+			player.Next[j] = int(u8)
+		}
+
+		if flags&binaryFlagPiece != 0 {
+			piece := &tetris.PieceState{}
+			read(&u8)
+			piece.Type = int(u8)
+			read(&i8)
+			piece.X = int(i8)
+			read(&i8)
+			piece.Y = int(i8)
+			read(&u8)
+			piece.Rotation = int(u8)
+			player.Piece = piece
+		}
+
+		if player.Full {
+			var width, height uint8
+			read(&width)
+			read(&height)
+			player.Board = testBoard(int(width), int(height), nil)
+			for y := range player.Board {
+				for x := range player.Board[y] {
+					read(&u8)
+					player.Board[y][x] = int(u8)
+				}
+			}
+		} else {
+			read(&u16)
+			for j := 0; j < int(u16); j++ {
+				var cell [3]uint8
+				read(&cell)
+				player.Cells = append(player.Cells, [3]int{int(cell[0]), int(cell[1]), int(cell[2])})
+			}
+		}
+
+		frame.Players = append(frame.Players, player)
+	}
+
+	if r.Len() != 0 {
+		t.Fatalf("%d bytes left over", r.Len())
+	}
+	return frame
+}
+
+func TestStateFrameBinaryRoundTrip(t *testing.T) {
+	base := testSnapshot(map[[2]int]int{{0, 19}: 1}, &tetris.PieceState{Type: 6, X: 3, Y: -1, Rotation: 2})
+	moved := testSnapshot(map[[2]int]int{{0, 19}: 1, {2, 18}: 5}, &tetris.PieceState{Type: 6, X: 4, Y: 3, Rotation: 3})
+	toppedOut := testSnapshot(map[[2]int]int{{0, 19}: 1}, nil)
+	toppedOut.GameOver = true
+	toppedOut.Paused = true
+	toppedOut.Hold = 4
+
+	full, _ := diffSnapshot(1, nil, &base)
+	delta, _ := diffSnapshot(2, &base, &moved)
+	over, _ := diffSnapshot(3, &base, &toppedOut)
+
+	tests := []struct {
+		name  string
+		frame *stateFrame
+	}{
+		{name: "empty", frame: &stateFrame{Frame: 5}},
+		{name: "keyframe", frame: &stateFrame{Frame: 41, Keyframe: true, Players: []playerDelta{full}}},
+		{name: "deltas", frame: &stateFrame{Frame: 42, Base: 40, Players: []playerDelta{delta, over}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded := decodeFrameBinary(t, encodeFrameBinary(tt.frame))
+			// The binary format has no room for top-out reasons.
+			for i := range tt.frame.Players {
+				decoded.Players[i].TopOut = tt.frame.Players[i].TopOut
+			}
+			if !reflect.DeepEqual(decoded, tt.frame) {
+				t.Errorf("decoded %+v, want %+v", decoded, tt.frame)
+			}
+		})
+	}
+}
+
+func TestStackHeight(t *testing.T) {
+	tests := []struct {
+		name   string
+		cells  map[[2]int]int
+		height int
+	}{
+		{name: "empty", height: 0},
+		{name: "floor", cells: map[[2]int]int{{3, 19}: 1}, height: 1},
+		{name: "tallest column counts", cells: map[[2]int]int{{0, 19}: 1, {9, 12}: 8}, height: 8},
+		{name: "full", cells: map[[2]int]int{{5, 0}: 2}, height: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if height := stackHeight(testBoard(10, 20, tt.cells)); height != tt.height {
+				t.Errorf("stackHeight = %d, want %d", height, tt.height)
+			}
+		})
+	}
+}
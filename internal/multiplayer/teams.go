@@ -0,0 +1,124 @@
+package multiplayer
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+const (
+	maxTeams    = 4
+	maxTeamSize = 3
+)
+
+// RoomTeams returns the number of teams in a team room, 2 unless the room
+// chose more.
+func RoomTeams(settings database.RoomSettings) int {
+	if settings.Teams == 0 {
+		return 2
+	}
+	return settings.Teams
+}
+
+// teamSizes counts the players on each team, indexed by team number.
+func teamSizes(players []database.MultiplayerPlayer, teams int) []int {
+	sizes := make([]int, teams+1)
+	for _, player := range players {
+		if player.Team >= 1 && player.Team <= teams {
+			sizes[player.Team]++
+		}
+	}
+	return sizes
+}
+
+// AssignTeam picks the team with the fewest players for someone joining a
+// team room, preferring the lowest team number.
+func AssignTeam(room *database.MultiplayerRoom) int {
+	teams := RoomTeams(room.Settings)
+	sizes := teamSizes(room.Players, teams)
+	best := 1
+	for team := 2; team <= teams; team++ {
+		if sizes[team] < sizes[best] {
+			best = team
+		}
+	}
+	return best
+}
+
+// teamBalance reports why a team room can't start yet: someone without a
+// team, an empty team or teams of different sizes.
+func teamBalance(room *database.MultiplayerRoom) error {
+	teams := RoomTeams(room.Settings)
+	for _, player := range room.Players {
+		if player.Team < 1 || player.Team > teams {
+			return fmt.Errorf("%s has not picked a team", player.Username)
+		}
+	}
+	sizes := teamSizes(room.Players, teams)
+	for team := 1; team <= teams; team++ {
+		if sizes[team] == 0 {
+			return fmt.Errorf("team %d has no players", team)
+		}
+		if sizes[team] != sizes[1] {
+			return fmt.Errorf("teams are unbalanced")
+		}
+	}
+	return nil
+}
+
+func (h *Hub) handleChooseTeam(message WebSocketMessage, payload *ChooseTeamPayload) {
+	if message.RoomID == "" || message.UserID == 0 {
+		return
+	}
+
+	room, err := h.db.GetMultiplayerRoom(message.RoomID)
+	if err != nil {
+		log.Printf("Failed to get room for team choice: %v", err)
+		return
+	}
+
+	if RoomMode(room.Settings) != ModeTeams {
+		h.rejectMessage(message, "this room does not have teams")
+		return
+	}
+	if room.Status != "waiting" {
+		h.rejectMessage(message, "teams can only be changed before the game starts")
+		return
+	}
+
+	for _, player := range room.Players {
+		if player.UserID == message.UserID && player.Team == payload.Team {
+			return
+		}
+	}
+
+	teams := RoomTeams(room.Settings)
+	if payload.Team > teams {
+		h.rejectMessage(message, fmt.Sprintf("team must be between 1 and %d", teams))
+		return
+	}
+	if teamSizes(room.Players, teams)[payload.Team] >= room.MaxPlayers/teams {
+		h.rejectMessage(message, fmt.Sprintf("team %d is full", payload.Team))
+		return
+	}
+
+	if err := h.db.SetPlayerTeam(message.RoomID, message.UserID, payload.Team); err != nil {
+		log.Printf("Failed to set team: %v", err)
+		return
+	}
+
+	room, err = h.db.GetMultiplayerRoom(message.RoomID)
+	if err != nil {
+		log.Printf("Failed to get room: %v", err)
+		return
+	}
+
+	h.broadcastToRoom(message.RoomID, WebSocketMessage{
+		Type:   "room_update",
+		RoomID: message.RoomID,
+		Data: map[string]interface{}{
+			"room": room,
+		},
+	})
+}
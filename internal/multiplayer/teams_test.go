@@ -0,0 +1,74 @@
+package multiplayer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/isaacjstriker/devware/internal/database"
+)
+
+// teamRoom builds a team room whose players are on the given teams, in
+// order.
+func teamRoom(teams int, playerTeams ...int) *database.MultiplayerRoom {
+	room := &database.MultiplayerRoom{
+		MaxPlayers: 12,
+		Settings:   database.RoomSettings{Mode: ModeTeams, Teams: teams},
+	}
+	for i, team := range playerTeams {
+		room.Players = append(room.Players, database.MultiplayerPlayer{
+			UserID:   i + 1,
+			Username: fmt.Sprintf("player%d", i+1),
+			Team:     team,
+		})
+	}
+	return room
+}
+
+func TestTeamBalance(t *testing.T) {
+	tests := []struct {
+		name string
+		room *database.MultiplayerRoom
+		err  string
+	}{
+		{name: "two even teams", room: teamRoom(0, 1, 2, 1, 2)},
+		{name: "three even teams", room: teamRoom(3, 1, 2, 3, 3, 2, 1)},
+		{name: "no team picked", room: teamRoom(0, 1, 2, 0), err: "player3 has not picked a team"},
+		{name: "team out of range", room: teamRoom(2, 1, 2, 3), err: "player3 has not picked a team"},
+		{name: "empty team", room: teamRoom(3, 1, 2, 1, 2), err: "team 3 has no players"},
+		{name: "uneven teams", room: teamRoom(2, 1, 1, 2), err: "teams are unbalanced"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := teamBalance(tt.room)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("teamBalance returned %v", err)
+			case tt.err != "" && (err == nil || err.Error() != tt.err):
+				t.Errorf("teamBalance = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAssignTeam(t *testing.T) {
+	tests := []struct {
+		name string
+		room *database.MultiplayerRoom
+		team int
+	}{
+		{name: "empty room", room: teamRoom(0), team: 1},
+		{name: "second team smaller", room: teamRoom(0, 1), team: 2},
+		{name: "tie goes to the lowest team", room: teamRoom(3, 1, 2, 3), team: 1},
+		{name: "smallest of three", room: teamRoom(3, 1, 1, 2, 2, 3), team: 3},
+		{name: "players without a team ignored", room: teamRoom(0, 0, 0, 1), team: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if team := AssignTeam(tt.room); team != tt.team {
+				t.Errorf("AssignTeam = %d, want %d", team, tt.team)
+			}
+		})
+	}
+}
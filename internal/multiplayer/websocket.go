@@ -5,11 +5,13 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/isaacjstriker/devware/games/tetris"
 	"github.com/isaacjstriker/devware/internal/database"
+	"github.com/isaacjstriker/devware/internal/ratelimit"
 )
 
 var upgrader = websocket.Upgrader{
@@ -24,15 +26,31 @@ type WebSocketMessage struct {
 	UserID int                    `json:"user_id,omitempty"`
 	Data   map[string]interface{} `json:"data,omitempty"`
 	Error  string                 `json:"error,omitempty"`
+
+	// Payload is the decoded and validated data of an inbound message.
+	Payload Payload `json:"-"`
+
+	// binary, when set, is written as a binary frame instead of the JSON
+	// encoding of the message.
+	binary []byte
 }
 
 type Client struct {
-	ID     string
-	UserID int
-	RoomID string
-	Conn   *websocket.Conn
-	Send   chan WebSocketMessage
-	Hub    *Hub
+	ID       string
+	UserID   int
+	RoomID   string
+	Protocol int
+	Conn     *websocket.Conn
+	Send     chan WebSocketMessage
+	Hub      *Hub
+
+	limiter       *ratelimit.Bucket
+	violations    int
+	lastViolation time.Time
+
+	stream       streamMode
+	ackFrame     atomic.Uint32
+	lastKeyframe uint32
 }
 
 type UserInfo struct {
@@ -43,14 +61,34 @@ type UserInfo struct {
 type JWTValidator func(tokenString string) (*UserInfo, error)
 
 type MultiplayerGame struct {
-	RoomID     string
-	Players    map[int]*tetris.Tetris
+	RoomID  string
+	Players map[int]*tetris.Tetris
+	// Coop is set instead of Players for co-op rooms, with CoopPlayers
+	// holding the user ID of each of its players.
+	Coop        *tetris.Coop
+	CoopPlayers []int
+	// Elimination is set for battle royale and team rooms.
+	Elimination *eliminationState
+	// GameType is the room's game type and Set the first-to-N set the
+	// game is a round of, if any.
+	GameType string
+	Set      *matchSet
+	// Settings are the room's settings when the game started.
+	Settings   database.RoomSettings
 	StartTime  time.Time
 	IsActive   bool
 	GameTicker *time.Ticker
+	Frame      uint32
+	history    map[int]*playerHistory
 	mutex      sync.RWMutex
 }
 
+// isRoyale reports whether the game is a battle royale, where rooms are too
+// big to send every board to every client each tick.
+func (game *MultiplayerGame) isRoyale() bool {
+	return game.Elimination != nil && game.Elimination.mode == ModeRoyale
+}
+
 type Hub struct {
 	clients          map[*Client]bool
 	rooms            map[string]map[*Client]bool
@@ -62,20 +100,40 @@ type Hub struct {
 	mutex            sync.RWMutex
 	stopCleanup      chan bool
 	validateJWT      JWTValidator
+	messageLimits    MessageLimits
+	startedAt        time.Time
+	// handling holds each user's last set_handling, applied to the games
+	// they start.
+	handling map[int]tetris.Handling
+	// sets holds the first-to-N set in progress in each room.
+	sets map[string]*matchSet
+	// countdowns holds the pre-game countdown running in each room.
+	countdowns map[string]*countdown
+	chat       *chatState
+	// users holds every client of each user: their room sockets and their
+	// user-level sockets, see ServeUserWS.
+	users map[int]map[*Client]bool
 }
 
 // NewHub creates a new WebSocket hub
-func NewHub(db *database.DB, jwtValidator JWTValidator) *Hub {
+func NewHub(db *database.DB, jwtValidator JWTValidator, messageLimits MessageLimits, chatOptions ChatOptions) *Hub {
 	return &Hub{
 		clients:          make(map[*Client]bool),
 		rooms:            make(map[string]map[*Client]bool),
+		users:            make(map[int]map[*Client]bool),
 		multiplayerGames: make(map[string]*MultiplayerGame),
-		broadcast:        make(chan WebSocketMessage),
+		broadcast:        make(chan WebSocketMessage, 256),
 		register:         make(chan *Client),
 		unregister:       make(chan *Client),
 		db:               db,
 		stopCleanup:      make(chan bool),
 		validateJWT:      jwtValidator,
+		messageLimits:    messageLimits,
+		startedAt:        time.Now(),
+		handling:         make(map[int]tetris.Handling),
+		sets:             make(map[string]*matchSet),
+		countdowns:       make(map[string]*countdown),
+		chat:             newChatState(chatOptions),
 	}
 }
 
@@ -86,49 +144,38 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.mutex.Lock()
-			h.clients[client] = true
+			h.addClient(client)
 			if client.RoomID != "" {
-				if h.rooms[client.RoomID] == nil {
-					h.rooms[client.RoomID] = make(map[*Client]bool)
-				}
-				h.rooms[client.RoomID][client] = true
-
 				go h.checkReconnection(client.UserID, client.RoomID)
 			}
 			h.mutex.Unlock()
 
-			select {
-			case client.Send <- WebSocketMessage{
+			h.sendToClient(client, WebSocketMessage{
 				Type: "connected",
 				Data: map[string]interface{}{
-					"user_id": client.UserID,
-					"room_id": client.RoomID,
+					"user_id":          client.UserID,
+					"room_id":          client.RoomID,
+					"protocol_version": client.Protocol,
+					"stream":           client.stream.String(),
 				},
-			}:
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
+			})
 
-			log.Printf("Client %s connected to room %s", client.ID, client.RoomID)
+			if client.RoomID != "" {
+				log.Printf("Client %s connected to room %s", client.ID, client.RoomID)
+				go h.sendChatHistory(client)
+			} else {
+				log.Printf("Client %s connected for user %d", client.ID, client.UserID)
+			}
+			go h.notifyPresenceChanged(client.UserID)
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				roomID := client.RoomID
-				if roomID != "" && h.rooms[roomID] != nil {
-					delete(h.rooms[roomID], client)
-					if len(h.rooms[roomID]) == 0 {
-						delete(h.rooms, roomID)
-					}
-
-					go h.handlePlayerDisconnection(client.UserID, roomID)
-				}
-				close(client.Send)
+			if h.removeClient(client) && client.RoomID != "" {
+				go h.handlePlayerDisconnection(client.UserID, client.RoomID)
 			}
 			h.mutex.Unlock()
 			log.Printf("Client %s disconnected from room %s", client.ID, client.RoomID)
+			go h.notifyPresenceChanged(client.UserID)
 
 		case message := <-h.broadcast:
 			h.handleMessage(message)
@@ -136,6 +183,60 @@ func (h *Hub) Run() {
 	}
 }
 
+// addClient registers a client with the hub. Callers must hold h.mutex.
+func (h *Hub) addClient(client *Client) {
+	h.clients[client] = true
+	if client.RoomID != "" {
+		if h.rooms[client.RoomID] == nil {
+			h.rooms[client.RoomID] = make(map[*Client]bool)
+		}
+		h.rooms[client.RoomID][client] = true
+	}
+	if h.users[client.UserID] == nil {
+		h.users[client.UserID] = make(map[*Client]bool)
+	}
+	h.users[client.UserID][client] = true
+}
+
+// removeClient unregisters a client and closes its send channel, forgetting
+// what the hub kept for its room or user once they have no clients left. It
+// reports whether the client was still registered. Callers must hold
+// h.mutex.
+func (h *Hub) removeClient(client *Client) bool {
+	if !h.clients[client] {
+		return false
+	}
+	delete(h.clients, client)
+	close(client.Send)
+
+	if roomClients := h.rooms[client.RoomID]; roomClients != nil {
+		delete(roomClients, client)
+		if len(roomClients) == 0 {
+			delete(h.rooms, client.RoomID)
+			if client.RoomID != lobbyRoomID {
+				h.chat.dropHistory(client.RoomID)
+			}
+		}
+	}
+
+	if userClients := h.users[client.UserID]; userClients != nil {
+		delete(userClients, client)
+		if len(userClients) == 0 {
+			delete(h.users, client.UserID)
+			delete(h.handling, client.UserID)
+			h.chat.forget(client.UserID)
+		}
+	}
+	return true
+}
+
+// dropClient disconnects a client that isn't keeping up with its messages.
+func (h *Hub) dropClient(client *Client) {
+	h.mutex.Lock()
+	h.removeClient(client)
+	h.mutex.Unlock()
+}
+
 func (h *Hub) startRoomCleanup() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
@@ -166,31 +267,18 @@ func (h *Hub) cleanupInactiveRooms() {
 		log.Printf("Cleaned up %d inactive rooms", len(cleanedRoomIDs))
 
 		for _, roomID := range cleanedRoomIDs {
-			h.mutex.RLock()
-			roomClients := h.rooms[roomID]
-			h.mutex.RUnlock()
-
-			for client := range roomClients {
-				select {
-				case client.Send <- WebSocketMessage{
-					Type:   "room_closed",
-					RoomID: roomID,
-					Data: map[string]interface{}{
-						"reason": "Room closed due to inactivity",
-					},
-				}:
-				default:
-					close(client.Send)
-					h.mutex.Lock()
-					delete(h.clients, client)
-					delete(h.rooms[roomID], client)
-					h.mutex.Unlock()
-				}
-			}
+			h.broadcastToRoom(roomID, WebSocketMessage{
+				Type:   "room_closed",
+				RoomID: roomID,
+				Data: map[string]interface{}{
+					"reason": "Room closed due to inactivity",
+				},
+			})
 
 			h.mutex.Lock()
 			delete(h.rooms, roomID)
 			h.mutex.Unlock()
+			h.chat.dropHistory(roomID)
 		}
 
 		h.broadcastToAll(WebSocketMessage{
@@ -212,17 +300,7 @@ func (h *Hub) broadcastToAll(message WebSocketMessage) {
 	h.mutex.RUnlock()
 
 	for _, client := range clients {
-		select {
-		case client.Send <- message:
-		default:
-			close(client.Send)
-			h.mutex.Lock()
-			delete(h.clients, client)
-			if client.RoomID != "" && h.rooms[client.RoomID] != nil {
-				delete(h.rooms[client.RoomID], client)
-			}
-			h.mutex.Unlock()
-		}
+		h.sendToClient(client, message)
 	}
 }
 
@@ -231,29 +309,38 @@ func (h *Hub) Stop() {
 }
 
 func (h *Hub) handleMessage(message WebSocketMessage) {
+	// Payload types are guaranteed by decodeMessage, see inboundPayloads.
 	switch message.Type {
-	case "room_update":
-		h.broadcastToRoom(message.RoomID, message)
 	case "game_state":
-		h.handleGameState(message)
+		h.handleGameState(message, message.Payload.(*GameStatePayload))
 	case "player_ready":
-		h.handlePlayerReady(message)
+		h.handlePlayerReady(message, message.Payload.(*PlayerReadyPayload))
 	case "start_game":
 		h.handleStartGame(message)
 	case "start_multiplayer_game":
 		h.handleStartMultiplayerGame(message)
 	case "game_input":
-		h.handleGameInput(message)
+		h.handleGameInput(message, message.Payload.(*GameInputPayload))
 	case "player_finished":
-		h.handlePlayerFinished(message)
+		h.handlePlayerFinished(message, message.Payload.(*PlayerFinishedPayload))
 	case "spectate_request":
 		h.handleSpectateRequest(message)
 	case "multiplayerInit":
-		h.handleMultiplayerInit(message)
+		h.handleMultiplayerInit(message, message.Payload.(*MultiplayerInitPayload))
 	case "setLevel":
-		h.handleSetLevel(message)
+		h.handleSetLevel(message, message.Payload.(*SetLevelPayload))
+	case "set_handling":
+		h.handleSetHandling(message, message.Payload.(*SetHandlingPayload))
+	case "choose_team":
+		h.handleChooseTeam(message, message.Payload.(*ChooseTeamPayload))
 	case "player_disconnect":
-		h.handlePlayerDisconnectMessage(message)
+		h.handlePlayerDisconnectMessage(message, message.Payload.(*PlayerDisconnectPayload))
+	case "chat_message":
+		h.handleChatMessage(message, message.Payload.(*ChatMessagePayload))
+	case "chat_ignore":
+		h.handleChatIgnore(message, message.Payload.(*ChatIgnorePayload))
+	case "chat_delete":
+		h.handleChatDelete(message, message.Payload.(*ChatDeletePayload))
 	case "heartbeat":
 		// Handle heartbeat - no action needed, just confirms connection
 		log.Printf("Heartbeat received from user %d in room %s", message.UserID, message.RoomID)
@@ -263,41 +350,61 @@ func (h *Hub) handleMessage(message WebSocketMessage) {
 
 }
 
-func (h *Hub) handleSetLevel(message WebSocketMessage) {
+func (h *Hub) handleSetLevel(message WebSocketMessage, payload *SetLevelPayload) {
 	if message.RoomID == "" {
 		return
 	}
+	if _, ok := h.hostRoom(message, "change the level"); !ok {
+		return
+	}
 	h.broadcastToRoom(message.RoomID, WebSocketMessage{
 		Type:   "setLevel",
 		RoomID: message.RoomID,
-		Data:   message.Data,
+		Data: map[string]interface{}{
+			"level": payload.Level,
+		},
 	})
 }
 
-func (h *Hub) handleMultiplayerInit(message WebSocketMessage) {
-	if message.RoomID == "" {
+func (h *Hub) handleSetHandling(message WebSocketMessage, payload *SetHandlingPayload) {
+	if message.UserID == 0 {
 		return
 	}
-	startingLevel := 1
-	if message.Data != nil {
-		if lvl, ok := message.Data["startingLevel"]; ok {
-			switch v := lvl.(type) {
-			case float64:
-				startingLevel = int(v)
-			case int:
-				startingLevel = v
-			}
-		}
+	handling := payload.handling()
+
+	h.mutex.Lock()
+	h.handling[message.UserID] = handling
+	multiplayerGame, exists := h.multiplayerGames[message.RoomID]
+	h.mutex.Unlock()
+
+	if !exists {
+		return
 	}
-	room, err := h.db.GetMultiplayerRoom(message.RoomID)
-	if err != nil {
-		log.Printf("Failed to get room for multiplayerInit: %v", err)
+
+	multiplayerGame.mutex.Lock()
+	if tetrisGame, ok := multiplayerGame.Players[message.UserID]; ok {
+		tetrisGame.SetHandling(handling)
+	}
+	if multiplayerGame.Coop != nil {
+		multiplayerGame.Coop.SetHandling(multiplayerGame.coopPlayer(message.UserID), handling)
+	}
+	multiplayerGame.mutex.Unlock()
+}
+
+func (h *Hub) handleMultiplayerInit(message WebSocketMessage, payload *MultiplayerInitPayload) {
+	if message.RoomID == "" {
 		return
 	}
-	if room.Settings == nil {
-		room.Settings = make(map[string]interface{})
+	startingLevel := payload.StartingLevel
+	room, ok := h.hostRoom(message, "change the starting level")
+	if !ok {
+		return
 	}
-	room.Settings["starting_level"] = startingLevel
+	if room.Status != "waiting" {
+		h.rejectMessage(message, "the starting level can only be changed before the game starts")
+		return
+	}
+	room.Settings.StartingLevel = startingLevel
 	if err := h.db.UpdateRoomSettings(message.RoomID, room.Settings); err != nil {
 		log.Printf("Failed to update room settings for starting level: %v", err)
 	} else {
@@ -305,17 +412,13 @@ func (h *Hub) handleMultiplayerInit(message WebSocketMessage) {
 	}
 }
 
-func (h *Hub) handleGameState(message WebSocketMessage) {
+func (h *Hub) handleGameState(message WebSocketMessage, payload *GameStatePayload) {
 	if message.RoomID == "" || message.UserID == 0 {
 		return
 	}
 
-	score := 0
-	if s, ok := message.Data["score"].(float64); ok {
-		score = int(s)
-	}
-
-	err := h.db.UpdatePlayerGameState(message.RoomID, message.UserID, message.Data, score)
+	data := payload.data()
+	err := h.db.UpdatePlayerGameState(message.RoomID, message.UserID, data, payload.Score)
 	if err != nil {
 		log.Printf("Failed to update game state: %v", err)
 		return
@@ -325,7 +428,7 @@ func (h *Hub) handleGameState(message WebSocketMessage) {
 		Type:   "player_update",
 		RoomID: message.RoomID,
 		UserID: message.UserID,
-		Data:   message.Data,
+		Data:   data,
 	})
 }
 
@@ -343,34 +446,133 @@ func (h *Hub) handleStartMultiplayerGame(message WebSocketMessage) {
 		return
 	}
 
-	startingLevel := 1
-	if room.Settings != nil {
-		if level, ok := room.Settings["starting_level"]; ok {
-			if lvl, ok := level.(float64); ok {
-				startingLevel = int(lvl)
-			}
-		}
-	}
+	startingLevel := RoomStartingLevel(room.Settings)
+	rules := RoomRules(room.Settings)
+	mode := RoomMode(room.Settings)
 
-	h.mutex.Lock()
 	multiplayerGame := &MultiplayerGame{
 		RoomID:    message.RoomID,
 		Players:   make(map[int]*tetris.Tetris),
 		StartTime: time.Now(),
 		IsActive:  true,
+		GameType:  room.GameType,
+		Settings:  room.Settings,
+	}
+
+	if mode == ModeTeams {
+		if err := teamBalance(room); err != nil {
+			log.Printf("Can't start team game in room %s: %v", message.RoomID, err)
+			h.broadcastToRoom(message.RoomID, WebSocketMessage{
+				Type:   "error",
+				RoomID: message.RoomID,
+				Error:  err.Error(),
+			})
+			return
+		}
 	}
 
-	for _, player := range room.Players {
-		tetrisGame := tetris.NewTetris()
-		tetrisGame.SetLevel(startingLevel)
-		multiplayerGame.Players[player.UserID] = tetrisGame
+	if minPlayers, _ := PlayerLimits(mode); mode == ModeRoyale && len(room.Players) < minPlayers {
+		log.Printf("Not enough players to start battle royale in room %s: %d", message.RoomID, len(room.Players))
+		h.broadcastToRoom(message.RoomID, WebSocketMessage{
+			Type:   "error",
+			RoomID: message.RoomID,
+			Error:  fmt.Sprintf("battle royale needs at least %d players", minPlayers),
+		})
+		return
+	}
+
+	if mode == ModeCoop {
+		coop, err := tetris.NewCoop(rules, len(room.Players))
+		if err != nil {
+			log.Printf("Failed to start co-op game for room %s: %v", message.RoomID, err)
+			h.broadcastToRoom(message.RoomID, WebSocketMessage{
+				Type:   "error",
+				RoomID: message.RoomID,
+				Error:  err.Error(),
+			})
+			return
+		}
+		coop.SetLevel(startingLevel)
+		multiplayerGame.Coop = coop
+		rules = coop.Rules()
+	} else {
+		for _, player := range room.Players {
+			tetrisGame, err := tetris.New(rules)
+			if err != nil {
+				log.Printf("Failed to start game for room %s: %v", message.RoomID, err)
+				h.broadcastToRoom(message.RoomID, WebSocketMessage{
+					Type:   "error",
+					RoomID: message.RoomID,
+					Error:  err.Error(),
+				})
+				return
+			}
+			tetrisGame.SetLevel(startingLevel)
+			multiplayerGame.Players[player.UserID] = tetrisGame
+		}
+	}
+
+	var newSet *matchSet
+	if multiplayerGame.Coop == nil {
+		newSet = newMatchSet(room.Settings)
+	}
+
+	h.mutex.Lock()
+	if _, playing := h.multiplayerGames[message.RoomID]; playing {
+		h.mutex.Unlock()
+		log.Printf("Game already running in room %s", message.RoomID)
+		return
+	}
+	if newSet != nil {
+		var created bool
+		if multiplayerGame.Set, created = h.claimSet(message.RoomID, newSet); !created {
+			newSet = nil
+		}
+	}
+	// A game started by a countdown begins on the frame the countdown
+	// announced, so every client knows when its first tick lands.
+	multiplayerGame.Frame = h.currentFrame()
+	if startFrame, ok := message.Data["start_frame"].(uint32); ok {
+		multiplayerGame.Frame = startFrame
+	}
+	if multiplayerGame.Set != nil {
+		multiplayerGame.Set.Round++
+	}
+
+	for i, player := range room.Players {
+		if multiplayerGame.Coop != nil {
+			multiplayerGame.CoopPlayers = append(multiplayerGame.CoopPlayers, player.UserID)
+			if handling, ok := h.handling[player.UserID]; ok {
+				multiplayerGame.Coop.SetHandling(i, handling)
+			}
+			continue
+		}
+
+		if handling, ok := h.handling[player.UserID]; ok {
+			multiplayerGame.Players[player.UserID].SetHandling(handling)
+		}
 		log.Printf("Created Tetris instance for player %d (%s) with starting level %d",
 			player.UserID, player.Username, startingLevel)
 	}
 
+	if mode == ModeRoyale || mode == ModeTeams {
+		teams := make(map[int]int, len(room.Players))
+		for i, player := range room.Players {
+			teams[player.UserID] = i + 1
+			if mode == ModeTeams {
+				teams[player.UserID] = player.Team
+			}
+		}
+		multiplayerGame.Elimination = newEliminationState(mode, teams)
+	}
+
 	h.multiplayerGames[message.RoomID] = multiplayerGame
 	h.mutex.Unlock()
 
+	if newSet != nil {
+		h.recordSet(message.RoomID, newSet)
+	}
+
 	err = h.db.UpdateRoomStatus(message.RoomID, "active")
 	if err != nil {
 		log.Printf("Failed to update room status to active: %v", err)
@@ -385,16 +587,23 @@ func (h *Hub) handleStartMultiplayerGame(message WebSocketMessage) {
 		RoomID: message.RoomID,
 		Data: map[string]interface{}{
 			"starting_level": startingLevel,
+			"rules":          rules,
+			"mode":           mode,
+			"userIDs":        multiplayerGame.CoopPlayers,
+			"set":            h.setData(message.RoomID),
+			"frame":          multiplayerGame.Frame,
+			"start_time":     multiplayerGame.StartTime,
 			"message":        "Game starting! Use arrow keys to play.",
 		},
 	})
 
-	log.Printf("Multiplayer game started for room %s with %d players", message.RoomID, len(multiplayerGame.Players))
+	log.Printf("Multiplayer %s game started for room %s with %d players", mode, message.RoomID, len(room.Players))
+	go h.notifyRoomPresence(message.RoomID)
 }
 
 func (h *Hub) startMultiplayerGameTick(roomID string) {
 	go func() {
-		ticker := time.NewTicker(50 * time.Millisecond)
+		ticker := time.NewTicker(tickInterval)
 		defer ticker.Stop()
 
 		for range ticker.C {
@@ -408,28 +617,24 @@ func (h *Hub) startMultiplayerGameTick(roomID string) {
 			}
 
 			multiplayerGame.mutex.Lock()
-			for userID, tetrisGame := range multiplayerGame.Players {
-				if !tetrisGame.IsGameOver() {
-					tetrisGame.Update()
-
-					gameState := tetrisGame.GetState()
-					h.broadcastToRoom(roomID, WebSocketMessage{
-						Type:   "player_game_state",
-						RoomID: roomID,
-						UserID: userID,
-						Data: map[string]interface{}{
-							"board":      gameState.Board,
-							"score":      gameState.Score,
-							"level":      gameState.Level,
-							"lines":      gameState.Lines,
-							"gameOver":   gameState.GameOver,
-							"paused":     gameState.Paused,
-							"nextPiece":  gameState.NextPiece,
-							"holdPiece":  gameState.HoldPiece,
-							"ghostPiece": gameState.GhostPiece,
-							"userID":     userID,
-						},
-					})
+			if multiplayerGame.Coop != nil {
+				multiplayerGame.Coop.Update()
+				h.broadcastCoopState(roomID, multiplayerGame)
+			} else {
+				for userID, tetrisGame := range multiplayerGame.Players {
+					if !tetrisGame.IsGameOver() {
+						tetrisGame.Update()
+						h.broadcastPlayerState(roomID, multiplayerGame, userID, tetrisGame)
+					}
+				}
+				if multiplayerGame.Elimination != nil {
+					h.exchangeAttacks(multiplayerGame)
+					h.eliminatePlayers(roomID, multiplayerGame)
+				}
+				multiplayerGame.recordFrame()
+				h.streamFrame(roomID, multiplayerGame)
+				if multiplayerGame.isRoyale() {
+					h.sendRoyaleSummaries(roomID, multiplayerGame)
 				}
 			}
 			multiplayerGame.mutex.Unlock()
@@ -439,6 +644,55 @@ func (h *Hub) startMultiplayerGameTick(roomID string) {
 	}()
 }
 
+// broadcastPlayerState sends a player's full state to the room's
+// full-state clients, and tells the whole room when that player has just
+// topped out. In a battle royale only the player's own clients get their
+// board; everyone else gets sendRoyaleSummaries. Callers must hold the
+// game's mutex.
+func (h *Hub) broadcastPlayerState(roomID string, game *MultiplayerGame, userID int, tetrisGame *tetris.Tetris) {
+	gameState := tetrisGame.GetState()
+	message := WebSocketMessage{
+		Type:   "player_game_state",
+		RoomID: roomID,
+		UserID: userID,
+		Data: map[string]interface{}{
+			"board":      gameState.Board,
+			"score":      gameState.Score,
+			"level":      gameState.Level,
+			"lines":      gameState.Lines,
+			"gameOver":   gameState.GameOver,
+			"topOut":     gameState.TopOut,
+			"paused":     gameState.Paused,
+			"nextPiece":  gameState.NextPiece,
+			"holdPiece":  gameState.HoldPiece,
+			"ghostPiece": gameState.GhostPiece,
+			"frame":      gameState.Frame,
+			"lastSeq":    gameState.LastInputSeq,
+			"garbage":    tetrisGame.PendingGarbage(),
+			"set":        h.setData(roomID),
+			"userID":     userID,
+		},
+	}
+	if game.isRoyale() {
+		h.sendFullStateToUser(roomID, userID, message)
+	} else {
+		h.broadcastFullState(roomID, message)
+	}
+
+	if gameState.GameOver {
+		h.broadcastToRoom(roomID, WebSocketMessage{
+			Type:   "player_game_over",
+			RoomID: roomID,
+			UserID: userID,
+			Data: map[string]interface{}{
+				"userID": userID,
+				"reason": gameState.TopOut,
+				"score":  gameState.Score,
+			},
+		})
+	}
+}
+
 func (h *Hub) checkMultiplayerGameCompletion(roomID string) {
 	h.mutex.RLock()
 	multiplayerGame, exists := h.multiplayerGames[roomID]
@@ -448,6 +702,38 @@ func (h *Hub) checkMultiplayerGameCompletion(roomID string) {
 		return
 	}
 
+	if multiplayerGame.Coop != nil {
+		multiplayerGame.mutex.RLock()
+		gameOver := multiplayerGame.Coop.IsGameOver()
+		multiplayerGame.mutex.RUnlock()
+
+		if gameOver {
+			log.Printf("Ending co-op game in room %s", roomID)
+			h.finishCoopGame(roomID, multiplayerGame)
+			h.endMultiplayerGame(roomID)
+			h.finishRound(roomID, multiplayerGame, nil)
+		}
+		return
+	}
+
+	if multiplayerGame.Elimination != nil {
+		multiplayerGame.mutex.RLock()
+		over := multiplayerGame.eliminationOver()
+		multiplayerGame.mutex.RUnlock()
+
+		if over {
+			log.Printf("Ending %s game in room %s", multiplayerGame.Elimination.mode, roomID)
+			h.finishEliminationGame(roomID, multiplayerGame)
+			h.endMultiplayerGame(roomID)
+
+			multiplayerGame.mutex.RLock()
+			winners := multiplayerGame.eliminationWinners()
+			multiplayerGame.mutex.RUnlock()
+			h.finishRound(roomID, multiplayerGame, winners)
+		}
+		return
+	}
+
 	multiplayerGame.mutex.RLock()
 	finishedPlayers := 0
 	totalPlayers := len(multiplayerGame.Players)
@@ -457,12 +743,14 @@ func (h *Hub) checkMultiplayerGameCompletion(roomID string) {
 			finishedPlayers++
 		}
 	}
+	winners := multiplayerGame.survivors()
 	multiplayerGame.mutex.RUnlock()
 
 	if finishedPlayers > 0 {
 		log.Printf("Ending multiplayer game in room %s (%d/%d players finished)",
 			roomID, finishedPlayers, totalPlayers)
 		h.endMultiplayerGame(roomID)
+		h.finishRound(roomID, multiplayerGame, winners)
 	}
 }
 
@@ -495,19 +783,16 @@ func (h *Hub) endMultiplayerGame(roomID string) {
 	})
 
 	log.Printf("Multiplayer game ended for room %s", roomID)
+	go h.notifyRoomPresence(roomID)
 }
 
-func (h *Hub) handleGameInput(message WebSocketMessage) {
+func (h *Hub) handleGameInput(message WebSocketMessage, payload *GameInputPayload) {
 	if message.RoomID == "" || message.UserID == 0 {
 		log.Printf("Invalid game input: missing room ID or user ID")
 		return
 	}
 
-	action, ok := message.Data["action"].(string)
-	if !ok {
-		log.Printf("Invalid game input: no action specified")
-		return
-	}
+	action := payload.Action
 
 	log.Printf("Game input from user %d in room %s: %s", message.UserID, message.RoomID, action)
 
@@ -521,6 +806,12 @@ func (h *Hub) handleGameInput(message WebSocketMessage) {
 	}
 
 	multiplayerGame.mutex.Lock()
+	if multiplayerGame.Coop != nil {
+		h.handleCoopInput(message, payload, multiplayerGame)
+		multiplayerGame.mutex.Unlock()
+		return
+	}
+
 	tetrisGame, playerExists := multiplayerGame.Players[message.UserID]
 	if !playerExists {
 		multiplayerGame.mutex.Unlock()
@@ -529,42 +820,32 @@ func (h *Hub) handleGameInput(message WebSocketMessage) {
 	}
 
 	if !tetrisGame.IsGameOver() {
-		tetrisGame.HandleWebInput(action)
+		if payload.Seq > 0 {
+			if !tetrisGame.QueueInput(tetris.Input{Seq: payload.Seq, Frame: payload.Frame, Action: action}) {
+				multiplayerGame.mutex.Unlock()
+				log.Printf("Dropped stale input %d from player %d in room %s", payload.Seq, message.UserID, message.RoomID)
+				return
+			}
+		} else {
+			tetrisGame.HandleWebInput(action)
+		}
 
-		gameState := tetrisGame.GetState()
-
-		h.broadcastToRoom(message.RoomID, WebSocketMessage{
-			Type:   "player_game_state",
-			RoomID: message.RoomID,
-			UserID: message.UserID,
-			Data: map[string]interface{}{
-				"board":      gameState.Board,
-				"score":      gameState.Score,
-				"level":      gameState.Level,
-				"lines":      gameState.Lines,
-				"gameOver":   gameState.GameOver,
-				"paused":     gameState.Paused,
-				"nextPiece":  gameState.NextPiece,
-				"holdPiece":  gameState.HoldPiece,
-				"ghostPiece": gameState.GhostPiece,
-				"userID":     message.UserID,
-			},
-		})
+		h.broadcastPlayerState(message.RoomID, multiplayerGame, message.UserID, tetrisGame)
 
 		log.Printf("Processed input '%s' for player %d, new score: %d",
-			action, message.UserID, gameState.Score)
+			action, message.UserID, tetrisGame.GetScore())
 	}
 	multiplayerGame.mutex.Unlock()
 }
 
-func (h *Hub) handlePlayerReady(message WebSocketMessage) {
+func (h *Hub) handlePlayerReady(message WebSocketMessage, payload *PlayerReadyPayload) {
 	if message.RoomID == "" || message.UserID == 0 {
 		return
 	}
 
-	isReady := false
-	if r, ok := message.Data["ready"].(bool); ok {
-		isReady = r
+	isReady := payload.Ready
+	if !isReady {
+		h.cancelCountdown(message.RoomID, "a player is no longer ready")
 	}
 
 	err := h.db.UpdatePlayerReady(message.RoomID, message.UserID, isReady)
@@ -606,64 +887,50 @@ func (h *Hub) checkAndStartGame(room *database.MultiplayerRoom) {
 
 	log.Printf("Room %s ready check: %d/%d players ready", room.ID, readyCount, totalPlayers)
 
-	if totalPlayers >= 2 && readyCount == totalPlayers {
-		log.Printf("Auto-starting game in room %s: %d/%d players ready", room.ID, readyCount, totalPlayers)
+	mode := RoomMode(room.Settings)
+	minPlayers, _ := PlayerLimits(mode)
 
-		err := h.db.StartMultiplayerGame(room.ID)
-		if err != nil {
-			log.Printf("Failed to auto-start game: %v", err)
+	if mode == ModeTeams && totalPlayers >= minPlayers && readyCount == totalPlayers {
+		if err := teamBalance(room); err != nil {
+			log.Printf("Room %s can't start: %v", room.ID, err)
+			h.broadcastToRoom(room.ID, WebSocketMessage{
+				Type:   "teams_unbalanced",
+				RoomID: room.ID,
+				Data: map[string]interface{}{
+					"message": err.Error(),
+				},
+			})
 			return
 		}
+	}
 
-		h.broadcastToRoom(room.ID, WebSocketMessage{
-			Type:   "game_start",
-			RoomID: room.ID,
-			Data: map[string]interface{}{
-				"timestamp": time.Now(),
-				"message":   "All players ready! Game starting...",
-			},
-		})
+	if totalPlayers >= minPlayers && readyCount == totalPlayers {
+		log.Printf("Counting down to start in room %s: %d/%d players ready", room.ID, readyCount, totalPlayers)
+
+		h.startCountdown(room.ID, RoomCountdown(room.Settings))
 	}
 }
 
-func (h *Hub) handleStartGame(message WebSocketMessage) {
-	if message.RoomID == "" {
+func (h *Hub) handlePlayerFinished(message WebSocketMessage, payload *PlayerFinishedPayload) {
+	if message.RoomID == "" || message.UserID == 0 {
 		return
 	}
 
-	err := h.db.StartMultiplayerGame(message.RoomID)
+	room, err := h.db.GetMultiplayerRoom(message.RoomID)
 	if err != nil {
-		log.Printf("Failed to start game: %v", err)
-		h.broadcastToRoom(message.RoomID, WebSocketMessage{
-			Type:  "error",
-			Error: err.Error(),
-		})
+		log.Printf("Failed to get room %s: %v", message.RoomID, err)
 		return
 	}
-
-	h.broadcastToRoom(message.RoomID, WebSocketMessage{
-		Type:   "game_started",
-		RoomID: message.RoomID,
-		Data: map[string]interface{}{
-			"timestamp": time.Now(),
-		},
-	})
-}
-
-func (h *Hub) handlePlayerFinished(message WebSocketMessage) {
-	if message.RoomID == "" || message.UserID == 0 {
+	// In royale, teams and co-op the server decides when a player is out
+	// and when the match is over, so clients can't finish themselves.
+	switch RoomMode(room.Settings) {
+	case ModeRoyale, ModeTeams, ModeCoop:
+		h.rejectMessage(message, "players can't finish early in this mode")
 		return
 	}
 
-	score := 0
-	if s, ok := message.Data["score"].(float64); ok {
-		score = int(s)
-	}
-
-	lines := 0
-	if l, ok := message.Data["lines"].(float64); ok {
-		lines = int(l)
-	}
+	score := payload.Score
+	lines := payload.Lines
 
 	position, err := h.calculatePlayerPosition(message.RoomID, score)
 	if err != nil {
@@ -776,6 +1043,10 @@ func (h *Hub) handlePlayerDisconnection(userID int, roomID string) {
 		return
 	}
 
+	if room.Status == "waiting" && room.HostID == userID {
+		h.migrateHostLater(roomID, userID)
+	}
+
 	if room.Status != "active" {
 		return
 	}
@@ -805,6 +1076,11 @@ func (h *Hub) handlePlayerDisconnection(userID int, roomID string) {
 	activeClients := len(h.rooms[roomID])
 	h.mutex.RUnlock()
 
+	if h.forfeitPlayer(roomID, userID) {
+		log.Printf("Player %s forfeited in room %s", username, roomID)
+		return
+	}
+
 	h.mutex.RLock()
 	multiplayerGame, isMultiplayerGame := h.multiplayerGames[roomID]
 	h.mutex.RUnlock()
@@ -813,6 +1089,8 @@ func (h *Hub) handlePlayerDisconnection(userID int, roomID string) {
 		log.Printf("Player %s disconnected from active multiplayer game in room %s, ending game", username, roomID)
 
 		h.endMultiplayerGame(roomID)
+		h.recordAbandonedGame(multiplayerGame, userID)
+		h.abandonSet(roomID)
 
 		h.broadcastToRoom(roomID, WebSocketMessage{
 			Type:   "match_ended",
@@ -910,15 +1188,13 @@ func (h *Hub) checkReconnection(userID int, roomID string) {
 	}
 }
 
-func (h *Hub) handlePlayerDisconnectMessage(message WebSocketMessage) {
+func (h *Hub) handlePlayerDisconnectMessage(message WebSocketMessage, payload *PlayerDisconnectPayload) {
 	userID := message.UserID
 	roomID := message.RoomID
 
 	reason := "user_initiated"
-	if message.Data != nil {
-		if r, ok := message.Data["reason"].(string); ok {
-			reason = r
-		}
+	if payload.Reason != "" {
+		reason = payload.Reason
 	}
 
 	log.Printf("Received explicit disconnect message from user %d in room %s, reason: %s", userID, roomID, reason)
@@ -939,7 +1215,7 @@ func (h *Hub) handleSpectateRequest(message WebSocketMessage) {
 
 	if room.Status != "active" {
 		// Send error response
-		h.sendToUser(message.UserID, WebSocketMessage{
+		h.sendToUserInRoom(message.UserID, message.RoomID, WebSocketMessage{
 			Type:  "spectate_error",
 			Error: "Game is not currently active",
 		})
@@ -963,7 +1239,7 @@ func (h *Hub) handleSpectateRequest(message WebSocketMessage) {
 		}
 	}
 
-	h.sendToUser(message.UserID, WebSocketMessage{
+	h.sendToUserInRoom(message.UserID, message.RoomID, WebSocketMessage{
 		Type:   "spectate_data",
 		RoomID: message.RoomID,
 		Data: map[string]interface{}{
@@ -995,45 +1271,41 @@ func (h *Hub) getActiveGameStates(roomID string) (map[string]interface{}, error)
 	return gameStates, nil
 }
 
-func (h *Hub) sendToUser(userID int, message WebSocketMessage) {
+func (h *Hub) userClients(userID int) []*Client {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
-	for client := range h.clients {
-		if client.UserID == userID {
-			select {
-			case client.Send <- message:
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
-			break
-		}
+	clients := make([]*Client, 0, len(h.users[userID]))
+	for client := range h.users[userID] {
+		clients = append(clients, client)
 	}
+	return clients
 }
 
-func (h *Hub) broadcastToRoom(roomID string, message WebSocketMessage) {
-	h.mutex.RLock()
-	roomClients := h.rooms[roomID]
-	h.mutex.RUnlock()
-
-	if roomClients == nil {
-		return
+// sendToUser sends a message to every session the user has open, whichever
+// rooms they are in.
+func (h *Hub) sendToUser(userID int, message WebSocketMessage) {
+	for _, client := range h.userClients(userID) {
+		h.sendToClient(client, message)
 	}
+}
 
-	for client := range roomClients {
-		select {
-		case client.Send <- message:
-		default:
-			close(client.Send)
-			h.mutex.Lock()
-			delete(h.clients, client)
-			delete(h.rooms[roomID], client)
-			h.mutex.Unlock()
+// sendToUserInRoom sends a message only to the user's clients in one room,
+// e.g. in reply to something they sent there.
+func (h *Hub) sendToUserInRoom(userID int, roomID string, message WebSocketMessage) {
+	for _, client := range h.userClients(userID) {
+		if client.RoomID == roomID {
+			h.sendToClient(client, message)
 		}
 	}
 }
 
+func (h *Hub) broadcastToRoom(roomID string, message WebSocketMessage) {
+	for _, client := range h.roomClients(roomID) {
+		h.sendToClient(client, message)
+	}
+}
+
 func (h *Hub) NotifyPlayerLeft(roomID string, userID int, username string) {
 	log.Printf("Notifying room %s that player %s left during active game", roomID, username)
 
@@ -1051,6 +1323,8 @@ func (h *Hub) NotifyPlayerLeft(roomID string, userID int, username string) {
 func (h *Hub) NotifyPlayerLeftWaiting(roomID string, userID int, username string) {
 	log.Printf("Notifying room %s that player %s left waiting room", roomID, username)
 
+	h.cancelCountdown(roomID, fmt.Sprintf("%s left the room", username))
+
 	room, err := h.db.GetMultiplayerRoom(roomID)
 	if err != nil {
 		log.Printf("Failed to get room after player left: %v", err)
@@ -1070,19 +1344,85 @@ func (h *Hub) NotifyPlayerLeftWaiting(roomID string, userID int, username string
 	})
 }
 
-func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// NotifyRoomUpdated sends everyone in the room its current state, e.g.
+// after the host changes a setting.
+func (h *Hub) NotifyRoomUpdated(roomID string) {
+	room, err := h.db.GetMultiplayerRoom(roomID)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		log.Printf("Failed to get room %s for update: %v", roomID, err)
 		return
 	}
 
+	h.broadcastToRoom(roomID, WebSocketMessage{
+		Type:   "room_update",
+		RoomID: roomID,
+		Data: map[string]interface{}{
+			"room": room,
+		},
+	})
+}
+
+// NotifyPlayerKicked tells a player they were removed from a room and
+// closes their connections to it, then updates everyone left.
+func (h *Hub) NotifyPlayerKicked(roomID string, userID int, username string) {
+	log.Printf("Removing kicked player %s from room %s", username, roomID)
+
+	h.mutex.Lock()
+	for client := range h.rooms[roomID] {
+		if client.UserID != userID {
+			continue
+		}
+		select {
+		case client.Send <- WebSocketMessage{
+			Type:   "kicked",
+			RoomID: roomID,
+			Data: map[string]interface{}{
+				"message": "You were removed from the room",
+			},
+		}:
+		default:
+		}
+		h.removeClient(client)
+	}
+	h.mutex.Unlock()
+
+	h.cancelCountdown(roomID, fmt.Sprintf("%s was removed from the room", username))
+	h.NotifyRoomUpdated(roomID)
+}
+
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 	roomID := r.PathValue("roomId")
 	if roomID == "" {
 		log.Printf("No room ID provided in WebSocket connection")
-		if err := conn.Close(); err != nil {
-			log.Printf("Error closing connection: %v", err)
-		}
+		http.Error(w, "room ID is required", http.StatusBadRequest)
+		return
+	}
+	h.serveClient(w, r, roomID)
+}
+
+// ServeUserWS connects a client that isn't in any room. It stays open while
+// the user moves around the app and carries notifications meant for them,
+// such as friend requests and game invites.
+func (h *Hub) ServeUserWS(w http.ResponseWriter, r *http.Request) {
+	h.serveClient(w, r, "")
+}
+
+func (h *Hub) serveClient(w http.ResponseWriter, r *http.Request, roomID string) {
+	protocol, subprotocol, err := negotiateProtocol(r)
+	if err != nil {
+		log.Printf("WebSocket protocol negotiation failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var responseHeader http.Header
+	if subprotocol != "" {
+		responseHeader = http.Header{"Sec-WebSocket-Protocol": {subprotocol}}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
@@ -1104,13 +1444,29 @@ func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if roomID != "" && roomID != lobbyRoomID && !h.isRoomPlayer(roomID, userInfo.ID) {
+		log.Printf("User %d tried to connect to room %s without being in it", userInfo.ID, roomID)
+		closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "not a player in this room")
+		if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second)); err != nil {
+			log.Printf("Error writing close message: %v", err)
+		}
+		if err := conn.Close(); err != nil {
+			log.Printf("Error closing connection: %v", err)
+		}
+		return
+	}
+
 	client := &Client{
-		ID:     generateClientID(),
-		UserID: userInfo.ID,
-		RoomID: roomID,
-		Conn:   conn,
-		Send:   make(chan WebSocketMessage, 256),
-		Hub:    h,
+		ID:       generateClientID(),
+		UserID:   userInfo.ID,
+		RoomID:   roomID,
+		Protocol: protocol,
+		Conn:     conn,
+		Send:     make(chan WebSocketMessage, 256),
+		Hub:      h,
+
+		limiter: newMessageBucket(h.messageLimits),
+		stream:  negotiateStream(r),
 	}
 
 	client.Hub.register <- client
@@ -1119,6 +1475,22 @@ func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 	go client.readPump()
 }
 
+// isRoomPlayer reports whether the user has joined the room. Only players
+// may connect to a room, so someone kicked or never let into a private room
+// can't follow its game or chat.
+func (h *Hub) isRoomPlayer(roomID string, userID int) bool {
+	room, err := h.db.GetMultiplayerRoom(roomID)
+	if err != nil {
+		return false
+	}
+	for _, player := range room.Players {
+		if player.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.Hub.unregister <- c
@@ -1127,7 +1499,7 @@ func (c *Client) readPump() {
 		}
 	}()
 
-	c.Conn.SetReadLimit(512)
+	c.Conn.SetReadLimit(maxMessageSize)
 	if err := c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
 		log.Printf("Error setting read deadline: %v", err)
 		return
@@ -1140,8 +1512,7 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		var message WebSocketMessage
-		err := c.Conn.ReadJSON(&message)
+		_, raw, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -1149,6 +1520,33 @@ func (c *Client) readPump() {
 			break
 		}
 
+		switch c.checkMessageRate() {
+		case rateDrop:
+			continue
+		case rateWarn:
+			c.warnRateLimited()
+			continue
+		case rateDisconnect:
+			log.Printf("Disconnecting client %s (user %d) for exceeding message rate limit", c.ID, c.UserID)
+			closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded")
+			if err := c.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second)); err != nil {
+				log.Printf("Error writing close message: %v", err)
+			}
+			return
+		}
+
+		message, perr := decodeMessage(c.Protocol, raw)
+		if perr != nil {
+			log.Printf("Rejected message from client %s (user %d): %v", c.ID, c.UserID, perr)
+			c.sendProtocolError(perr)
+			continue
+		}
+
+		if ack, ok := message.Payload.(*StateAckPayload); ok {
+			c.acknowledge(ack.Frame)
+			continue
+		}
+
 		message.UserID = c.UserID
 		message.RoomID = c.RoomID
 
@@ -1179,6 +1577,14 @@ func (c *Client) writePump() {
 				return
 			}
 
+			if message.binary != nil {
+				if err := c.Conn.WriteMessage(websocket.BinaryMessage, message.binary); err != nil {
+					log.Printf("WebSocket write error: %v", err)
+					return
+				}
+				continue
+			}
+
 			if err := c.Conn.WriteJSON(message); err != nil {
 				log.Printf("WebSocket write error: %v", err)
 				return
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket that refills continuously at rate tokens per second
+// and holds at most burst tokens.
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket if one is available.
+func (b *Bucket) Allow() bool {
+	ok, _ := b.take(time.Now())
+	return ok
+}
+
+// Reserve takes a token if one is available and otherwise reports how long
+// the caller has to wait for the next one.
+func (b *Bucket) Reserve() (bool, time.Duration) {
+	return b.take(time.Now())
+}
+
+func (b *Bucket) take(now time.Time) (bool, time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if b.rate <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+func (b *Bucket) idleSince() time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.last
+}
+
+// Limiter keeps one Bucket per key, e.g. per IP address or per user.
+type Limiter struct {
+	rate        float64
+	burst       int
+	buckets     map[string]*Bucket
+	mutex       sync.Mutex
+	idleTimeout time.Duration
+	lastSweep   time.Time
+}
+
+// NewLimiter creates a keyed limiter allowing perMinute requests per minute
+// with bursts of up to burst requests.
+func NewLimiter(perMinute, burst int) *Limiter {
+	return &Limiter{
+		rate:        float64(perMinute) / 60.0,
+		burst:       burst,
+		buckets:     make(map[string]*Bucket),
+		idleTimeout: 10 * time.Minute,
+		lastSweep:   time.Now(),
+	}
+}
+
+// Allow reports whether a request for key may proceed and, if not, how long
+// until it may retry.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mutex.Lock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewBucket(l.rate, l.burst)
+		l.buckets[key] = bucket
+	}
+	if now.Sub(l.lastSweep) > l.idleTimeout {
+		l.sweep(now)
+	}
+	l.mutex.Unlock()
+
+	return bucket.take(now)
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+// Callers must hold l.mutex.
+func (l *Limiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.idleSince()) > l.idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketRefill(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name    string
+		rate    float64
+		burst   int
+		takes   int
+		after   time.Duration
+		allowed bool
+		wait    time.Duration
+	}{
+		{name: "burst available", rate: 1, burst: 3, takes: 2, allowed: true},
+		{name: "burst used up", rate: 1, burst: 3, takes: 3, allowed: false, wait: time.Second},
+		{name: "partly refilled", rate: 2, burst: 1, takes: 1, after: 250 * time.Millisecond, allowed: false, wait: 250 * time.Millisecond},
+		{name: "refilled", rate: 1, burst: 3, takes: 3, after: time.Second, allowed: true},
+		{name: "refilled after long idle", rate: 10, burst: 2, takes: 2, after: time.Minute, allowed: true},
+		{name: "zero burst allows one", rate: 1, burst: 0, takes: 1, allowed: false, wait: time.Second},
+		{name: "no refill", rate: 0, burst: 1, takes: 1, after: time.Hour, allowed: false, wait: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBucket(tt.rate, tt.burst)
+			b.last = start
+			for i := 0; i < tt.takes; i++ {
+				if ok, _ := b.take(start); !ok {
+					t.Fatalf("take %d was refused", i+1)
+				}
+			}
+
+			ok, wait := b.take(start.Add(tt.after))
+			if ok != tt.allowed {
+				t.Errorf("allowed = %v, want %v", ok, tt.allowed)
+			}
+			if wait != tt.wait {
+				t.Errorf("wait = %v, want %v", wait, tt.wait)
+			}
+		})
+	}
+}
+
+func TestBucketRefillAfterCapped(t *testing.T) {
+	start := time.Now()
+	b := NewBucket(10, 2)
+	b.last = start
+
+	now := start.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take(now); !ok {
+			t.Fatalf("take %d was refused", i+1)
+		}
+	}
+	if ok, _ := b.take(now); ok {
+		t.Error("bucket held more than its burst")
+	}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	l := NewLimiter(60, 1)
+
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request for a was refused")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("second request for a was allowed")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("b shares a's bucket")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(60, 1)
+
+	tests := []struct {
+		key  string
+		idle time.Duration
+		kept bool
+	}{
+		{key: "recent", idle: time.Minute, kept: true},
+		{key: "at timeout", idle: l.idleTimeout, kept: true},
+		{key: "idle", idle: l.idleTimeout + time.Second, kept: false},
+	}
+
+	for _, tt := range tests {
+		b := NewBucket(l.rate, l.burst)
+		b.last = now.Add(-tt.idle)
+		l.buckets[tt.key] = b
+	}
+
+	l.sweep(now)
+
+	for _, tt := range tests {
+		if _, ok := l.buckets[tt.key]; ok != tt.kept {
+			t.Errorf("%s kept = %v, want %v", tt.key, ok, tt.kept)
+		}
+	}
+	if !l.lastSweep.Equal(now) {
+		t.Errorf("lastSweep = %v, want %v", l.lastSweep, now)
+	}
+}
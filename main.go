@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/isaacjstriker/devware/internal/api"
+	"github.com/isaacjstriker/devware/internal/auth"
 	"github.com/isaacjstriker/devware/internal/config"
 	"github.com/isaacjstriker/devware/internal/database"
 )
@@ -40,9 +41,11 @@ func startCleanupScheduler(db *database.DB) {
 		log.Println("[INFO] Starting multiplayer room cleanup scheduler")
 
 		runCleanup(db)
+		runLoginCleanup(db)
 
 		for range ticker.C {
 			runCleanup(db)
+			runLoginCleanup(db)
 		}
 	}()
 }
@@ -65,3 +68,21 @@ func runCleanup(db *database.DB) {
 		log.Println("[INFO] No inactive rooms found to cleanup")
 	}
 }
+
+// loginHistoryRetention is how long login attempts for existing users are
+// kept for their login history.
+const loginHistoryRetention = 90 * 24 * time.Hour
+
+// runLoginCleanup deletes login attempts that are past the lockout window.
+// Attempts for usernames that don't exist are kept no longer than that.
+func runLoginCleanup(db *database.DB) {
+	now := time.Now()
+	pruned, err := db.PruneLoginAttempts(now.Add(-auth.DefaultLockoutPolicy().Window), now.Add(-loginHistoryRetention))
+	if err != nil {
+		log.Printf("[ERROR] Failed to prune login attempts: %v", err)
+		return
+	}
+	if pruned > 0 {
+		log.Printf("[INFO] Pruned %d old login attempts", pruned)
+	}
+}
@@ -39,6 +39,7 @@ async function handleLogin(event) {
         const data = await loginUser(username, password);
         saveAuthInfo(data.token, data.username, data.user_id);
         updateAuthUI();
+        window.multiplayerManager?.connectUserSocket();
         showView('mainMenu');
     } catch (error) {
         errorEl.textContent = error.message;
@@ -106,6 +107,7 @@ async function handleRegister(event) {
             if (loginResponse.ok) {
                 saveAuthInfo(loginResult.token, loginResult.username, loginResult.user_id);
                 updateAuthUI();
+                window.multiplayerManager?.connectUserSocket();
                 showView('mainMenu');
             } else {
                 errorEl.textContent = 'Registration successful, but login failed. Please try logging in manually.';
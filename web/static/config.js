@@ -27,13 +27,16 @@ export const PIECE_COLORS = [
     '#FFFF00', 
     '#FF0000',
     '#800080',
-    '#00FF00'
+    '#00FF00',
+    '#808080'
 ];
 
 export const MESSAGE_TYPES = {
     GAME_STATE: 'game_state',
     GAME_INPUT: 'game_input',
-    GAME_START: 'game_start',
+    COUNTDOWN_STARTED: 'countdown_started',
+    COUNTDOWN_TICK: 'countdown_tick',
+    COUNTDOWN_CANCELLED: 'countdown_cancelled',
     GAME_END: 'game_end',
 
     ROOM_UPDATE: 'room_update',
@@ -41,11 +44,16 @@ export const MESSAGE_TYPES = {
     PLAYER_LEFT: 'player_left',
     PLAYER_UPDATE: 'player_update',
 
-    START_MULTIPLAYER_GAME: 'start_multiplayer_game',
     MULTIPLAYER_INIT: 'multiplayer_init',
     PLAYER_GAME_STATE: 'player_game_state',
     MATCH_ENDED: 'match_ended',
 
+    CHAT_MESSAGE: 'chat_message',
+    CHAT_HISTORY: 'chat_history',
+    CHAT_DELETED: 'chat_deleted',
+    CHAT_IGNORE: 'chat_ignore',
+    CHAT_IGNORE_UPDATED: 'chat_ignore_updated',
+
     READY: 'ready',
     ERROR: 'error'
 };
@@ -23,7 +23,8 @@ const PIECE_COLORS = [
     '#FFFF00',
     '#FF0000',
     '#800080',
-    '#00FF00'
+    '#00FF00',
+    '#808080'
 ];
 
 const COLORS = PIECE_COLORS;
@@ -321,7 +322,11 @@ function startGame(gameType, startLevel = GAME_CONFIG.DEFAULT_STARTING_LEVEL) {
     });
 
     const protocol = window.location.protocol === 'https:' ? 'wss' : 'ws';
-    const wsURL = `${protocol}://${window.location.host}/ws/game`;
+    // Signed-in games are saved by the server when they end.
+    const token = getAuthToken();
+    const wsURL = token
+        ? `${protocol}://${window.location.host}/ws/game?token=${token}`
+        : `${protocol}://${window.location.host}/ws/game`;
 
     console.log('Protocol detected:', window.location.protocol, '-> Using WebSocket protocol:', protocol);
     console.log('Connecting to:', wsURL);
@@ -350,17 +355,12 @@ function startGame(gameType, startLevel = GAME_CONFIG.DEFAULT_STARTING_LEVEL) {
     ws.onmessage = (event) => {
         const gameState = JSON.parse(event.data);
         if (gameState.type === 'gameOver') {
-            showGameOverScreen(gameState.score);
+            showGameOverScreen(gameState.score, gameState.stats, gameState.finesse, gameState.saved);
             ws.close();
         } else {
             renderGame(gameState);
             updateGameInfo(gameState);
 
-            if (gameState.gameOver) {
-                showGameOverScreen(gameState.score, gameState.stats);
-                ws.close();
-            }
-
             if (window.isMultiplayer && window.multiplayerWs && window.multiplayerWs.readyState === WebSocket.OPEN) {
                 broadcastGameStateToOpponents(gameState);
             }
@@ -440,6 +440,14 @@ function handleKeyPress(event) {
         case 'X':
             action = 'rotate';
             break;
+        case 'z':
+        case 'Z':
+            action = 'rotateCCW';
+            break;
+        case 'a':
+        case 'A':
+            action = 'rotate180';
+            break;
         case 'c':
         case 'C':
         case 'Shift':
@@ -499,6 +507,14 @@ function handleMultiplayerKeyPress(event) {
         case 'X':
             action = 'rotate';
             break;
+        case 'z':
+        case 'Z':
+            action = 'rotateCCW';
+            break;
+        case 'a':
+        case 'A':
+            action = 'rotate180';
+            break;
         case 'c':
         case 'C':
         case 'Shift':
@@ -602,23 +618,10 @@ function updateGameInfo(state) {
     renderHoldPiece(state.holdPiece);
 }
 
-function showGameOverScreen(finalScore, stats = null) {
+function showGameOverScreen(finalScore, stats = null, finesse = null, saved = undefined) {
     const token = getAuthToken();
-    if (token) {
-        const metadata = stats ? {
-            time_played: stats.timePlayed,
-            pieces_placed: stats.piecesPlaced,
-            ppm: stats.ppm,
-            line_stats: stats.lineStats
-        } : {};
-
-        submitScore('tetris', finalScore, metadata)
-            .then(() => {
-                logger.info('Score submitted successfully');
-            })
-            .catch(error => {
-                logger.error('Failed to submit score', error);
-            });
+    if (saved === false) {
+        logger.error('Server failed to save score');
     }
 
     const overlay = document.createElement('div');
@@ -652,8 +655,10 @@ function showGameOverScreen(finalScore, stats = null) {
         <p>Final Score: <strong>${finalScore}</strong></p>
     `;
 
-    if (token) {
+    if (saved) {
         content += `<p style="color: #00ff00; font-size: 0.9em;">✓ Score submitted to leaderboard!</p>`;
+    } else if (token) {
+        content += `<p style="color: #ff5555; font-size: 0.9em;">Your score could not be saved</p>`;
     } else {
         content += `<p style="color: #ffaa00; font-size: 0.9em;">Login to save your score to the leaderboard</p>`;
     }
@@ -679,6 +684,16 @@ function showGameOverScreen(finalScore, stats = null) {
         `;
     }
 
+    if (finesse && finesse.pieces > 0) {
+        content += `
+            <div style="margin: 20px 0; text-align: left;">
+                <div>Keys per Piece: ${finesse.kpp.toFixed(2)}</div>
+                <div>Finesse Faults: ${finesse.faults}</div>
+                <div>Finesse Accuracy: ${finesse.accuracy.toFixed(1)}%</div>
+            </div>
+        `;
+    }
+
     content += `
         <div style="margin-top: 20px;">
             <button id="restart-game-btn" style="margin-right: 10px; padding: 8px 16px; background: #333; color: #fff; border: 1px solid #fff; font-family: 'Courier New', monospace;">Play Again</button>
@@ -823,27 +838,6 @@ function updateMultiplayerTimer() {
     }
 }
 
-function sendMultiplayerGameStart(roomId) {
-    try {
-        if (window.multiplayerWs && window.multiplayerWs.readyState === WebSocket.OPEN) {
-            const message = {
-                type: 'start_multiplayer_game',
-                room_id: roomId
-            };
-
-            window.multiplayerWs.send(JSON.stringify(message));
-            logger.debug('Sent start_multiplayer_game message via room WebSocket');
-            return true;
-        } else {
-            logger.warn('Cannot send multiplayer game start - WebSocket not ready');
-            return false;
-        }
-    } catch (error) {
-        logger.error('Failed to send multiplayer game start message', error);
-        return false;
-    }
-}
-
 function startMultiplayerGame(roomId, multiplayerWs, startingLevel = GAME_CONFIG.DEFAULT_STARTING_LEVEL) {
     logger.info('Starting multiplayer game for room', { roomId });
 
@@ -856,10 +850,6 @@ function startMultiplayerGame(roomId, multiplayerWs, startingLevel = GAME_CONFIG
 
         document.addEventListener('keydown', handleMultiplayerKeyPress);
 
-        if (!sendMultiplayerGameStart(roomId)) {
-            throw new Error('Failed to send game start message');
-        }
-
         logger.info('Multiplayer game setup complete - using room WebSocket for all communication');
     } catch (error) {
         logger.error('Failed to start multiplayer game', error);
@@ -18,9 +18,22 @@ class MultiplayerManager {
         this.isHost = false;
         this.reconnectInterval = null;
         this.rooms = [];
+        this.inviteLink = null;
+        this.userWs = null;
+        this.friends = [];
+        this.friendRequests = [];
 
         this.initializeElements();
         this.attachEventListeners();
+
+        if (localStorage.getItem('devware_jwt')) {
+            this.connectUserSocket();
+        }
+
+        const invite = new URLSearchParams(window.location.search).get('invite');
+        if (invite && localStorage.getItem('devware_jwt')) {
+            this.joinByInvite(invite);
+        }
     }
 
     initializeElements() {
@@ -47,6 +60,17 @@ class MultiplayerManager {
         this.readyBtn = document.getElementById('ready-btn');
         this.leaveRoomBtn = document.getElementById('leave-room-btn');
         this.lobbyStatus = document.getElementById('lobby-status');
+        this.lobbyInvite = document.getElementById('lobby-invite');
+
+        this.lobbyChatMessages = document.getElementById('lobby-chat-messages');
+        this.lobbyChatForm = document.getElementById('lobby-chat-form');
+        this.roomChatMessages = document.getElementById('room-chat-messages');
+        this.roomChatForm = document.getElementById('room-chat-form');
+
+        this.addFriendForm = document.getElementById('add-friend-form');
+        this.addFriendInput = document.getElementById('add-friend-username');
+        this.friendsList = document.getElementById('friends-list');
+        this.lobbyFriends = document.getElementById('lobby-friends');
 
         this.backBtn = document.getElementById('back-to-menu-from-multiplayer-btn');
     }
@@ -63,6 +87,10 @@ class MultiplayerManager {
         this.readyBtn.addEventListener('click', () => this.toggleReady());
         this.leaveRoomBtn.addEventListener('click', () => this.leaveRoom());
 
+        this.lobbyChatForm.addEventListener('submit', (e) => this.sendChat(e));
+        this.roomChatForm.addEventListener('submit', (e) => this.sendChat(e));
+        this.addFriendForm.addEventListener('submit', (e) => this.addFriend(e));
+
         this.backBtn.addEventListener('click', () => this.handleBackToMenu());
     }
 
@@ -118,7 +146,7 @@ class MultiplayerManager {
         }
 
         const roomsHTML = this.rooms.map(room => {
-            const currentPlayers = room.settings?.current_players || 0;
+            const currentPlayers = room.current_players || 0;
             const isFull = currentPlayers >= room.max_players;
             const isActive = room.status === 'active';
             const startingLevel = room.settings?.starting_level || 1;
@@ -180,6 +208,7 @@ class MultiplayerManager {
             const room = await apiCall('/rooms', 'POST', roomData);
             logger.info('Creating room: API call successful', { roomId: room.id });
             this.currentRoom = room;
+            this.inviteLink = room.invite_link;
             this.isHost = true;
             this.connectToRoom(room.id);
             this.showTab('lobby');
@@ -191,21 +220,46 @@ class MultiplayerManager {
     }
 
     async joinRoom(roomId) {
-        try {
-            const response = await apiCall(`/room/${roomId}/join`, 'POST');
-            const room = await apiCall(`/room/${roomId}`, 'GET');
+        const listed = this.rooms.find(room => room.id === roomId);
+        let body;
+        if (listed && listed.has_password) {
+            const password = prompt('This room needs a password:');
+            if (password === null) return;
+            body = { password };
+        }
 
-            this.currentRoom = room;
-            this.isHost = false;
-            this.connectToRoom(roomId);
-            this.showTab('lobby');
-            this.updateLobbyDisplay();
+        try {
+            const room = await apiCall(`/room/${roomId}/join`, 'POST', body);
+            this.enterRoom(room);
         } catch (error) {
             console.error('Failed to join room:', error);
             alert('Failed to join room. Please try again.');
         }
     }
 
+    async joinByInvite(code) {
+        try {
+            const room = await apiCall(`/invites/${encodeURIComponent(code)}/join`, 'POST');
+            if (window.showView) {
+                window.showView('multiplayer');
+            }
+            this.enterRoom(room);
+        } catch (error) {
+            console.error('Failed to join room by invite:', error);
+            alert('That invite is no longer valid.');
+        }
+    }
+
+    enterRoom(room) {
+        this.currentRoom = room;
+        this.inviteLink = room.invite_link;
+        this.isHost = false;
+        this.connectToRoom(room.id);
+        this.showTab('lobby');
+        this.updateLobbyDisplay();
+        this.loadFriends();
+    }
+
     connectToRoom(roomId) {
         const token = localStorage.getItem('devware_jwt');
         if (!token) {
@@ -245,6 +299,9 @@ class MultiplayerManager {
             if (event.code === 1000) {
                 // Normal closure - user intentionally left
                 console.log('Normal disconnection');
+            } else if (event.code === 1008 && event.reason === 'not a player in this room') {
+                // Policy violation - the server won't let us back into the room
+                this.handleKicked({ data: { message: 'You are no longer in this room' } });
             } else {
                 // Abnormal closure - connection lost
                 console.log('Abnormal disconnection - handling as connection loss');
@@ -274,8 +331,14 @@ class MultiplayerManager {
             case 'room_update':
                 this.handleRoomUpdate(message.data.room);
                 break;
-            case 'game_start':
-                this.handleGameStart(message);
+            case 'countdown_started':
+                this.handleCountdownStarted(message.data);
+                break;
+            case 'countdown_tick':
+                this.showCountdown(message.data.remaining);
+                break;
+            case 'countdown_cancelled':
+                this.handleCountdownCancelled(message.data);
                 break;
             case 'multiplayer_game_started':
                 this.handleMultiplayerGameStarted(message);
@@ -301,6 +364,18 @@ class MultiplayerManager {
             case 'room_closed':
                 this.handleRoomClosed(message);
                 break;
+            case 'kicked':
+                this.handleKicked(message);
+                break;
+            case 'host_changed':
+                this.handleHostChanged(message.data);
+                break;
+            case 'chat_history':
+            case 'chat_message':
+            case 'chat_deleted':
+            case 'chat_ignore_updated':
+                this.handleChatMessage(message);
+                break;
             case 'rooms_updated':
                 this.handleRoomsUpdated(message);
                 break;
@@ -308,8 +383,8 @@ class MultiplayerManager {
                 this.handleMatchEnded(message);
                 break;
             case 'error':
-                console.error('Server error:', message.data.error);
-                alert(message.data.error);
+                console.error('Server error:', message.error || message.data?.error);
+                alert(message.error || message.data?.error);
                 break;
             default:
                 console.log('Unhandled message type:', message.type);
@@ -324,18 +399,6 @@ class MultiplayerManager {
         }
     }
 
-    handleGameStart(message) {
-        console.log('Game starting:', message.data);
-        if (message.data && message.data.message) {
-            this.showNotification(message.data.message, 'success');
-        }
-        if (this.currentRoom) {
-            setTimeout(() => {
-                window.startMultiplayerGame(this.currentRoom.id);
-            }, 1500);
-        }
-    }
-
     handleMultiplayerGameStarted(message) {
         console.log('Multiplayer game started:', message.data);
         if (message.data && message.data.message) {
@@ -398,9 +461,14 @@ class MultiplayerManager {
         this.lobbyGameType.textContent = this.currentRoom.game_type;
         this.lobbyPlayerCount.textContent = `${this.currentRoom.players.length}/${this.currentRoom.max_players}`;
 
+        if (this.lobbyInvite) {
+            this.lobbyInvite.classList.toggle('hidden', !this.inviteLink);
+            this.lobbyInvite.textContent = this.inviteLink ? `Invite link: ${this.inviteLink}` : '';
+        }
+
         const playersHTML = this.currentRoom.players.map(player => `
             <div class="player-item">
-                <span class="player-name">${this.escapeHtml(player.username)}</span>
+                <span class="player-name">${this.escapeHtml(player.username)}${player.user_id === this.currentRoom.host_id ? ' (host)' : ''}</span>
                 <span class="player-status ${player.is_ready ? '' : 'not-ready'}">
                     ${player.is_ready ? 'Ready' : 'Not Ready'}
                 </span>
@@ -410,6 +478,7 @@ class MultiplayerManager {
         this.lobbyPlayers.innerHTML = playersHTML;
 
         const currentUser = getCurrentUser();
+        this.isHost = !!currentUser && this.currentRoom.host_id === currentUser.id;
         if (currentUser) {
             const userPlayer = this.currentRoom.players.find(p => p.username === currentUser.username);
             if (userPlayer) {
@@ -547,12 +616,28 @@ class MultiplayerManager {
         }
     }
 
-    handleGameStart(gameData) {
-        console.log('Game starting!', gameData);
+    handleCountdownStarted(countdownData) {
+        console.log('Countdown started:', countdownData);
 
-        this.showGameCountdown(() => {
-            this.startMultiplayerGame();
-        });
+        if (countdownData.message) {
+            this.showNotification(countdownData.message, 'success');
+        }
+        this.showCountdown(countdownData.seconds);
+        this.startMultiplayerGame();
+    }
+
+    handleCountdownCancelled(countdownData) {
+        console.log('Countdown cancelled:', countdownData);
+
+        this.hideCountdown();
+        this.showNotification(`Start cancelled: ${countdownData.reason}`, 'warning');
+
+        if (window.cleanupMultiplayerGame) {
+            window.cleanupMultiplayerGame();
+        }
+        if (window.showView) {
+            window.showView('multiplayer');
+        }
     }
 
     handlePlayerGameState(message) {
@@ -589,6 +674,8 @@ class MultiplayerManager {
     handleMultiplayerGameStarted(gameData) {
         console.log('Multiplayer game started:', gameData);
 
+        this.hideCountdown();
+
         this.showNotification(gameData.message || 'Game started! Use arrow keys to play.', 'success');
 
         if (window.handleMultiplayerUpdate) {
@@ -609,42 +696,36 @@ class MultiplayerManager {
         console.log('Player input received:', message);
     }
 
-    showGameCountdown(callback) {
-        let countdown = 3;
-
-        const countdownOverlay = document.createElement('div');
-        countdownOverlay.className = 'countdown-overlay';
-        countdownOverlay.style.cssText = `
-            position: fixed;
-            top: 0;
-            left: 0;
-            width: 100%;
-            height: 100%;
-            background: rgba(0, 0, 0, 0.8);
-            display: flex;
-            align-items: center;
-            justify-content: center;
-            z-index: 10000;
-            font-size: 72px;
-            color: white;
-            font-weight: bold;
-        `;
-        countdownOverlay.textContent = countdown;
-        document.body.appendChild(countdownOverlay);
+    showCountdown(remaining) {
+        let countdownOverlay = document.querySelector('.countdown-overlay');
+        if (!countdownOverlay) {
+            countdownOverlay = document.createElement('div');
+            countdownOverlay.className = 'countdown-overlay';
+            countdownOverlay.style.cssText = `
+                position: fixed;
+                top: 0;
+                left: 0;
+                width: 100%;
+                height: 100%;
+                background: rgba(0, 0, 0, 0.8);
+                display: flex;
+                align-items: center;
+                justify-content: center;
+                z-index: 10000;
+                font-size: 72px;
+                color: white;
+                font-weight: bold;
+            `;
+            document.body.appendChild(countdownOverlay);
+        }
+        countdownOverlay.textContent = remaining > 0 ? remaining : 'GO!';
+    }
 
-        const countdownInterval = setInterval(() => {
-            countdown--;
-            if (countdown > 0) {
-                countdownOverlay.textContent = countdown;
-            } else {
-                countdownOverlay.textContent = 'GO!';
-                setTimeout(() => {
-                    document.body.removeChild(countdownOverlay);
-                    callback();
-                }, 500);
-                clearInterval(countdownInterval);
-            }
-        }, 1000);
+    hideCountdown() {
+        const countdownOverlay = document.querySelector('.countdown-overlay');
+        if (countdownOverlay) {
+            document.body.removeChild(countdownOverlay);
+        }
     }
 
     startMultiplayerGame() {
@@ -1040,6 +1121,110 @@ class MultiplayerManager {
         }
     }
 
+    handleHostChanged(hostData) {
+        if (hostData.room) {
+            this.currentRoom = hostData.room;
+            this.updateLobbyDisplay();
+        }
+        const message = this.isHost ? 'You are now the host' : `${hostData.username} is now the host`;
+        this.showNotification(message, 'info');
+    }
+
+    chatContainer(channel) {
+        return channel === 'lobby' ? this.lobbyChatMessages : this.roomChatMessages;
+    }
+
+    handleChatMessage(message) {
+        const data = message.data || {};
+        switch (message.type) {
+            case 'chat_history': {
+                const container = this.chatContainer(data.channel);
+                container.innerHTML = '';
+                (data.messages || []).forEach(chat => this.appendChatMessage(container, chat));
+                break;
+            }
+            case 'chat_message':
+                this.appendChatMessage(this.chatContainer(data.channel), data.message);
+                break;
+            case 'chat_deleted': {
+                const element = this.chatContainer(data.channel).querySelector(`[data-message-id="${data.id}"]`);
+                if (element) {
+                    element.remove();
+                }
+                break;
+            }
+            case 'chat_ignore_updated':
+                if (data.kind) {
+                    [this.lobbyChatMessages, this.roomChatMessages].forEach(container => {
+                        container.querySelectorAll(`[data-user-id="${data.user_id}"]`).forEach(element => element.remove());
+                    });
+                    this.showNotification(`User ${data.kind === 'block' ? 'blocked' : 'muted'}`, 'info');
+                } else {
+                    this.showNotification('User unmuted', 'info');
+                }
+                break;
+        }
+    }
+
+    appendChatMessage(container, chat) {
+        const element = document.createElement('div');
+        element.className = 'chat-message';
+        element.dataset.messageId = chat.id;
+        element.dataset.userId = chat.user_id;
+
+        const author = document.createElement('span');
+        author.className = 'chat-author';
+        author.textContent = `${chat.username}:`;
+        const currentUser = getCurrentUser();
+        if (!currentUser || currentUser.id !== chat.user_id) {
+            author.title = 'Click to mute';
+            author.addEventListener('click', () => this.muteUser(chat.user_id, chat.username));
+        }
+
+        const text = document.createElement('span');
+        text.className = 'chat-text';
+        text.textContent = ` ${chat.text}`;
+
+        element.append(author, text);
+        container.appendChild(element);
+        container.scrollTop = container.scrollHeight;
+    }
+
+    sendChat(e) {
+        e.preventDefault();
+        const input = e.target.querySelector('input');
+        const text = input.value.trim();
+        if (!text) return;
+
+        if (!this.ws || this.ws.readyState !== WebSocket.OPEN) {
+            this.showNotification('Not connected to chat', 'error');
+            return;
+        }
+        this.ws.send(JSON.stringify({
+            type: 'chat_message',
+            data: { text }
+        }));
+        input.value = '';
+    }
+
+    muteUser(userId, username) {
+        if (!confirm(`Mute ${username}? You won't see their messages.`)) return;
+        if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+            this.ws.send(JSON.stringify({
+                type: 'chat_ignore',
+                data: { user_id: userId, kind: 'mute' }
+            }));
+        }
+    }
+
+    handleKicked(message) {
+        alert(`${message.data?.message || 'You were removed from the room'}. Returning to room browser.`);
+        this.disconnectFromRoom(false);
+        this.inviteLink = null;
+        this.showTab('browser');
+        this.refreshRooms();
+    }
+
     handleMatchEnded(message) {
         const reason = message.data?.reason || 'unknown';
         const playerName = message.data?.playerName || 'A player';
@@ -1140,6 +1325,170 @@ class MultiplayerManager {
         this.connectForRoomUpdates();
 
         this.refreshRooms();
+        this.loadFriends();
+    }
+
+    connectUserSocket() {
+        if (this.userWs && this.userWs.readyState <= WebSocket.OPEN) {
+            return;
+        }
+
+        const token = localStorage.getItem('devware_jwt');
+        if (!token) return;
+
+        const wsProtocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        this.userWs = new WebSocket(`${wsProtocol}//${window.location.host}/ws/user?token=${token}`);
+
+        this.userWs.onmessage = (event) => {
+            try {
+                this.handleUserMessage(JSON.parse(event.data));
+            } catch (error) {
+                console.error('Failed to parse user message:', error);
+            }
+        };
+
+        this.userWs.onclose = (event) => {
+            console.log('User connection closed - Code:', event.code);
+            if (event.code !== 1000 && localStorage.getItem('devware_jwt')) {
+                setTimeout(() => this.connectUserSocket(), GAME_CONFIG.RECONNECTION_DELAY);
+            }
+        };
+    }
+
+    handleUserMessage(message) {
+        const data = message.data || {};
+        switch (message.type) {
+            case 'friend_request':
+                this.showNotification(`${data.username} sent you a friend request`, 'info');
+                this.loadFriends();
+                break;
+            case 'friend_accepted':
+                this.showNotification(`${data.username} is now your friend`, 'success');
+                this.loadFriends();
+                break;
+            case 'friend_removed':
+                this.loadFriends();
+                break;
+            case 'presence_update': {
+                const friend = this.friends.find(f => f.user_id === data.user_id);
+                if (friend) {
+                    friend.presence = data.presence;
+                    this.renderFriends();
+                }
+                break;
+            }
+            case 'game_invite':
+                if (confirm(`${data.from_username} invited you to ${data.room_name}. Join now?`)) {
+                    this.joinByInvite(data.invite_code);
+                }
+                break;
+            case 'achievement_unlocked':
+                (data.achievements || []).forEach(achievement => {
+                    this.showNotification(`Achievement unlocked: ${achievement}`, 'success');
+                });
+                break;
+            case 'moderator_message':
+                alert(`Message from moderator ${data.from}:\n\n${data.text}`);
+                break;
+        }
+    }
+
+    async loadFriends() {
+        try {
+            const data = await apiCall('/friends', 'GET');
+            this.friends = data.friends || [];
+            this.friendRequests = data.incoming || [];
+            this.renderFriends();
+        } catch (error) {
+            console.error('Failed to load friends:', error);
+        }
+    }
+
+    presenceLabel(presence) {
+        switch (presence?.status) {
+            case 'in_game':
+                return 'In game';
+            case 'spectating':
+                return 'Spectating';
+            case 'online':
+                return 'Online';
+            default:
+                return 'Offline';
+        }
+    }
+
+    renderFriends() {
+        const requestsHTML = this.friendRequests.map(request => `
+            <div class="player-item">
+                <span class="player-name">${this.escapeHtml(request.username)}</span>
+                <span>
+                    <button class="action-btn" onclick="multiplayerManager.acceptFriend(${request.user_id})">Accept</button>
+                    <button class="secondary-btn" onclick="multiplayerManager.removeFriend(${request.user_id})">Decline</button>
+                </span>
+            </div>
+        `).join('');
+
+        const friendsHTML = this.friends.map(friend => `
+            <div class="player-item">
+                <span class="player-name">${this.escapeHtml(friend.username)}</span>
+                <span class="player-status ${friend.presence?.status === 'offline' ? 'not-ready' : ''}">${this.presenceLabel(friend.presence)}</span>
+                <button class="secondary-btn" onclick="multiplayerManager.removeFriend(${friend.user_id})">Remove</button>
+            </div>
+        `).join('');
+
+        this.friendsList.innerHTML = requestsHTML + friendsHTML || '<div class="loading">No friends yet</div>';
+
+        const inRoom = new Set((this.currentRoom?.players || []).map(p => p.user_id));
+        const invitable = this.friends.filter(f => f.presence?.status === 'online' && !inRoom.has(f.user_id));
+        this.lobbyFriends.innerHTML = invitable.map(friend => `
+            <div class="player-item">
+                <span class="player-name">${this.escapeHtml(friend.username)}</span>
+                <button class="action-btn" onclick="multiplayerManager.inviteFriend(${friend.user_id})">Invite</button>
+            </div>
+        `).join('') || '<div class="loading">No friends online</div>';
+    }
+
+    async addFriend(e) {
+        e.preventDefault();
+        const username = this.addFriendInput.value.trim();
+        if (!username) return;
+
+        try {
+            const result = await apiCall('/friends/requests', 'POST', { username });
+            this.addFriendInput.value = '';
+            this.showNotification(result.status === 'accepted' ? `${username} is now your friend` : `Friend request sent to ${username}`, 'success');
+            this.loadFriends();
+        } catch (error) {
+            this.showNotification(error.message, 'error');
+        }
+    }
+
+    async acceptFriend(userId) {
+        try {
+            await apiCall(`/friends/${userId}/accept`, 'POST');
+            this.loadFriends();
+        } catch (error) {
+            this.showNotification(error.message, 'error');
+        }
+    }
+
+    async removeFriend(userId) {
+        try {
+            await apiCall(`/friends/${userId}`, 'DELETE');
+            this.loadFriends();
+        } catch (error) {
+            this.showNotification(error.message, 'error');
+        }
+    }
+
+    async inviteFriend(userId) {
+        if (!this.currentRoom) return;
+        try {
+            await apiCall(`/room/${this.currentRoom.id}/invites`, 'POST', { user_id: userId });
+            this.showNotification('Invite sent', 'success');
+        } catch (error) {
+            this.showNotification(error.message, 'error');
+        }
     }
 
     connectForRoomUpdates() {
@@ -1165,6 +1514,10 @@ class MultiplayerManager {
                 const message = JSON.parse(event.data);
                 if (message.type === 'rooms_updated') {
                     this.handleRoomsUpdated(message);
+                } else if (message.type.startsWith('chat_')) {
+                    this.handleChatMessage(message);
+                } else if (message.type === 'error' && message.error) {
+                    this.showNotification(message.error, 'error');
                 }
             } catch (error) {
                 console.error('Failed to parse room update message:', error);